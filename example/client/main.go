@@ -16,7 +16,7 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	pb "github.com/CanobbioE/poly-route/example/mock/proto-gen/mockserver/v1"
-	"github.com/CanobbioE/poly-route/internal/forwarder"
+	"github.com/CanobbioE/poly-route/internal/routing"
 )
 
 var (
@@ -79,7 +79,7 @@ func testGrpcStream(regionMappingKey string) error {
 	defer cancel()
 
 	ctx = metadata.NewOutgoingContext(ctx, metadata.MD{
-		forwarder.MetadataRegionKey: []string{regionMappingKey},
+		routing.MetadataRegionKey: []string{regionMappingKey},
 	})
 
 	biStream, err := client.BiDirectionalStream(ctx)
@@ -159,7 +159,7 @@ func testGrpcInvoke(regionMappingKey string) error {
 	defer cancel()
 
 	ctx = metadata.NewOutgoingContext(ctx, metadata.MD{
-		forwarder.MetadataRegionKey: []string{regionMappingKey},
+		routing.MetadataRegionKey: []string{regionMappingKey},
 	})
 
 	authResp, err := client.Invoke(ctx, &pb.ReadRequest{
@@ -195,7 +195,7 @@ func testHTTPClient(regionHeader string) error {
 	}
 
 	for _, req := range []*http.Request{getReq, postReq} {
-		req.Header.Set(forwarder.HeaderRegionKey, regionHeader)
+		req.Header.Set(routing.HeaderRegionKey, regionHeader)
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return err
@@ -220,7 +220,7 @@ func testGraphQLClient(regionHeader string) error {
 		return err
 	}
 
-	req.Header.Set(forwarder.HeaderRegionKey, regionHeader)
+	req.Header.Set(routing.HeaderRegionKey, regionHeader)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
@@ -124,8 +124,8 @@ const file_mockserver_v1_mock_proto_rawDesc = "" +
 	"\x06Invoke\x12\x1a.mockserver.v1.ReadRequest\x1a\x1b.mockserver.v1.ReadResponse\x12R\n" +
 	"\x13BiDirectionalStream\x12\x1a.mockserver.v1.ReadRequest\x1a\x1b.mockserver.v1.ReadResponse(\x010\x01\x12I\n" +
 	"\fClientStream\x12\x1a.mockserver.v1.ReadRequest\x1a\x1b.mockserver.v1.ReadResponse(\x01\x12I\n" +
-	"\fServerStream\x12\x1a.mockserver.v1.ReadRequest\x1a\x1b.mockserver.v1.ReadResponse0\x01B\x8f\x01\n" +
-	"\x11com.mockserver.v1B\tMockProtoP\x01Z\x1amockserver/v1;mockserverv1\xa2\x02\x03MXX\xaa\x02\rMockserver.V1\xca\x02\rMockserver\\V1\xe2\x02\x19Mockserver\\V1\\GPBMetadata\xea\x02\x0eMockserver::V1b\x06proto3"
+	"\fServerStream\x12\x1a.mockserver.v1.ReadRequest\x1a\x1b.mockserver.v1.ReadResponse0\x01B\xc6\x01\n" +
+	"\x11com.mockserver.v1B\tMockProtoP\x01ZQgithub.com/CanobbioE/poly-route/example/mock/proto-gen/mockserver/v1;mockserverv1\xa2\x02\x03MXX\xaa\x02\rMockserver.V1\xca\x02\rMockserver\\V1\xe2\x02\x19Mockserver\\V1\\GPBMetadata\xea\x02\x0eMockserver::V1b\x06proto3"
 
 var (
 	file_mockserver_v1_mock_proto_rawDescOnce sync.Once
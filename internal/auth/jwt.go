@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/fieldpath"
+)
+
+var (
+	// ErrInvalidToken is returned when a token cannot be verified.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrMissingToken is returned when a token is required but the request does not carry one.
+	ErrMissingToken = errors.New("missing bearer token")
+)
+
+// Verifier verifies JSON Web Tokens and extracts the configured claim from their payload.
+// Signatures are verified by go-jose, which binds every algorithm to the type of its keys.
+// It is safe for concurrent use.
+type Verifier struct {
+	claim      string
+	issuer     string
+	audience   string
+	keys       []jose.JSONWebKey
+	algorithms []jose.SignatureAlgorithm
+	leeway     time.Duration
+	required   bool
+	requireExp bool
+}
+
+// NewVerifier creates a Verifier loading the keys defined in cfg.
+func NewVerifier(cfg *config.JWT) (*Verifier, error) {
+	v := &Verifier{
+		claim:      cfg.Claim,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		required:   cfg.Required,
+		requireExp: cfg.RequireExp,
+		algorithms: supportedAlgorithms,
+	}
+
+	if cfg.Leeway != "" {
+		leeway, err := time.ParseDuration(cfg.Leeway)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid leeway %q: %w", cfg.Leeway, err)
+		}
+		v.leeway = leeway
+	}
+
+	for i, k := range cfg.Keys {
+		key, err := loadStaticKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: keys[%d]: %w", i, err)
+		}
+		v.keys = append(v.keys, key)
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %w", err)
+		}
+		v.keys = append(v.keys, keys...)
+	}
+
+	return v, nil
+}
+
+// Required reports whether requests without a token must be rejected.
+func (v *Verifier) Required() bool {
+	return v.required
+}
+
+// BearerToken returns the token carried by an Authorization header value using the Bearer scheme.
+func BearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Claim verifies the token signature and registered claims, then returns the value of the configured claim.
+// The returned error wraps ErrInvalidToken whenever the token is not acceptable.
+func (v *Verifier) Claim(token string) (string, error) {
+	tok, err := jwt.ParseSigned(token, v.algorithms)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	var registered jwt.Claims
+	var payload json.RawMessage
+	if err = v.verify(tok, &registered, &payload); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err = v.validateClaims(&registered); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := map[string]any{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return "", fmt.Errorf("%w: payload: %w", ErrInvalidToken, err)
+	}
+
+	value, err := fieldpath.Get(claims, v.claim)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	switch val := value.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	default:
+		return "", fmt.Errorf("%w: claim %s is not a string (%T)", ErrInvalidToken, v.claim, value)
+	}
+}
+
+// verify checks the signature against every key matching the token header, and decodes the payload into out.
+func (v *Verifier) verify(tok *jwt.JSONWebToken, out ...any) error {
+	// ParseSigned only accepts compact tokens, which carry exactly one signature
+	h := tok.Headers[0]
+	for i := range v.keys {
+		k := &v.keys[i]
+		if h.KeyID != "" && k.KeyID != "" && k.KeyID != h.KeyID {
+			continue
+		}
+		if k.Algorithm != "" && k.Algorithm != h.Algorithm {
+			continue
+		}
+		if tok.Claims(k.Key, out...) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature verification failed")
+}
+
+func (v *Verifier) validateClaims(claims *jwt.Claims) error {
+	if v.requireExp && claims.Expiry == nil {
+		return errors.New("missing expiration time")
+	}
+	expected := jwt.Expected{Issuer: v.issuer}
+	if v.audience != "" {
+		expected.AnyAudience = jwt.Audience{v.audience}
+	}
+	return claims.ValidateWithLeeway(expected, v.leeway)
+}
@@ -0,0 +1,289 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/auth"
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// hmacSecret is as large as the output of SHA-256, the minimum size of an HS256 key.
+const hmacSecret = "a-32-bytes-long-hmac-test-secret"
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeToken(t *testing.T, hdr, claims map[string]any) string {
+	t.Helper()
+	h, err := json.Marshal(hdr)
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	return b64(h) + "." + b64(c)
+}
+
+func signHS256(t *testing.T, secret string, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := encodeToken(t, map[string]any{"alg": "HS256", "kid": kid}, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + b64(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	signed := encodeToken(t, map[string]any{"alg": "RS256", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	signed := encodeToken(t, map[string]any{"alg": "ES256"}, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + b64(sig)
+}
+
+func signEdDSA(t *testing.T, key ed25519.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	signed := encodeToken(t, map[string]any{"alg": "EdDSA"}, claims)
+	return signed + "." + b64(ed25519.Sign(key, []byte(signed)))
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return p
+}
+
+func TestVerifier_Claim(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ecdsa key: %v", err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]any{
+		{
+			"kty": "RSA", "kid": "rsa-1", "use": "sig",
+			"n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+
+	edDER, err := x509.MarshalPKIXPublicKey(edPub)
+	if err != nil {
+		t.Fatalf("marshal ed25519 key: %v", err)
+	}
+
+	verifier, err := auth.NewVerifier(&config.JWT{
+		Claim:    "user.id",
+		Issuer:   "https://issuer.example.com",
+		JWKSFile: writeFile(t, "jwks.json", jwks),
+		Keys: []config.JWTKey{
+			{ID: "hmac-1", Algorithm: "HS256", Secret: hmacSecret},
+			{
+				Algorithm:     "EdDSA",
+				PublicKeyFile: writeFile(t, "ed.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edDER})),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+
+	validClaims := map[string]any{
+		"iss":  "https://issuer.example.com",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"user": map[string]any{"id": "alice"},
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "HS256", token: signHS256(t, hmacSecret, "hmac-1", validClaims), want: "alice"},
+		{name: "RS256 from jwks", token: signRS256(t, rsaKey, "rsa-1", validClaims), want: "alice"},
+		{name: "ES256 from jwks", token: signES256(t, ecKey, validClaims), want: "alice"},
+		{name: "EdDSA from pem", token: signEdDSA(t, edKey, validClaims), want: "alice"},
+		{name: "wrong secret", token: signHS256(t, "a-32-bytes-long-guessed-secret!!", "hmac-1", validClaims), wantErr: true},
+		{name: "unknown signer", token: signRS256(t, otherKey, "rsa-1", validClaims), wantErr: true},
+		{
+			name: "expired",
+			token: signHS256(t, hmacSecret, "hmac-1", map[string]any{
+				"iss": "https://issuer.example.com", "exp": time.Now().Add(-time.Hour).Unix(), "user": map[string]any{"id": "a"},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: signHS256(t, hmacSecret, "hmac-1", map[string]any{
+				"iss": "https://evil.example.com", "user": map[string]any{"id": "alice"},
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "missing claim",
+			token:   signHS256(t, hmacSecret, "hmac-1", map[string]any{"iss": "https://issuer.example.com"}),
+			wantErr: true,
+		},
+		{
+			name:    "alg none",
+			token:   encodeToken(t, map[string]any{"alg": "none"}, validClaims) + ".",
+			wantErr: true,
+		},
+		{name: "malformed", token: "not-a-token", wantErr: true},
+		{
+			name:    "HS256 signed with the RSA public key",
+			token:   signHS256(t, string(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)), "rsa-1", validClaims),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.Claim(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Claim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, auth.ErrInvalidToken) {
+				t.Errorf("Claim() error = %v, want ErrInvalidToken", err)
+			}
+			if got != tt.want {
+				t.Errorf("Claim() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		wantOk bool
+	}{
+		{header: "Bearer abc.def.ghi", want: "abc.def.ghi", wantOk: true},
+		{header: "bearer abc", want: "abc", wantOk: true},
+		{header: "Basic dXNlcjpwYXNz"},
+		{header: "Bearer "},
+		{header: ""},
+	}
+	for _, tt := range tests {
+		got, ok := auth.BearerToken(tt.header)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("BearerToken(%q) = %q, %v, want %q, %v", tt.header, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestVerifier_Claim_RequireExp(t *testing.T) {
+	tests := []struct {
+		claims     map[string]any
+		name       string
+		requireExp bool
+		wantErr    bool
+	}{
+		{name: "no exp", claims: map[string]any{"sub": "alice"}},
+		{name: "required exp", claims: map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()},
+			requireExp: true},
+		{name: "missing required exp", claims: map[string]any{"sub": "alice"}, requireExp: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := auth.NewVerifier(&config.JWT{
+				Claim:      "sub",
+				Keys:       []config.JWTKey{{Algorithm: "HS256", Secret: hmacSecret}},
+				RequireExp: tt.requireExp,
+			})
+			if err != nil {
+				t.Fatalf("new verifier: %v", err)
+			}
+			if _, err = verifier.Claim(signHS256(t, hmacSecret, "", tt.claims)); (err != nil) != tt.wantErr {
+				t.Errorf("Claim() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifier_InvalidKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ecdsa key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal ecdsa key: %v", err)
+	}
+	pemFile := writeFile(t, "ec.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	tests := []struct {
+		name string
+		key  config.JWTKey
+	}{
+		{name: "short secret", key: config.JWTKey{Algorithm: "HS256", Secret: "short"}},
+		{name: "secret too short for HS512", key: config.JWTKey{Algorithm: "HS512", Secret: hmacSecret}},
+		{name: "curve mismatch", key: config.JWTKey{Algorithm: "ES384", PublicKeyFile: pemFile}},
+		{name: "key type mismatch", key: config.JWTKey{Algorithm: "RS256", PublicKeyFile: pemFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := auth.NewVerifier(&config.JWT{Claim: "sub", Keys: []config.JWTKey{tt.key}}); err == nil {
+				t.Errorf("NewVerifier() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// supportedAlgorithms are the signature algorithms accepted in the token headers.
+var supportedAlgorithms = []jose.SignatureAlgorithm{
+	jose.HS256, jose.HS384, jose.HS512,
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// algorithms returns the signature algorithms that can be verified with key.
+func algorithms(key any) []jose.SignatureAlgorithm {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512}
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().Name {
+		case "P-256":
+			return []jose.SignatureAlgorithm{jose.ES256}
+		case "P-384":
+			return []jose.SignatureAlgorithm{jose.ES384}
+		case "P-521":
+			return []jose.SignatureAlgorithm{jose.ES512}
+		}
+	case ed25519.PublicKey:
+		return []jose.SignatureAlgorithm{jose.EdDSA}
+	case []byte:
+		// RFC 7518 requires HMAC keys at least as large as the hash output
+		algs := []jose.SignatureAlgorithm{}
+		for alg, size := range map[jose.SignatureAlgorithm]int{jose.HS256: 32, jose.HS384: 48, jose.HS512: 64} {
+			if len(pub) >= size {
+				algs = append(algs, alg)
+			}
+		}
+		return algs
+	}
+	return nil
+}
+
+// checkKey returns an error if key cannot verify any token, or not the algorithm it is restricted to.
+func checkKey(key *jose.JSONWebKey) error {
+	algs := algorithms(key.Key)
+	if len(algs) == 0 {
+		return errors.New("unsupported or too short key")
+	}
+	if key.Algorithm != "" && !slices.Contains(algs, jose.SignatureAlgorithm(key.Algorithm)) {
+		return fmt.Errorf("key cannot be used with %s", key.Algorithm)
+	}
+	return nil
+}
+
+func loadStaticKey(cfg config.JWTKey) (jose.JSONWebKey, error) {
+	k := jose.JSONWebKey{KeyID: cfg.ID, Algorithm: cfg.Algorithm, Use: "sig"}
+	if strings.HasPrefix(cfg.Algorithm, "HS") {
+		k.Key = []byte(cfg.Secret)
+		return k, checkKey(&k)
+	}
+
+	data, err := os.ReadFile(filepath.Clean(cfg.PublicKeyFile))
+	if err != nil {
+		return k, fmt.Errorf("read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return k, fmt.Errorf("no PEM data found in %s", cfg.PublicKeyFile)
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return k, fmt.Errorf("parse certificate: %w", err)
+		}
+		k.Key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		if k.Key, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return k, fmt.Errorf("parse public key: %w", err)
+		}
+	default:
+		if k.Key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return k, fmt.Errorf("parse public key: %w", err)
+		}
+	}
+
+	if err = checkKey(&k); err != nil {
+		return k, fmt.Errorf("public key in %s: %w", cfg.PublicKeyFile, err)
+	}
+	return k, nil
+}
+
+// loadJWKS reads the signature keys of the JSON Web Key Set at path, parsed and validated by go-jose.
+func loadJWKS(path string) ([]jose.JSONWebKey, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+	var set jose.JSONWebKeySet
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make([]jose.JSONWebKey, 0, len(set.Keys))
+	for i := range set.Keys {
+		k := set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if err = checkKey(&k); err != nil {
+			return nil, fmt.Errorf("jwks key %d (%s): %w", i, k.KeyID, err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signature keys found in %s", path)
+	}
+	return keys, nil
+}
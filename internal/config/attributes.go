@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// AttributeClientIP names the client IP address of the incoming request, see RegionRetriever.RequestAttributes.
+const AttributeClientIP = "client_ip"
+
+// RequestAttributes returns the attributes of the incoming request that the region resolved by the retriever
+// depends on, besides the lookup value, named like the template placeholders, e.g. "client_ip" or "header:X-Tier".
+// The cache in front of the retriever keys the regions on their values along with the lookup value.
+func (r *RegionRetriever) RequestAttributes() ([]string, error) {
+	attrs := map[string]struct{}{}
+	if err := r.requestAttributes(attrs); err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(attrs)), nil
+}
+
+func (r *RegionRetriever) requestAttributes(attrs map[string]struct{}) error {
+	if r == nil {
+		return nil
+	}
+	if r.Type == RegionResolverTypeGeoIP {
+		// lookup values that are not IP addresses are resolved from the client IP address
+		attrs[AttributeClientIP] = struct{}{}
+	}
+	if r.Type == RegionResolverTypeHTTP {
+		templateAttributes(r.URL, attrs)
+		for _, value := range r.Headers {
+			templateAttributes(value, attrs)
+		}
+		for _, value := range r.QueryParams {
+			templateAttributes(value, attrs)
+		}
+	}
+	if r.RegionResolver != nil && r.RegionResolver.Type == RegionResolverTypeExpr {
+		if err := expressionAttributes(r.RegionResolver.Expression, attrs); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+	}
+	for _, child := range r.Children {
+		if err := child.requestAttributes(attrs); err != nil {
+			return err
+		}
+	}
+	if r.Snapshot != nil {
+		return r.Snapshot.Fallthrough.requestAttributes(attrs)
+	}
+	return nil
+}
+
+// templateAttributes adds the request attributes expanded in template to attrs.
+func templateAttributes(template string, attrs map[string]struct{}) {
+	for _, match := range TemplatePlaceholders.FindAllStringSubmatch(template, -1) {
+		if match[0] != ParamPlaceholder {
+			attrs[match[1]] = struct{}{}
+		}
+	}
+}
+
+// requestVisitor collects the member accesses of an expression and counts its uses of the req variable.
+type requestVisitor struct {
+	members []*ast.MemberNode
+	uses    int
+}
+
+func (v *requestVisitor) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if n.Value == "req" {
+			v.uses++
+		}
+	case *ast.MemberNode:
+		v.members = append(v.members, n)
+	}
+}
+
+// expressionAttributes adds the request attributes read by expression to attrs.
+// Attributes must be read with constant names, e.g. req.client_ip or req.header["X-Tier"], so that they are
+// known before the expression runs.
+func expressionAttributes(expression string, attrs map[string]struct{}) error {
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	v := &requestVisitor{}
+	ast.Walk(&tree.Node, v)
+
+	reads := 0
+	for _, m := range v.members {
+		if id, ok := m.Node.(*ast.IdentifierNode); !ok || id.Value != "req" {
+			continue
+		}
+		name, ok := m.Property.(*ast.StringNode)
+		if !ok {
+			continue
+		}
+		switch name.Value {
+		case "host", "path", AttributeClientIP:
+			attrs[name.Value] = struct{}{}
+			reads++
+		case "header", "query", "metadata":
+			if key, ok := memberKey(v.members, m); ok {
+				attrs[name.Value+":"+key] = struct{}{}
+				reads++
+			}
+		}
+	}
+	if reads != v.uses {
+		return errors.New("the request attributes read by the expression must be constant, " +
+			"e.g. req.header[\"X-Tier\"], to be cached")
+	}
+	return nil
+}
+
+// memberKey returns the constant key accessed in the map held by parent, e.g. "X-Tier" in req.header["X-Tier"].
+func memberKey(members []*ast.MemberNode, parent *ast.MemberNode) (string, bool) {
+	for _, m := range members {
+		if m.Node != ast.Node(parent) {
+			continue
+		}
+		if key, ok := m.Property.(*ast.StringNode); ok {
+			return key.Value, true
+		}
+		return "", false
+	}
+	return "", false
+}
@@ -1,14 +1,27 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 	"gopkg.in/yaml.v3"
+
+	"github.com/CanobbioE/poly-route/internal/fieldpath"
 )
 
 // Protocol is used to identify which protocol a ProtocolCfg defines.
@@ -26,30 +39,485 @@ const (
 	RegionResolverTypeHTTP = "http"
 	// RegionResolverTypeStatic identifies the static region resolver.
 	RegionResolverTypeStatic = "static"
+	// RegionResolverTypeSQL identifies the SQL database region resolver.
+	RegionResolverTypeSQL = "sql"
+	// RegionResolverTypeGRPC identifies the gRPC region resolver.
+	RegionResolverTypeGRPC = "grpc"
+	// RegionResolverTypeGeoIP identifies the region resolver based on the client IP address.
+	RegionResolverTypeGeoIP = "geoip"
+	// RegionResolverTypeChain identifies the resolver trying its children in order.
+	RegionResolverTypeChain = "chain"
+	// RegionResolverTypeFirstOf identifies the resolver racing its children concurrently.
+	RegionResolverTypeFirstOf = "first-of"
+	// RegionResolverTypeSnapshot identifies the resolver answering from a periodically loaded table.
+	RegionResolverTypeSnapshot = "snapshot"
+	// RegionResolverTypeFile identifies the resolver answering from a table file reloaded when it changes.
+	RegionResolverTypeFile = "file"
+)
+
+// Formats of the snapshot tables.
+const (
+	SnapshotFormatJSON = "json"
+	SnapshotFormatCSV  = "csv"
+	SnapshotFormatYAML = "yaml"
+)
+
+// retrieverTypes lists all the supported RegionRetriever types.
+var retrieverTypes = []string{
+	RegionResolverTypeHTTP,
+	RegionResolverTypeStatic,
+	RegionResolverTypeSQL,
+	RegionResolverTypeGRPC,
+	RegionResolverTypeGeoIP,
+	RegionResolverTypeChain,
+	RegionResolverTypeFirstOf,
+	RegionResolverTypeSnapshot,
+	RegionResolverTypeFile,
+}
+
+// ParamPlaceholder is replaced by the lookup value in the templates of the http retriever, see RegionRetriever.
+const ParamPlaceholder = "{param}"
+
+// TemplatePlaceholders matches the placeholders of the http retriever templates, its first group being the name
+// of the lookup value or of the request attribute replacing them, see RegionRetriever.
+var TemplatePlaceholders = regexp.MustCompile(`\{(param|host|path|client_ip|(?:header|query|metadata):[^{}]+)\}`)
+
+// Types of RegionResolver.
+const (
+	// RegionResolverTypeMap maps the value of RegionResolver.Field to a region using RegionResolver.Mapping.
+	RegionResolverTypeMap = "map"
+	// RegionResolverTypeExpr evaluates RegionResolver.Expression to compute the region.
+	RegionResolverTypeExpr = "expr"
+)
+
+// Types of RegionKeySource, each identifies a different part of the incoming request.
+const (
+	// RegionKeyHeader reads the lookup value from an HTTP header.
+	RegionKeyHeader = "header"
+	// RegionKeyQuery reads the lookup value from a query parameter.
+	RegionKeyQuery = "query"
+	// RegionKeyCookie reads the lookup value from a cookie.
+	RegionKeyCookie = "cookie"
+	// RegionKeyPathSegment reads the lookup value from a segment of the request path.
+	RegionKeyPathSegment = "path_segment"
+	// RegionKeyPathRegex reads the lookup value from a capture group of a regular expression matching the path.
+	RegionKeyPathRegex = "path_regex"
+	// RegionKeySubdomain reads the lookup value from a label of the Host header.
+	RegionKeySubdomain = "subdomain"
+	// RegionKeyMetadata reads the lookup value from gRPC metadata.
+	RegionKeyMetadata = "metadata"
+	// RegionKeyJWT reads the lookup value from the claim of a verified JWT, see JWT.
+	RegionKeyJWT = "jwt"
+	// RegionKeyClientIP uses the client IP address as lookup value, see ServiceCfg.TrustedProxies.
+	RegionKeyClientIP = "client_ip"
+)
+
+// UpstreamPrefix marks a destination address as the name of one of the ProtocolCfg.Upstreams, e.g. "upstream:orders".
+const UpstreamPrefix = "upstream:"
+
+const (
+	// BalanceRoundRobin sends the requests to the endpoints of an upstream in turn, it is the default policy.
+	BalanceRoundRobin = "round_robin"
+	// BalanceLeastOutstanding sends a request to the endpoint with the fewest requests in progress.
+	BalanceLeastOutstanding = "least_outstanding"
+	// BalanceWeighted sends the requests to the endpoints in proportion to their weight.
+	BalanceWeighted = "weighted"
+	// BalanceConsistentHash sends the requests of the same region lookup value to the same endpoint,
+	// only the share of the requests of an added or removed endpoint moves to another one.
+	BalanceConsistentHash = "consistent_hash"
+)
+
+const (
+	// HealthCheckHTTP checks a backend with a GET request, expecting a status code, see HealthCheck.
+	HealthCheckHTTP = "http"
+	// HealthCheckGRPC checks a backend with the Check method of the grpc.health.v1.Health service.
+	HealthCheckGRPC = "grpc"
+	// HealthCheckTCP checks that a TCP connection to a backend can be established.
+	HealthCheckTCP = "tcp"
 )
 
+// RoutePredicateAny is the value of a header, query or metadata predicate only requiring its presence, see Route.
+const RoutePredicateAny = "*"
+
+// DefaultAffinityCookie is the name of the region affinity cookie, see Affinity.
+const DefaultAffinityCookie = "poly_route_region"
+
 // ProtocolCfg configures the incoming and outgoing proxy requests for a Protocol.
 type ProtocolCfg struct {
 	Destinations map[string]map[string]string `yaml:"destinations"`
-	Listen       string                       `yaml:"listen"`
+	// Hosts groups destinations by the Host header of the incoming requests, e.g. "api.example.com",
+	// or "*.example.com" for any of its subdomains. Requests of other hosts are routed with Destinations.
+	Hosts    map[string]map[string]map[string]string `yaml:"hosts"`
+	Affinity *Affinity                               `yaml:"affinity"`
+	Listen   string                                  `yaml:"listen"`
+	// Upstreams are the groups of endpoints referenced by the destination addresses starting with UpstreamPrefix.
+	Upstreams map[string]Upstream `yaml:"upstreams"`
+	// HealthCheck checks the backends of the protocol, unless their upstream defines its own.
+	HealthCheck *HealthCheck `yaml:"health_check"`
+	// Failover configures the regions tried when the backend of the resolved region is unavailable.
+	Failover *Failover `yaml:"failover"`
+	// Routes restricts destinations to the requests matching predicates, see Route.
+	Routes     []Route           `yaml:"routes"`
+	RegionKeys []RegionKeySource `yaml:"region_keys"`
+}
+
+// Upstream is a group of equivalent backends, load balanced by Policy.
+type Upstream struct {
+	// HealthCheck checks the endpoints, replacing the one of the protocol.
+	HealthCheck *HealthCheck `yaml:"health_check"`
+	// Policy is one of BalanceRoundRobin, the default, BalanceLeastOutstanding, BalanceWeighted
+	// and BalanceConsistentHash.
+	Policy    string     `yaml:"policy"`
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// Failover maps a region to the regions tried in order when its backend for a route is unhealthy,
+// or refuses the connection, e.g. "euw1" to ["euw2", "use1"].
+type Failover struct {
+	// Regions are the failover regions of every route.
+	Regions map[string][]string `yaml:"regions"`
+	// Routes overrides Regions for some destination keys, in every host group.
+	Routes map[string]RouteFailover `yaml:"routes"`
+}
+
+// RouteFailover configures the failover of the routes of a destination key, see Failover.
+type RouteFailover struct {
+	// Regions replaces the failover regions of the protocol.
+	Regions map[string][]string `yaml:"regions"`
+	// DataResidency forbids failing over, e.g. for the routes holding regulated data.
+	DataResidency bool `yaml:"data_residency"`
+}
+
+// HealthCheck periodically checks the backends, the unhealthy ones are taken out of rotation.
+// A backend becomes unhealthy after Fall consecutive failed checks, and healthy again after Rise successful ones.
+type HealthCheck struct {
+	// Type is one of HealthCheckHTTP, for http and graphql, HealthCheckGRPC, for grpc, and HealthCheckTCP.
+	Type string `yaml:"type"`
+	// Path is the path of the HTTP check on the host of the backend, by default "/".
+	Path string `yaml:"path"`
+	// Service is the service of the gRPC check, by default the whole server.
+	Service string `yaml:"service"`
+	// Interval is the time between two checks, by default 10s.
+	Interval string `yaml:"interval"`
+	// Timeout bounds each check, by default 2s.
+	Timeout string `yaml:"timeout"`
+	// Status is the status code expected by the HTTP check, by default 200.
+	Status int `yaml:"status"`
+	// Rise is the number of successful checks marking a backend healthy, by default 2.
+	Rise int `yaml:"rise"`
+	// Fall is the number of failed checks marking a backend unhealthy, by default 3.
+	Fall int `yaml:"fall"`
+}
+
+// Endpoint is a backend of an Upstream.
+type Endpoint struct {
+	// Address has the format of the destination addresses of the protocol, without parameters.
+	Address string `yaml:"address"`
+	// Weight is the share of the requests of the endpoint relative to the other ones, 1 by default.
+	// It is used by the weighted and consistent_hash policies.
+	Weight int `yaml:"weight"`
+}
+
+// Route forwards the requests matching its path and all of its predicates.
+// Once the path of a request selected a destination key, the routes of that key are tried in order,
+// then the Destinations of the key if any.
+// Headers and Query are only supported by http and graphql, Metadata by grpc.
+type Route struct {
+	// Destinations maps the regions to the backend addresses, like the values of ProtocolCfg.Destinations.
+	Destinations map[string]string `yaml:"destinations"`
+	// Headers maps the names of the required headers to one of their values, or to RoutePredicateAny.
+	Headers map[string]string `yaml:"headers"`
+	// Query maps the names of the required query parameters to one of their values, or to RoutePredicateAny.
+	Query map[string]string `yaml:"query"`
+	// Metadata maps the required gRPC metadata keys to one of their values, or to RoutePredicateAny.
+	Metadata map[string]string `yaml:"metadata"`
+	// Path is a destination key, e.g. "/orders" or "/users/{id}/*", see ProtocolCfg.Destinations.
+	Path string `yaml:"path"`
+	// Host is the host group of the route, see ProtocolCfg.Hosts, empty for the top level destinations.
+	Host string `yaml:"host"`
+	// Methods are the HTTP methods of the route, e.g. "POST", any method if empty.
+	Methods []string `yaml:"methods"`
+}
+
+// Affinity pins the region of a client with a signed cookie, set after the first resolution of its lookup value.
+// Requests carrying a valid cookie for the same lookup value skip the region retriever until it expires.
+type Affinity struct {
+	// Secret is the HMAC key signing the cookie.
+	Secret *Secret `yaml:"secret"`
+	// Cookie is the name of the cookie, by default DefaultAffinityCookie.
+	Cookie string `yaml:"cookie"`
+	// TTL is how long the region stays pinned, by default one hour.
+	TTL string `yaml:"ttl"`
+	// Secure restricts the cookie to HTTPS requests.
+	Secure bool `yaml:"secure"`
+}
+
+// RegionKeySource configures where the region lookup value is read from in the incoming requests.
+// Sources are tried in order, the first non-empty value wins.
+type RegionKeySource struct {
+	Type    string `yaml:"type"`
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	Group   string `yaml:"group"`
+	Index   int    `yaml:"index"`
 }
 
 // RegionRetriever configures how and from where the region value should be retrieved.
+// The path of the http retriever URL can contain the ParamPlaceholder, replaced by the escaped lookup value.
+// Values of Headers and QueryParams can contain it too, along with placeholders for the attributes
+// of the incoming request: {header:Name}, {query:name}, {metadata:key}, {host}, {path} and {client_ip}.
 type RegionRetriever struct {
-	RegionResolver *RegionResolver `yaml:"region_resolver"`
-	Type           string          `yaml:"type"`
-	URL            string          `yaml:"url"`
-	Method         string          `yaml:"method"`
-	QueryParam     string          `yaml:"query_param"`
-	Static         string          `yaml:"static"`
-	Timeout        string          `yaml:"timeout"`
+	Headers        map[string]string  `yaml:"headers"`
+	QueryParams    map[string]string  `yaml:"query_params"`
+	RegionResolver *RegionResolver    `yaml:"region_resolver"`
+	Cache          *RegionCache       `yaml:"cache"`
+	Retry          *RetryPolicy       `yaml:"retry"`
+	CircuitBreaker *CircuitBreaker    `yaml:"circuit_breaker"`
+	Auth           *RetrieverAuth     `yaml:"auth"`
+	TLS            *RetrieverTLS      `yaml:"tls"`
+	SQL            *SQLRetriever      `yaml:"sql"`
+	GRPC           *GRPCRetriever     `yaml:"grpc"`
+	GeoIP          *GeoIPRetriever    `yaml:"geoip"`
+	Snapshot       *SnapshotRetriever `yaml:"snapshot"`
+	File           *FileRetriever     `yaml:"file"`
+	Type           string             `yaml:"type"`
+	URL            string             `yaml:"url"`
+	Method         string             `yaml:"method"`
+	QueryParam     string             `yaml:"query_param"`
+	BodyTemplate   string             `yaml:"body_template"`
+	BodyParam      string             `yaml:"body_param"`
+	ContentType    string             `yaml:"content_type"`
+	Static         string             `yaml:"static"`
+	Timeout        string             `yaml:"timeout"`
+	Deadline       string             `yaml:"deadline"`
+	Children       []*RegionRetriever `yaml:"children"`
+}
+
+// RegionCache configures the in-memory cache placed in front of a RegionRetriever.
+type RegionCache struct {
+	TTL         string `yaml:"ttl"`
+	NegativeTTL string `yaml:"negative_ttl"`
+	// StaleTTL is how long a region is still served once its TTL expired, while it is refreshed in the background.
+	StaleTTL   string `yaml:"stale_ttl"`
+	MaxEntries int    `yaml:"max_entries"`
+}
+
+// Algorithms used to sign the requests to the region retriever, see HMACAuth.
+const (
+	HMACSHA256 = "sha256"
+	HMACSHA512 = "sha512"
+)
+
+// RetrieverAuth configures the credentials sent to an http RegionRetriever, only one method can be defined.
+type RetrieverAuth struct {
+	// Bearer is sent in the Authorization header as a bearer token.
+	Bearer *Secret    `yaml:"bearer"`
+	Basic  *BasicAuth `yaml:"basic"`
+	HMAC   *HMACAuth  `yaml:"hmac"`
+}
+
+// Secret is read either from a file or from an environment variable when the retriever is created.
+type Secret struct {
+	File string `yaml:"file"`
+	Env  string `yaml:"env"`
+}
+
+// BasicAuth configures HTTP basic authentication.
+type BasicAuth struct {
+	Password *Secret `yaml:"password"`
+	Username string  `yaml:"username"`
+}
+
+// HMACAuth configures the signature of the requests with a shared secret.
+// The signature is computed over the method, the request URI, the timestamp and the body of the request,
+// each followed by a new line, and sent hex encoded in Header along with the timestamp.
+type HMACAuth struct {
+	Secret *Secret `yaml:"secret"`
+	// Header defaults to X-Poly-Route-Signature.
+	Header string `yaml:"header"`
+	// Algorithm is one of HMACSHA256 (default) or HMACSHA512.
+	Algorithm string `yaml:"algorithm"`
+}
+
+// RetrieverTLS configures the TLS connections to an http RegionRetriever.
+type RetrieverTLS struct {
+	// CAFile is a PEM encoded bundle of the certificate authorities trusted in place of the system ones.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM encoded client certificate and key used for mutual TLS.
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+// RetryPolicy configures how failed calls to a RegionRetriever are retried.
+// Only transient failures are retried, e.g. 5xx responses, timeouts and refused connections.
+type RetryPolicy struct {
+	// InitialBackoff is the maximum wait before the first retry, it doubles at every attempt up to MaxBackoff.
+	// The actual wait is randomly picked between zero and the maximum.
+	InitialBackoff string `yaml:"initial_backoff"`
+	MaxBackoff     string `yaml:"max_backoff"`
+	// MaxAttempts is the number of calls, including the first one.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// CircuitBreaker configures a circuit breaker that fails fast when a RegionRetriever is down.
+// The circuit opens after FailureThreshold consecutive transient failures, after OpenTimeout
+// a single call is let through to probe the retriever and closes the circuit if it succeeds.
+type CircuitBreaker struct {
+	OpenTimeout      string `yaml:"open_timeout"`
+	FailureThreshold int    `yaml:"failure_threshold"`
+}
+
+// SQLRetriever configures a region lookup performed directly against a database.
+// Query must accept the lookup value as its only argument, using the placeholder syntax of Driver.
+type SQLRetriever struct {
+	Driver          string `yaml:"driver"`
+	DSN             string `yaml:"dsn"`
+	Query           string `yaml:"query"`
+	Column          string `yaml:"column"`
+	QueryTimeout    string `yaml:"query_timeout"`
+	ConnMaxLifetime string `yaml:"conn_max_lifetime"`
+	// MaxOpenConns and MaxIdleConns limit the connections to the database,
+	// when unset they default to unlimited open connections and 2 idle ones.
+	MaxOpenConns int `yaml:"max_open_conns"`
+	MaxIdleConns int `yaml:"max_idle_conns"`
+}
+
+// GRPCRetriever configures a region lookup performed by calling a unary gRPC method.
+// Without DescriptorSet, the service at Address must implement the well-known polyroute.v1.RegionService
+// shipped with poly-route.
+type GRPCRetriever struct {
+	// Address is the target of the gRPC service (e.g. users:9090).
+	Address string `yaml:"address"`
+	// Method is the full name of the method to call (e.g. /users.v1.UserDirectory/GetUser).
+	Method string `yaml:"method"`
+	// DescriptorSet is the path of a FileDescriptorSet, including imports, that describes Method.
+	DescriptorSet string `yaml:"descriptor_set"`
+	// RequestField is the dot notation path of the request field set to the lookup value.
+	RequestField string `yaml:"request_field"`
+}
+
+// GeoIPRetriever configures a region lookup based on the client IP address.
+// CIDRs maps networks directly to regions and takes precedence over Database,
+// a MaxMind DB file whose records are mapped to regions by the RegionResolver.
+type GeoIPRetriever struct {
+	CIDRs    map[string]string `yaml:"cidrs"`
+	Database string            `yaml:"database"`
+}
+
+// SnapshotRetriever configures a table of lookup values to region values, loaded in memory from either
+// URL or File and reloaded every Interval. The table is either a JSON object, a JSON array of objects
+// or a CSV file with a header row (or the YAML equivalent of the JSON tables): arrays and CSV files hold
+// the lookup value in KeyColumn and the region value in RegionColumn.
+type SnapshotRetriever struct {
+	// Fallthrough resolves the lookup values missing from the table.
+	Fallthrough *RegionRetriever `yaml:"fallthrough"`
+	URL         string           `yaml:"url"`
+	File        string           `yaml:"file"`
+	// Format is one of SnapshotFormatJSON, SnapshotFormatCSV or SnapshotFormatYAML,
+	// by default it is guessed from the extension.
+	Format       string `yaml:"format"`
+	KeyColumn    string `yaml:"key_column"`
+	RegionColumn string `yaml:"region_column"`
+	Interval     string `yaml:"interval"`
+}
+
+// FileRetriever configures a table of lookup values to region values read from Path, which is watched and
+// reloaded whenever it changes. The table has the same formats as the SnapshotRetriever ones.
+type FileRetriever struct {
+	Path         string `yaml:"path"`
+	Format       string `yaml:"format"`
+	KeyColumn    string `yaml:"key_column"`
+	RegionColumn string `yaml:"region_column"`
 }
 
 // RegionResolver configures how to resolve the region value retrieved from the RegionRetriever.
 type RegionResolver struct {
-	Mapping map[string]string `yaml:"mapping"`
-	Type    string            `yaml:"type"`
-	Field   string            `yaml:"field"`
+	// Mapping maps the retrieved values to regions, its keys are matched in the following order:
+	//   - exact keys, e.g. "europe-west1";
+	//   - prefix keys, glob keys ending with a single "*", the longest matching prefix winning, e.g. "glob:eu-west1-*";
+	//   - glob keys starting with MappingGlobPrefix, e.g. "glob:europe-west?-[ab]", and regular expressions starting
+	//     with MappingRegexPrefix, e.g. "regex:^europe-west\d+-[a-z]$", in declaration order.
+	Mapping  map[string]string `yaml:"mapping"`
+	OnError  *ErrorPolicy      `yaml:"on_error"`
+	Fallback *RegionRetriever  `yaml:"fallback"`
+	// program is Expression once compiled, see Compile.
+	program *vm.Program
+	// mapping is Mapping once compiled, see Compile.
+	mapping    *mapping
+	Type       string `yaml:"type"`
+	Field      string `yaml:"field"`
+	Expression string `yaml:"expression"`
+	Default    string `yaml:"default"`
+	// mappingOrder holds the keys of Mapping in declaration order, see UnmarshalYAML.
+	mappingOrder []string
+}
+
+// Policies applied when a region cannot be resolved.
+const (
+	// ErrorPolicyReject rejects the incoming request.
+	ErrorPolicyReject = "reject"
+	// ErrorPolicyDefault routes the incoming request to RegionResolver.Default.
+	ErrorPolicyDefault = "default"
+	// ErrorPolicyFallback resolves the region using RegionResolver.Fallback.
+	ErrorPolicyFallback = "fallback"
+)
+
+// ErrorPolicy configures the policy applied for each kind of resolution error.
+// An empty policy means ErrorPolicyDefault when RegionResolver.Default is set, ErrorPolicyReject otherwise.
+type ErrorPolicy struct {
+	// Retriever applies when the region value could not be retrieved (e.g. the retriever is unreachable).
+	Retriever string `yaml:"retriever"`
+	// Unmapped applies when the retrieved value has no entry in RegionResolver.Mapping.
+	Unmapped string `yaml:"unmapped"`
+}
+
+// JWT configures how the region lookup value is extracted from a verified JSON Web Token
+// sent in the Authorization header of the incoming requests.
+type JWT struct {
+	Claim    string   `yaml:"claim"`
+	JWKSFile string   `yaml:"jwks_file"`
+	Issuer   string   `yaml:"issuer"`
+	Audience string   `yaml:"audience"`
+	Leeway   string   `yaml:"leeway"`
+	Keys     []JWTKey `yaml:"keys"`
+	Required bool     `yaml:"required"`
+	// RequireExp rejects the tokens without an expiration time, by default they never expire.
+	RequireExp bool `yaml:"require_exp"`
+}
+
+// JWTKey is a static key used to verify JWT signatures.
+// HMAC algorithms require Secret, all the others require a PEM encoded PublicKeyFile.
+type JWTKey struct {
+	ID            string `yaml:"id"`
+	Algorithm     string `yaml:"algorithm"`
+	Secret        string `yaml:"secret"`
+	PublicKeyFile string `yaml:"public_key_file"`
+}
+
+// Modes of a Migration.
+const (
+	// MigrationShadow routes to Migration.From and mirrors the requests to Migration.To, discarding the responses.
+	MigrationShadow = "shadow"
+	// MigrationDual routes to Migration.To and mirrors the requests to Migration.From, discarding the responses,
+	// so that the old region stays up to date until the migration is complete.
+	MigrationDual = "dual"
+	// MigrationCutover routes to Migration.To only.
+	MigrationCutover = "cutover"
+)
+
+// Migration moves the lookup value Key from the region From to the region To.
+// It overrides the region resolved for Key according to Mode.
+type Migration struct {
+	Key  string `yaml:"key"`
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	Mode string `yaml:"mode"`
+}
+
+// AdminCfg configures the administration server, which serves the status of the region resolvers on /status.
+type AdminCfg struct {
+	Listen string `yaml:"listen"`
 }
 
 // ServiceCfg is the whole service configuration.
@@ -58,6 +526,12 @@ type ServiceCfg struct {
 	GRPC            *ProtocolCfg     `yaml:"grpc"`
 	GraphQL         *ProtocolCfg     `yaml:"graphql"`
 	RegionRetriever *RegionRetriever `yaml:"region_retriever"`
+	JWT             *JWT             `yaml:"jwt"`
+	Admin           *AdminCfg        `yaml:"admin"`
+	// TrustedProxies lists the IP addresses or CIDR networks of the proxies allowed to report
+	// the client IP address with the X-Forwarded-For header.
+	TrustedProxies []string    `yaml:"trusted_proxies"`
+	Migrations     []Migration `yaml:"migrations"`
 }
 
 // Load the ServiceCfg from the given file path and validates it before returning.
@@ -87,14 +561,52 @@ func (c *ServiceCfg) Validate() error {
 		return fmt.Errorf("region_retriever: %w", err)
 	}
 
+	if err := c.JWT.validate(); err != nil {
+		return fmt.Errorf("jwt: %w", err)
+	}
+
+	if c.Admin != nil && c.Admin.Listen == "" {
+		return errors.New("admin: listen must be defined")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if err := validateNetwork(proxy); err != nil {
+			return fmt.Errorf("trusted_proxies: %w", err)
+		}
+	}
+
+	migrated := make(map[string]bool, len(c.Migrations))
+	for i, m := range c.Migrations {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("migrations[%d]: %w", i, err)
+		}
+		if migrated[m.Key] {
+			return errors.New("migrations: key \"" + m.Key + "\" is migrated more than once")
+		}
+		migrated[m.Key] = true
+	}
+
 	if err := c.HTTP.validate(ProtocolHTTP); err != nil {
 		return err
 	}
 	if err := c.GraphQL.validate(ProtocolGraphQL); err != nil {
 		return err
 	}
+	if err := c.GRPC.validate(ProtocolGRPC); err != nil {
+		return err
+	}
 
-	return c.GRPC.validate(ProtocolGRPC)
+	for p, cfg := range map[Protocol]*ProtocolCfg{ProtocolHTTP: c.HTTP, ProtocolGraphQL: c.GraphQL, ProtocolGRPC: c.GRPC} {
+		if cfg == nil || c.JWT != nil {
+			continue
+		}
+		for _, k := range cfg.RegionKeys {
+			if k.Type == RegionKeyJWT {
+				return errors.New(string(p) + ": region_keys: jwt must be configured to use a \"jwt\" source")
+			}
+		}
+	}
+	return nil
 }
 
 func (r *RegionRetriever) validate() error {
@@ -107,42 +619,680 @@ func (r *RegionRetriever) validate() error {
 		if r.URL == "" {
 			return errors.New("url is required for \"" + RegionResolverTypeHTTP + "\" retriever")
 		}
-		if _, err := url.ParseRequestURI(r.URL); err != nil {
+		u, err := url.ParseRequestURI(r.URL)
+		if err != nil {
 			return fmt.Errorf("url %q is not a valid URL: %w", r.URL, err)
 		}
-		if r.Method == "" {
-			return errors.New("method is required for http retriever")
+		if strings.Contains(u.Host, ParamPlaceholder) || strings.Contains(u.RawQuery, ParamPlaceholder) {
+			return errors.New("url: " + ParamPlaceholder + " is only supported in the path, use query_params instead")
 		}
-		if r.QueryParam == "" {
-			return errors.New("query_param is required for http retriever")
+		if err := r.validateRequest(); err != nil {
+			return err
 		}
-		if err := r.RegionResolver.validate(); err != nil {
+		if err := r.RegionResolver.validate(r.Type); err != nil {
 			return fmt.Errorf("region_resolver: %w", err)
 		}
 	case RegionResolverTypeStatic:
 		if r.Static == "" {
 			return errors.New("static value must be defined when type is \"" + RegionResolverTypeStatic + "\"")
 		}
+	case RegionResolverTypeSQL:
+		if err := r.SQL.validate(); err != nil {
+			return fmt.Errorf("sql: %w", err)
+		}
+		if err := r.RegionResolver.validate(r.Type); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+	case RegionResolverTypeGRPC:
+		if err := r.GRPC.validate(); err != nil {
+			return fmt.Errorf("grpc: %w", err)
+		}
+		if err := r.RegionResolver.validate(r.Type); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+		// the response of the well-known method only carries the region
+		if r.GRPC.DescriptorSet != "" && r.RegionResolver.Type == RegionResolverTypeMap && r.RegionResolver.Field == "" {
+			return errors.New("region_resolver: field must be defined when grpc.descriptor_set is defined")
+		}
+	case RegionResolverTypeGeoIP:
+		if err := r.validateGeoIP(); err != nil {
+			return err
+		}
+	case RegionResolverTypeChain, RegionResolverTypeFirstOf:
+		if err := r.validateChildren(); err != nil {
+			return err
+		}
+	case RegionResolverTypeSnapshot:
+		if err := r.Snapshot.validate(); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+		if err := r.validateTableResolver(); err != nil {
+			return err
+		}
+	case RegionResolverTypeFile:
+		if err := r.File.validate(); err != nil {
+			return fmt.Errorf("file: %w", err)
+		}
+		if err := r.validateTableResolver(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown type \"" + r.Type + "\", must be one of \"" +
+			strings.Join(retrieverTypes, "\", \"") + "\"")
+	}
+
+	if err := r.Cache.validate(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	if r.Cache != nil {
+		if _, err := r.RequestAttributes(); err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+	}
+	if err := r.validateResilience(); err != nil {
+		return err
+	}
+	if (r.Auth != nil || r.TLS != nil) && r.Type != RegionResolverTypeHTTP {
+		return errors.New("auth and tls are only supported by \"" + RegionResolverTypeHTTP + "\" retrievers")
+	}
+	if err := r.Auth.validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if err := r.TLS.validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
+	return nil
+}
+
+// validateResilience checks the retry policy and the circuit breaker, which only apply to remote retrievers.
+func (r *RegionRetriever) validateResilience() error {
+	if r.Retry == nil && r.CircuitBreaker == nil {
+		return nil
+	}
+	switch r.Type {
+	case RegionResolverTypeHTTP, RegionResolverTypeSQL, RegionResolverTypeGRPC:
+	default:
+		return errors.New("retry and circuit_breaker are only supported by \"" + RegionResolverTypeHTTP + "\", \"" +
+			RegionResolverTypeSQL + "\" and \"" + RegionResolverTypeGRPC + "\" retrievers")
+	}
+	if err := r.Retry.validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+	if err := r.CircuitBreaker.validate(); err != nil {
+		return fmt.Errorf("circuit_breaker: %w", err)
+	}
+	return nil
+}
+
+// validateTableResolver checks the region_resolver of the snapshot and file retrievers.
+// The values of their tables are regions, unless a map resolver translates them.
+func (r *RegionRetriever) validateTableResolver() error {
+	if r.RegionResolver == nil {
+		return nil
+	}
+	if r.RegionResolver.Type == "" {
+		if err := r.RegionResolver.validatePolicies(); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+		return nil
+	}
+	if r.RegionResolver.Type != RegionResolverTypeMap {
+		return errors.New("region_resolver: type must be \"" + RegionResolverTypeMap + "\" for " + r.Type + " retrievers")
+	}
+	if err := r.RegionResolver.validate(r.Type); err != nil {
+		return fmt.Errorf("region_resolver: %w", err)
+	}
+	return nil
+}
+
+// validateGeoIP checks the options of a geoip retriever.
+// The region_resolver is only required to map the records of the database.
+func (r *RegionRetriever) validateGeoIP() error {
+	if r.GeoIP == nil {
+		return errors.New("geoip must be defined when type is \"" + RegionResolverTypeGeoIP + "\"")
+	}
+	if r.GeoIP.Database == "" && len(r.GeoIP.CIDRs) == 0 {
+		return errors.New("geoip: at least one of database and cidrs must be defined")
+	}
+	for network, region := range r.GeoIP.CIDRs {
+		if err := validateNetwork(network); err != nil {
+			return fmt.Errorf("geoip: cidrs: %w", err)
+		}
+		if region == "" {
+			return errors.New("geoip: cidrs: region of \"" + network + "\" must not be empty")
+		}
+	}
+
+	if r.GeoIP.Database != "" {
+		if err := r.RegionResolver.validate(r.Type); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+		return nil
+	}
+	if r.RegionResolver != nil {
+		if err := r.RegionResolver.validatePolicies(); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *Migration) validate() error {
+	if m.Key == "" {
+		return errors.New("key must be defined")
+	}
+	if m.From == "" || m.To == "" {
+		return errors.New("from and to must be defined")
+	}
+	if m.From == m.To {
+		return errors.New("from and to must be different regions")
+	}
+	switch m.Mode {
+	case MigrationShadow, MigrationDual, MigrationCutover:
+		return nil
+	default:
+		return errors.New("unknown mode \"" + m.Mode + "\", must be one of \"" +
+			MigrationShadow + "\", \"" + MigrationDual + "\", \"" + MigrationCutover + "\"")
+	}
+}
+
+// validateNetwork checks that s is either an IP address or a CIDR network.
+func validateNetwork(s string) error {
+	if strings.Contains(s, "/") {
+		if _, err := netip.ParsePrefix(s); err != nil {
+			return fmt.Errorf("%q is not a valid CIDR network: %w", s, err)
+		}
+		return nil
+	}
+	if _, err := netip.ParseAddr(s); err != nil {
+		return fmt.Errorf("%q is not a valid IP address: %w", s, err)
+	}
+	return nil
+}
+
+// validateChildren checks the options of the retrievers composed of other retrievers.
+// Their region_resolver is optional and only used for its error policies.
+func (r *RegionRetriever) validateChildren() error {
+	if len(r.Children) == 0 {
+		return errors.New("children must have at least one entry when type is \"" + r.Type + "\"")
+	}
+	for i, child := range r.Children {
+		if err := child.validate(); err != nil {
+			return fmt.Errorf("children[%d]: %w", i, err)
+		}
+	}
+	if r.Deadline != "" {
+		if r.Type != RegionResolverTypeFirstOf {
+			return errors.New("deadline is only supported when type is \"" + RegionResolverTypeFirstOf + "\"")
+		}
+		if _, err := time.ParseDuration(r.Deadline); err != nil {
+			return fmt.Errorf("deadline %q is not a valid duration: %w", r.Deadline, err)
+		}
+	}
+	if r.RegionResolver != nil {
+		if err := r.RegionResolver.validatePolicies(); err != nil {
+			return fmt.Errorf("region_resolver: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateRequest checks the method specific options of an http retriever.
+func (r *RegionRetriever) validateRequest() error {
+	switch r.Method {
+	case "":
+		return errors.New("method is required for http retriever")
+	case http.MethodGet:
+		if r.QueryParam == "" && !r.hasParamPlaceholder() {
+			return errors.New("query_param is required for http retriever using " + http.MethodGet +
+				", unless url or query_params contain " + ParamPlaceholder)
+		}
+	case http.MethodPost, http.MethodPut:
+		if r.BodyParam == "" {
+			return errors.New("body_param is required for http retriever using " + r.Method)
+		}
+		body := map[string]any{}
+		if r.BodyTemplate != "" {
+			if err := json.Unmarshal([]byte(r.BodyTemplate), &body); err != nil {
+				return fmt.Errorf("body_template must be a JSON object: %w", err)
+			}
+		}
+		if err := fieldpath.Set(body, r.BodyParam, ""); err != nil {
+			return fmt.Errorf("body_param %q: %w", r.BodyParam, err)
+		}
 	default:
-		return errors.New("unknown type \"" + r.Type + "\", must be \"" + RegionResolverTypeHTTP +
-			"\" or \"" + RegionResolverTypeStatic + "\"")
+		return errors.New("unsupported method \"" + r.Method + "\", must be one of " +
+			http.MethodGet + ", " + http.MethodPost + ", " + http.MethodPut)
 	}
 
+	for name := range r.Headers {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("headers must not contain an empty name")
+		}
+	}
+	for name := range r.QueryParams {
+		if name == "" || name == r.QueryParam {
+			return errors.New("query_params must not contain an empty name or query_param")
+		}
+	}
 	return nil
 }
 
-func (r *RegionResolver) validate() error {
+// hasParamPlaceholder reports whether the lookup value is sent by the url or the query_params templates.
+func (r *RegionRetriever) hasParamPlaceholder() bool {
+	if strings.Contains(r.URL, ParamPlaceholder) {
+		return true
+	}
+	for _, v := range r.QueryParams {
+		if strings.Contains(v, ParamPlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *JWT) validate() error {
+	if j == nil {
+		return nil
+	}
+	if j.Claim == "" {
+		return errors.New("claim must be defined")
+	}
+	if j.JWKSFile == "" && len(j.Keys) == 0 {
+		return errors.New("at least one of jwks_file or keys must be defined")
+	}
+	if j.Leeway != "" {
+		if _, err := time.ParseDuration(j.Leeway); err != nil {
+			return fmt.Errorf("leeway %q is not a valid duration: %w", j.Leeway, err)
+		}
+	}
+
+	for i, k := range j.Keys {
+		switch k.Algorithm {
+		case "HS256", "HS384", "HS512":
+			// RFC 7518 requires HMAC keys at least as large as the hash output
+			if size, _ := strconv.Atoi(k.Algorithm[2:]); len(k.Secret)*8 < size {
+				return fmt.Errorf("keys[%d]: secret must be at least %d bytes for algorithm %s", i, size/8, k.Algorithm)
+			}
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA":
+			if k.PublicKeyFile == "" {
+				return fmt.Errorf("keys[%d]: public_key_file is required for algorithm %s", i, k.Algorithm)
+			}
+		default:
+			return fmt.Errorf("keys[%d]: unsupported algorithm %q", i, k.Algorithm)
+		}
+	}
+	return nil
+}
+
+func (c *RegionCache) validate() error {
+	if c == nil {
+		return nil
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return fmt.Errorf("ttl %q is not a valid duration: %w", c.TTL, err)
+	}
+	if ttl <= 0 {
+		return errors.New("ttl must be greater than zero")
+	}
+	if c.NegativeTTL != "" {
+		negativeTTL, err := time.ParseDuration(c.NegativeTTL)
+		if err != nil {
+			return fmt.Errorf("negative_ttl %q is not a valid duration: %w", c.NegativeTTL, err)
+		}
+		if negativeTTL < 0 {
+			return errors.New("negative_ttl must not be negative")
+		}
+	}
+	if c.StaleTTL != "" {
+		staleTTL, err := time.ParseDuration(c.StaleTTL)
+		if err != nil {
+			return fmt.Errorf("stale_ttl %q is not a valid duration: %w", c.StaleTTL, err)
+		}
+		if staleTTL < 0 {
+			return errors.New("stale_ttl must not be negative")
+		}
+	}
+	if c.MaxEntries < 0 {
+		return errors.New("max_entries must not be negative")
+	}
+	return nil
+}
+
+func (a *RetrieverAuth) validate() error {
+	if a == nil {
+		return nil
+	}
+
+	methods := 0
+	for _, defined := range []bool{a.Bearer != nil, a.Basic != nil, a.HMAC != nil} {
+		if defined {
+			methods++
+		}
+	}
+	if methods != 1 {
+		return errors.New("exactly one of bearer, basic or hmac must be defined")
+	}
+
+	switch {
+	case a.Bearer != nil:
+		if err := a.Bearer.validate(); err != nil {
+			return fmt.Errorf("bearer: %w", err)
+		}
+	case a.Basic != nil:
+		if a.Basic.Username == "" {
+			return errors.New("basic: username must be defined")
+		}
+		if err := a.Basic.Password.validate(); err != nil {
+			return fmt.Errorf("basic: password: %w", err)
+		}
+	default:
+		if err := a.HMAC.Secret.validate(); err != nil {
+			return fmt.Errorf("hmac: secret: %w", err)
+		}
+		switch a.HMAC.Algorithm {
+		case "", HMACSHA256, HMACSHA512:
+		default:
+			return errors.New("hmac: unknown algorithm \"" + a.HMAC.Algorithm + "\", must be one of \"" +
+				HMACSHA256 + "\", \"" + HMACSHA512 + "\"")
+		}
+	}
+	return nil
+}
+
+func (a *Affinity) validate() error {
+	if a == nil {
+		return nil
+	}
+	if err := a.Secret.validate(); err != nil {
+		return fmt.Errorf("secret: %w", err)
+	}
+	if a.TTL != "" {
+		ttl, err := time.ParseDuration(a.TTL)
+		if err != nil {
+			return fmt.Errorf("ttl %q is not a valid duration: %w", a.TTL, err)
+		}
+		if ttl <= 0 {
+			return errors.New("ttl must be greater than zero")
+		}
+	}
+	return nil
+}
+
+func (s *Secret) validate() error {
+	if s == nil {
+		return errors.New("must be defined")
+	}
+	if (s.File == "") == (s.Env == "") {
+		return errors.New("exactly one of file or env must be defined")
+	}
+	return nil
+}
+
+func (t *RetrieverTLS) validate() error {
+	if t == nil {
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("cert_file and key_file must be defined together")
+	}
+	return nil
+}
+
+func (p *RetryPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxAttempts < 1 {
+		return errors.New("max_attempts must be greater than zero")
+	}
+	backoffs := make(map[string]time.Duration, 2)
+	for name, d := range map[string]string{"initial_backoff": p.InitialBackoff, "max_backoff": p.MaxBackoff} {
+		if d == "" {
+			continue
+		}
+		backoff, err := time.ParseDuration(d)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a valid duration: %w", name, d, err)
+		}
+		if backoff <= 0 {
+			return errors.New(name + " must be greater than zero")
+		}
+		backoffs[name] = backoff
+	}
+	if maxBackoff, ok := backoffs["max_backoff"]; ok && backoffs["initial_backoff"] > maxBackoff {
+		return errors.New("initial_backoff must not be greater than max_backoff")
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) validate() error {
+	if b == nil {
+		return nil
+	}
+	if b.FailureThreshold < 0 {
+		return errors.New("failure_threshold must not be negative")
+	}
+	if b.OpenTimeout != "" {
+		timeout, err := time.ParseDuration(b.OpenTimeout)
+		if err != nil {
+			return fmt.Errorf("open_timeout %q is not a valid duration: %w", b.OpenTimeout, err)
+		}
+		if timeout <= 0 {
+			return errors.New("open_timeout must be greater than zero")
+		}
+	}
+	return nil
+}
+
+func (s *SnapshotRetriever) validate() error {
+	if s == nil {
+		return errors.New("snapshot must be defined when type is \"" + RegionResolverTypeSnapshot + "\"")
+	}
+	if (s.URL == "") == (s.File == "") {
+		return errors.New("exactly one of url or file must be defined")
+	}
+	if s.URL != "" {
+		if _, err := url.ParseRequestURI(s.URL); err != nil {
+			return fmt.Errorf("url %q is not a valid URL: %w", s.URL, err)
+		}
+	}
+	if err := validateTableFormat(s.Format); err != nil {
+		return err
+	}
+	if s.Interval != "" {
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("interval %q is not a valid duration: %w", s.Interval, err)
+		}
+		if interval <= 0 {
+			return errors.New("interval must be greater than zero")
+		}
+	}
+	if s.Fallthrough != nil {
+		if err := s.Fallthrough.validate(); err != nil {
+			return fmt.Errorf("fallthrough: %w", err)
+		}
+	}
+	return nil
+}
+
+func (f *FileRetriever) validate() error {
+	if f == nil {
+		return errors.New("file must be defined when type is \"" + RegionResolverTypeFile + "\"")
+	}
+	if f.Path == "" {
+		return errors.New("path must be defined")
+	}
+	return validateTableFormat(f.Format)
+}
+
+// validateTableFormat checks the format of a snapshot or file table, empty meaning guessed from the extension.
+func validateTableFormat(format string) error {
+	switch format {
+	case "", SnapshotFormatJSON, SnapshotFormatCSV, SnapshotFormatYAML:
+		return nil
+	default:
+		return errors.New("unknown format \"" + format + "\", must be one of \"" +
+			SnapshotFormatJSON + "\", \"" + SnapshotFormatCSV + "\", \"" + SnapshotFormatYAML + "\"")
+	}
+}
+
+func (s *SQLRetriever) validate() error {
+	if s == nil {
+		return errors.New("sql must be defined when type is \"" + RegionResolverTypeSQL + "\"")
+	}
+	if s.Driver == "" {
+		return errors.New("driver must be defined")
+	}
+	if s.DSN == "" {
+		return errors.New("dsn must be defined")
+	}
+	if s.Query == "" {
+		return errors.New("query must be defined")
+	}
+	for name, d := range map[string]string{"query_timeout": s.QueryTimeout, "conn_max_lifetime": s.ConnMaxLifetime} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("%s %q is not a valid duration: %w", name, d, err)
+		}
+	}
+	if s.MaxOpenConns < 0 || s.MaxIdleConns < 0 {
+		return errors.New("max_open_conns and max_idle_conns must not be negative")
+	}
+	return nil
+}
+
+// validate checks the options of a grpc retriever.
+func (g *GRPCRetriever) validate() error {
+	if g == nil {
+		return errors.New("grpc must be defined when type is \"" + RegionResolverTypeGRPC + "\"")
+	}
+	if g.Address == "" {
+		return errors.New("address must be defined")
+	}
+	if g.DescriptorSet == "" {
+		if g.Method != "" || g.RequestField != "" {
+			return errors.New("method and request_field require a descriptor_set")
+		}
+		return nil
+	}
+	service, method, ok := strings.Cut(strings.TrimPrefix(g.Method, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return fmt.Errorf("method %q must be in the form /package.Service/Method", g.Method)
+	}
+	if g.RequestField == "" {
+		return errors.New("request_field must be defined when descriptor_set is defined")
+	}
+	return nil
+}
+
+// validate checks the RegionResolver used by a retriever of the given type.
+// Only the http retriever needs a field, since other retrievers return a single value.
+func (r *RegionResolver) validate(retrieverType string) error {
 	if r == nil {
-		return errors.New("region_resolver must be defined for http retriever")
+		return errors.New("region_resolver must be defined for " + retrieverType + " retriever")
 	}
-	if r.Type == "" {
-		return errors.New("type must be defined")
+	switch r.Type {
+	case RegionResolverTypeMap:
+		if r.Field == "" && retrieverType == RegionResolverTypeHTTP {
+			return errors.New("field must be defined")
+		}
+		if len(r.Mapping) == 0 {
+			return errors.New("mapping must have at least one entry")
+		}
+	case RegionResolverTypeExpr:
+		if r.Expression == "" {
+			return errors.New("expression must be defined when type is \"" + RegionResolverTypeExpr + "\"")
+		}
+	default:
+		return errors.New("unknown type \"" + r.Type + "\", must be one of \"" +
+			RegionResolverTypeMap + "\", \"" + RegionResolverTypeExpr + "\"")
 	}
-	if r.Field == "" {
-		return errors.New("field must be defined")
+	if err := r.Compile(); err != nil {
+		return err
 	}
-	if len(r.Mapping) == 0 {
-		return errors.New("mapping must have at least one entry")
+	return r.validatePolicies()
+}
+
+// Compile compiles the Expression or the patterns of the Mapping, depending on Type, so that
+// invalid ones are caught at validation. Compiled values are cached, Compile must be called
+// before the resolver is used concurrently.
+//
+// Expression is evaluated against the following variables:
+//   - resp: the response of the retriever (e.g. the JSON body for http);
+//   - req: the incoming request attributes, header, metadata, query, host, path and client_ip;
+//   - param: the lookup value sent to the retriever.
+func (r *RegionResolver) Compile() error {
+	if r.Type == RegionResolverTypeExpr {
+		if r.program != nil {
+			return nil
+		}
+		env := map[string]any{"resp": map[string]any{}, "req": map[string]any{}, "param": ""}
+		program, err := expr.Compile(r.Expression, expr.Env(env), expr.AsKind(reflect.String))
+		if err != nil {
+			return fmt.Errorf("invalid expression: %w", err)
+		}
+		r.program = program
+		return nil
+	}
+
+	if r.mapping != nil {
+		return nil
+	}
+	m, err := r.compileMapping()
+	if err != nil {
+		return err
+	}
+	r.mapping = m
+	return nil
+}
+
+// Program returns the compiled Expression, or nil if Compile has not been called.
+func (r *RegionResolver) Program() *vm.Program {
+	return r.program
+}
+
+// validatePolicies checks the error policies and the fallback retriever.
+func (r *RegionResolver) validatePolicies() error {
+	if r.OnError != nil {
+		for name, policy := range map[string]string{"retriever": r.OnError.Retriever, "unmapped": r.OnError.Unmapped} {
+			if err := r.validatePolicy(policy); err != nil {
+				return fmt.Errorf("on_error.%s: %w", name, err)
+			}
+		}
+	}
+
+	if r.Fallback != nil {
+		if r.OnError == nil || (r.OnError.Retriever != ErrorPolicyFallback && r.OnError.Unmapped != ErrorPolicyFallback) {
+			return errors.New("fallback is never used, on_error.retriever or on_error.unmapped must be \"" +
+				ErrorPolicyFallback + "\"")
+		}
+		if err := r.Fallback.validate(); err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *RegionResolver) validatePolicy(policy string) error {
+	switch policy {
+	case "", ErrorPolicyReject:
+	case ErrorPolicyDefault:
+		if r.Default == "" {
+			return errors.New("default must be defined to use the \"" + ErrorPolicyDefault + "\" policy")
+		}
+	case ErrorPolicyFallback:
+		if r.Fallback == nil {
+			return errors.New("fallback must be defined to use the \"" + ErrorPolicyFallback + "\" policy")
+		}
+	default:
+		return errors.New("unknown policy \"" + policy + "\", must be one of \"" + ErrorPolicyReject +
+			"\", \"" + ErrorPolicyDefault + "\", \"" + ErrorPolicyFallback + "\"")
 	}
 	return nil
 }
@@ -158,29 +1308,175 @@ func (cfg *ProtocolCfg) validate(p Protocol) error {
 		return errors.New(string(p) + ": listen port must not be empty")
 	}
 
-	if len(cfg.Destinations) == 0 {
+	if len(cfg.Destinations) == 0 && len(cfg.Hosts) == 0 && len(cfg.Routes) == 0 {
 		return errors.New(string(p) + ": destinations must not be empty")
 	}
 
-	for route, regionMap := range cfg.Destinations {
+	for i, k := range cfg.RegionKeys {
+		if err := k.validate(p); err != nil {
+			return fmt.Errorf("%s: region_keys[%d]: %w", p, i, err)
+		}
+	}
+
+	if cfg.Affinity != nil && p == ProtocolGRPC {
+		return errors.New(string(p) + ": affinity is not supported")
+	}
+	if err := cfg.Affinity.validate(); err != nil {
+		return fmt.Errorf("%s: affinity: %w", p, err)
+	}
+
+	names := make([]string, 0, len(cfg.Upstreams))
+	for name := range cfg.Upstreams {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		upstream := cfg.Upstreams[name]
+		if err := upstream.validate(p, string(p)+": upstreams: \""+name+"\""); err != nil {
+			return err
+		}
+	}
+	if err := cfg.HealthCheck.validate(p); err != nil {
+		return fmt.Errorf("%s: health_check: %w", p, err)
+	}
+	if err := cfg.validateFailover(); err != nil {
+		return fmt.Errorf("%s: failover: %w", p, err)
+	}
+
+	if err := cfg.validateDestinations(p, string(p), cfg.Destinations); err != nil {
+		return err
+	}
+
+	if len(cfg.Hosts) > 0 && p == ProtocolGRPC {
+		return errors.New(string(p) + ": hosts is not supported")
+	}
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for host := range cfg.Hosts {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	for _, host := range hosts {
+		if err := validateHost(host); err != nil {
+			return fmt.Errorf("%s: hosts: %w", p, err)
+		}
+		if len(cfg.Hosts[host]) == 0 {
+			return errors.New(string(p) + ": hosts: \"" + host + "\" has no destinations")
+		}
+		if err := cfg.validateDestinations(p, string(p)+": hosts: \""+host+"\"", cfg.Hosts[host]); err != nil {
+			return err
+		}
+	}
+
+	return cfg.validateRouteList(p)
+}
+
+// validateRouteList checks the predicates and destinations of each of the Routes,
+// and that their paths are not ambiguous with the destination keys of their host group.
+func (cfg *ProtocolCfg) validateRouteList(p Protocol) error {
+	groups := map[string]map[string]map[string]string{}
+	for i := range cfg.Routes {
+		r := &cfg.Routes[i]
+		scope := fmt.Sprintf("%s: routes[%d]", p, i)
+		if err := r.validate(p); err != nil {
+			return fmt.Errorf("%s: %w", scope, err)
+		}
+		if err := cfg.validateDestinations(p, scope, map[string]map[string]string{r.Path: r.Destinations}); err != nil {
+			return err
+		}
+
+		// the paths of the routes join the destination keys of their host group
+		group, ok := groups[r.Host]
+		if !ok {
+			source := cfg.Destinations
+			if r.Host != "" {
+				source = cfg.Hosts[r.Host]
+			}
+			group = maps.Clone(source)
+			if group == nil {
+				group = map[string]map[string]string{}
+			}
+			groups[r.Host] = group
+		}
+		if _, ok = group[r.Path]; !ok {
+			group[r.Path] = r.Destinations
+		}
+	}
+
+	for _, host := range slices.Sorted(maps.Keys(groups)) {
+		scope := string(p)
+		if host != "" {
+			scope += ": hosts: \"" + host + "\""
+		}
+		if err := validateRoutes(p, scope, groups[host]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Route) validate(p Protocol) error {
+	if r.Path == "" {
+		return errors.New("path must not be empty")
+	}
+	if len(r.Destinations) == 0 {
+		return errors.New("destinations must not be empty")
+	}
+
+	if p == ProtocolGRPC {
+		if r.Host != "" || len(r.Methods) > 0 || len(r.Headers) > 0 || len(r.Query) > 0 {
+			return errors.New("host, methods, headers and query are not supported by " + string(p))
+		}
+	} else if len(r.Metadata) > 0 {
+		return errors.New("metadata is only supported by " + string(ProtocolGRPC))
+	}
+
+	if r.Host != "" {
+		if err := validateHost(r.Host); err != nil {
+			return err
+		}
+	}
+	for _, method := range r.Methods {
+		if method == "" || strings.ContainsAny(method, " /") {
+			return errors.New("invalid method \"" + method + "\"")
+		}
+	}
+	for _, predicates := range []map[string]string{r.Headers, r.Query, r.Metadata} {
+		if _, ok := predicates[""]; ok {
+			return errors.New("predicate names must not be empty")
+		}
+	}
+	return nil
+}
+
+// validateDestinations checks the routes of destinations and their addresses,
+// scope prefixes the errors.
+func (cfg *ProtocolCfg) validateDestinations(
+	p Protocol,
+	scope string,
+	destinations map[string]map[string]string,
+) error {
+	if err := validateRoutes(p, scope, destinations); err != nil {
+		return err
+	}
+
+	for route, regionMap := range destinations {
 		if len(regionMap) == 0 {
-			return errors.New(string(p) + ": route \"" + route + "\" has no region mappings")
+			return errors.New(scope + ": route \"" + route + "\" has no region mappings")
 		}
 
 		for region, addr := range regionMap {
 			if addr == "" {
-				return errors.New(string(p) + ": route \"" + route + "\" region \"" + region + "\" has an empty address")
+				return errors.New(scope + ": route \"" + route + "\" region \"" + region + "\" has an empty address")
 			}
 
-			var err error
-			switch p {
-			case ProtocolHTTP, ProtocolGraphQL:
-				err = validateHTTPAddress(p, route, region, addr)
-			case ProtocolGRPC:
-				err = validateGRPCAddress(p, route, region, addr)
+			addrScope := scope + ": route \"" + route + "\" region \"" + region + "\""
+			if name, ok := strings.CutPrefix(addr, UpstreamPrefix); ok {
+				if _, ok = cfg.Upstreams[name]; !ok {
+					return errors.New(addrScope + ": unknown upstream \"" + name + "\"")
+				}
+				continue
 			}
-
-			if err != nil {
+			if err := validateAddress(p, addrScope, addr); err != nil {
 				return err
 			}
 		}
@@ -189,22 +1485,204 @@ func (cfg *ProtocolCfg) validate(p Protocol) error {
 	return nil
 }
 
-func validateHTTPAddress(p Protocol, route, region, addr string) error {
+// validate checks the policy and the endpoints of u, scope prefixes the errors.
+func (u *Upstream) validate(p Protocol, scope string) error {
+	switch u.Policy {
+	case "", BalanceRoundRobin, BalanceLeastOutstanding, BalanceWeighted, BalanceConsistentHash:
+	default:
+		return errors.New(scope + ": unknown policy \"" + u.Policy + "\"")
+	}
+	if len(u.Endpoints) == 0 {
+		return errors.New(scope + ": endpoints must not be empty")
+	}
+	if err := u.HealthCheck.validate(p); err != nil {
+		return fmt.Errorf("%s: health_check: %w", scope, err)
+	}
+	for i, e := range u.Endpoints {
+		endpointScope := fmt.Sprintf("%s: endpoints[%d]", scope, i)
+		if e.Weight < 0 {
+			return errors.New(endpointScope + ": weight must not be negative")
+		}
+		if strings.ContainsAny(e.Address, "{}") {
+			return errors.New(endpointScope + ": \"" + e.Address + "\" must not contain parameters")
+		}
+		if err := validateAddress(p, endpointScope, e.Address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFailover checks the failover regions, and that the failover routes are destination keys of cfg.
+func (cfg *ProtocolCfg) validateFailover() error {
+	if cfg.Failover == nil {
+		return nil
+	}
+	if err := validateFailoverRegions(cfg.Failover.Regions); err != nil {
+		return fmt.Errorf("regions: %w", err)
+	}
+
+	keys := map[string]map[string]string{}
+	maps.Copy(keys, cfg.Destinations)
+	for _, destinations := range cfg.Hosts {
+		maps.Copy(keys, destinations)
+	}
+	for i := range cfg.Routes {
+		keys[cfg.Routes[i].Path] = nil
+	}
+	for _, route := range slices.Sorted(maps.Keys(cfg.Failover.Routes)) {
+		if _, ok := keys[route]; !ok {
+			return errors.New("routes: \"" + route + "\" is not a destination key")
+		}
+		f := cfg.Failover.Routes[route]
+		if f.DataResidency && len(f.Regions) > 0 {
+			return errors.New("routes: \"" + route + "\": regions are forbidden by data_residency")
+		}
+		if err := validateFailoverRegions(f.Regions); err != nil {
+			return fmt.Errorf("routes: %q: regions: %w", route, err)
+		}
+	}
+	return nil
+}
+
+// validateFailoverRegions checks that every region fails over to distinct other regions.
+func validateFailoverRegions(regions map[string][]string) error {
+	for _, region := range slices.Sorted(maps.Keys(regions)) {
+		failover := regions[region]
+		if region == "" || len(failover) == 0 {
+			return errors.New("\"" + region + "\" must be a region failing over to at least another one")
+		}
+		for i, other := range failover {
+			if other == "" || other == region || slices.Contains(failover[:i], other) {
+				return errors.New("\"" + region + "\" must fail over to distinct other regions")
+			}
+		}
+	}
+	return nil
+}
+
+func (h *HealthCheck) validate(p Protocol) error {
+	if h == nil {
+		return nil
+	}
+	switch h.Type {
+	case HealthCheckHTTP:
+		if p == ProtocolGRPC {
+			return errors.New("type \"" + h.Type + "\" is not supported by " + string(p))
+		}
+		if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+			return errors.New("path \"" + h.Path + "\" must start with \"/\"")
+		}
+		if h.Status != 0 && (h.Status < 100 || h.Status > 599) {
+			return errors.New("status " + strconv.Itoa(h.Status) + " is not a valid HTTP status code")
+		}
+	case HealthCheckGRPC:
+		if p != ProtocolGRPC {
+			return errors.New("type \"" + h.Type + "\" is only supported by " + string(ProtocolGRPC))
+		}
+	case HealthCheckTCP:
+	default:
+		return errors.New("unknown type \"" + h.Type + "\"")
+	}
+
+	for name, d := range map[string]string{"interval": h.Interval, "timeout": h.Timeout} {
+		if d == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return fmt.Errorf("%s %q is not a valid duration: %w", name, d, err)
+		}
+		if duration <= 0 {
+			return errors.New(name + " must be greater than zero")
+		}
+	}
+	if h.Rise < 0 || h.Fall < 0 {
+		return errors.New("rise and fall must not be negative")
+	}
+	return nil
+}
+
+// validateHost checks that host is either a host name or a wildcard subdomain, e.g. "*.example.com".
+func validateHost(host string) error {
+	name := strings.TrimPrefix(host, "*.")
+	if name == "" || strings.ContainsAny(name, "*:/ ") {
+		return errors.New("\"" + host + "\" must be a host name, optionally starting with \"*.\"")
+	}
+	return nil
+}
+
+func (k *RegionKeySource) validate(p Protocol) error {
+	switch k.Type {
+	case RegionKeyHeader, RegionKeyQuery, RegionKeyCookie:
+		if p == ProtocolGRPC {
+			return errors.New("type \"" + k.Type + "\" is not supported by " + string(p))
+		}
+		if k.Name == "" {
+			return errors.New("name is required for type \"" + k.Type + "\"")
+		}
+	case RegionKeyMetadata:
+		if p != ProtocolGRPC {
+			return errors.New("type \"" + k.Type + "\" is only supported by " + string(ProtocolGRPC))
+		}
+		if k.Name == "" {
+			return errors.New("name is required for type \"" + k.Type + "\"")
+		}
+	case RegionKeySubdomain:
+		if p == ProtocolGRPC {
+			return errors.New("type \"" + k.Type + "\" is not supported by " + string(p))
+		}
+		if k.Index < 0 {
+			return errors.New("index must not be negative")
+		}
+	case RegionKeyPathRegex:
+		re, err := regexp.Compile(k.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q is not a valid regular expression: %w", k.Pattern, err)
+		}
+		if k.Group == "" {
+			return nil
+		}
+		if n, err := strconv.Atoi(k.Group); err == nil {
+			if n < 0 || n > re.NumSubexp() {
+				return fmt.Errorf("group %d does not exist in pattern %q", n, k.Pattern)
+			}
+		} else if re.SubexpIndex(k.Group) == -1 {
+			return fmt.Errorf("group %q does not exist in pattern %q", k.Group, k.Pattern)
+		}
+	case RegionKeyPathSegment, RegionKeyJWT, RegionKeyClientIP:
+	default:
+		return errors.New("unknown type \"" + k.Type + "\"")
+	}
+	return nil
+}
+
+// validateAddress checks that addr is a backend address of protocol p, scope prefixes the errors.
+func validateAddress(p Protocol, scope, addr string) error {
+	switch p {
+	case ProtocolHTTP, ProtocolGraphQL:
+		return validateHTTPAddress(scope, addr)
+	case ProtocolGRPC:
+		return validateGRPCAddress(scope, addr)
+	}
+	return nil
+}
+
+func validateHTTPAddress(scope, addr string) error {
 	u, err := url.ParseRequestURI(addr)
 	if err != nil {
-		return fmt.Errorf("%s: route %q region %q: %q is not a valid URL: %w", p, route, region, addr, err)
+		return fmt.Errorf("%s: %q is not a valid URL: %w", scope, addr, err)
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return errors.New(string(p) + ": route \"" + route + "\" region \"" +
-			region + "\": \"" + addr + "\" must use http or https scheme")
+		return errors.New(scope + ": \"" + addr + "\" must use http or https scheme")
 	}
 	if u.Host == "" {
-		return errors.New(string(p) + ": route \"" + route + "\" region \"" + region + "\": \"" + addr + "\" has no host")
+		return errors.New(scope + ": \"" + addr + "\" has no host")
 	}
 	return nil
 }
 
-func validateGRPCAddress(p Protocol, route, region, addr string) error {
+func validateGRPCAddress(scope, addr string) error {
 	// Strip any path component that may be legitimately included in gRPC
 	// wildcard destination addresses (e.g. "localhost:9095/mockserver.v1.MockService").
 	// We only validate the host:port portion.
@@ -213,11 +1691,10 @@ func validateGRPCAddress(p Protocol, route, region, addr string) error {
 		hostPort = addr[:idx]
 	}
 	if hostPort == "" {
-		return errors.New(string(p) + ": route \"" + route + "\" region \"" + region + "\": \"" + addr + "\" has no host")
+		return errors.New(scope + ": \"" + addr + "\" has no host")
 	}
 	if strings.Contains(hostPort, "://") {
-		return errors.New(string(p) + ": route \"" + route + "\" region \"" + region +
-			"\": gRPC address \"" + addr + "\" must not contain a scheme")
+		return errors.New(scope + ": gRPC address \"" + addr + "\" must not contain a scheme")
 	}
 	return nil
 }
@@ -0,0 +1,1241 @@
+package config_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+func validServiceCfg(retriever *config.RegionRetriever) *config.ServiceCfg {
+	return &config.ServiceCfg{
+		HTTP: &config.ProtocolCfg{
+			Listen:       "8080",
+			Destinations: map[string]map[string]string{"/": {"euw1": "http://localhost:8085"}},
+		},
+		RegionRetriever: retriever,
+	}
+}
+
+func validRegionResolver() *config.RegionResolver {
+	return &config.RegionResolver{Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"}}
+}
+
+func TestServiceCfg_Validate_RegionRetriever(t *testing.T) {
+	tests := []struct {
+		retriever *config.RegionRetriever
+		name      string
+		wantErr   bool
+	}{
+		{
+			name: "http get",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+			},
+		},
+		{
+			name: "http get without query param",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet,
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "http get with url template",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost/users/{param}/profile", Method: http.MethodGet,
+				RegionResolver: validRegionResolver(),
+			},
+		},
+		{
+			name: "http get with query params template",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost/users", Method: http.MethodGet,
+				QueryParams:    map[string]string{"id": "{param}", "tenant": "{header:X-Tenant}"},
+				RegionResolver: validRegionResolver(),
+			},
+		},
+		{
+			name: "http get with param placeholder in url query",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost/users?id={param}", Method: http.MethodGet,
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "http post",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodPost,
+				BodyTemplate: `{"lookup": {}}`, BodyParam: "lookup.id",
+				RegionResolver: validRegionResolver(),
+			},
+		},
+		{
+			name: "http post without body param",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodPost,
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "http put with invalid body template",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodPut,
+				BodyTemplate: `{"lookup":`, BodyParam: "lookup.id",
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "http put with body param through a non object",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodPut,
+				BodyTemplate: `{"lookup": "id"}`, BodyParam: "lookup.id",
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "http unsupported method",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodDelete, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "sql",
+			retriever: &config.RegionRetriever{
+				Type: "sql",
+				SQL: &config.SQLRetriever{
+					Driver: "sqlite", DSN: "users.db", Query: "SELECT country FROM users WHERE id = ?",
+					QueryTimeout: "500ms",
+				},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"eu": "euw1"}},
+			},
+		},
+		{
+			name: "sql without query",
+			retriever: &config.RegionRetriever{
+				Type:           "sql",
+				SQL:            &config.SQLRetriever{Driver: "sqlite", DSN: "users.db"},
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "sql without region resolver",
+			retriever: &config.RegionRetriever{
+				Type: "sql",
+				SQL:  &config.SQLRetriever{Driver: "sqlite", DSN: "users.db", Query: "SELECT 1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "default and fallback policies",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					Default:  "euw1",
+					Fallback: &config.RegionRetriever{Type: "static", Static: "use1"},
+					OnError:  &config.ErrorPolicy{Retriever: "fallback", Unmapped: "default"},
+				},
+			},
+		},
+		{
+			name: "default policy without default",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					OnError: &config.ErrorPolicy{Unmapped: "default"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fallback policy without fallback",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					OnError: &config.ErrorPolicy{Retriever: "fallback"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid fallback",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					Fallback: &config.RegionRetriever{Type: "static"},
+					OnError:  &config.ErrorPolicy{Unmapped: "fallback"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unused fallback",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					Fallback: &config.RegionRetriever{Type: "static", Static: "use1"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "fallback not used by any policy",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type: "map", Field: "country", Mapping: map[string]string{"eu": "euw1"},
+					Default:  "euw1",
+					Fallback: &config.RegionRetriever{Type: "static", Static: "use1"},
+					OnError:  &config.ErrorPolicy{Retriever: "default"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "grpc well-known method",
+			retriever: &config.RegionRetriever{
+				Type:           "grpc",
+				GRPC:           &config.GRPCRetriever{Address: "users:9090"},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"eu": "euw1"}},
+			},
+		},
+		{
+			name: "grpc descriptor set",
+			retriever: &config.RegionRetriever{
+				Type: "grpc",
+				GRPC: &config.GRPCRetriever{
+					Address:       "users:9090",
+					Method:        "/users.v1.UserDirectory/GetUser",
+					DescriptorSet: "users.pb",
+					RequestField:  "user.id",
+				},
+				RegionResolver: validRegionResolver(),
+			},
+		},
+		{
+			name: "grpc descriptor set without field",
+			retriever: &config.RegionRetriever{
+				Type: "grpc",
+				GRPC: &config.GRPCRetriever{
+					Address:       "users:9090",
+					Method:        "/users.v1.UserDirectory/GetUser",
+					DescriptorSet: "users.pb",
+					RequestField:  "user.id",
+				},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"eu": "euw1"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "grpc invalid method",
+			retriever: &config.RegionRetriever{
+				Type: "grpc",
+				GRPC: &config.GRPCRetriever{
+					Address:       "users:9090",
+					Method:        "GetUser",
+					DescriptorSet: "users.pb",
+					RequestField:  "user.id",
+				},
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "grpc method without descriptor set",
+			retriever: &config.RegionRetriever{
+				Type:           "grpc",
+				GRPC:           &config.GRPCRetriever{Address: "users:9090", Method: "/users.v1.UserDirectory/GetUser"},
+				RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "grpc without address",
+			retriever: &config.RegionRetriever{
+				Type: "grpc", GRPC: &config.GRPCRetriever{}, RegionResolver: validRegionResolver(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "geoip database",
+			retriever: &config.RegionRetriever{
+				Type:           "geoip",
+				GeoIP:          &config.GeoIPRetriever{Database: "GeoLite2-Country.mmdb"},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"IT": "euw1"}},
+			},
+		},
+		{
+			name: "geoip cidrs",
+			retriever: &config.RegionRetriever{
+				Type:  "geoip",
+				GeoIP: &config.GeoIPRetriever{CIDRs: map[string]string{"10.0.0.0/8": "euw1", "2001:db8::/32": "use1"}},
+			},
+		},
+		{
+			name: "geoip database without region resolver",
+			retriever: &config.RegionRetriever{
+				Type: "geoip", GeoIP: &config.GeoIPRetriever{Database: "GeoLite2-Country.mmdb"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "geoip invalid cidr",
+			retriever: &config.RegionRetriever{
+				Type: "geoip", GeoIP: &config.GeoIPRetriever{CIDRs: map[string]string{"10.0.0.0/33": "euw1"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "geoip without sources",
+			retriever: &config.RegionRetriever{Type: "geoip", GeoIP: &config.GeoIPRetriever{}},
+			wantErr:   true,
+		},
+		{
+			name: "expr resolver",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type:       "expr",
+					Expression: `resp.tier == "enterprise" ? resp.home_region : "shared-eu"`,
+				},
+			},
+		},
+		{
+			name: "expr resolver with syntax error",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "expr", Expression: `resp.tier == `},
+			},
+			wantErr: true,
+		},
+		{
+			name: "expr resolver not returning a string",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "expr", Expression: `len(param)`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cached expr resolver reading constant request attributes",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{
+					Type:       "expr",
+					Expression: `req.header["X-Tier"] == "gold" || req.client_ip == "10.0.0.1" ? "use1" : "euw1"`,
+				},
+				Cache: &config.RegionCache{TTL: "1m"},
+			},
+		},
+		{
+			name: "cached expr resolver reading dynamic request attributes",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "expr", Expression: `req.header[resp.header] ?? "euw1"`},
+				Cache:          &config.RegionCache{TTL: "1m"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cached expr resolver reading the whole request",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "expr", Expression: `string(req)`},
+				Cache:          &config.RegionCache{TTL: "1m"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "expr resolver without expression",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "expr"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown resolver type",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: &config.RegionResolver{Type: "lookup", Field: "country"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "http with auth and tls",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "https://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Auth:           &config.RetrieverAuth{Bearer: &config.Secret{Env: "TOKEN"}},
+				TLS:            &config.RetrieverTLS{CAFile: "ca.pem", CertFile: "client.pem", KeyFile: "client-key.pem"},
+			},
+		},
+		{
+			name: "auth with several methods",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "https://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Auth: &config.RetrieverAuth{
+					Bearer: &config.Secret{Env: "TOKEN"},
+					Basic:  &config.BasicAuth{Username: "user", Password: &config.Secret{Env: "PASSWORD"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "secret with file and env",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "https://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Auth:           &config.RetrieverAuth{Bearer: &config.Secret{Env: "TOKEN", File: "token"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hmac with unknown algorithm",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "https://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Auth: &config.RetrieverAuth{
+					HMAC: &config.HMACAuth{Secret: &config.Secret{Env: "SECRET"}, Algorithm: "md5"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "tls with cert but no key",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "https://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				TLS:            &config.RetrieverTLS{CertFile: "client.pem"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "sql with auth",
+			retriever: &config.RegionRetriever{
+				Type: "sql", SQL: &config.SQLRetriever{Driver: "sqlite", DSN: "users.db", Query: "SELECT 1"},
+				RegionResolver: validRegionResolver(),
+				Auth:           &config.RetrieverAuth{Bearer: &config.Secret{Env: "TOKEN"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "snapshot with fallthrough",
+			retriever: &config.RegionRetriever{
+				Type: "snapshot",
+				Snapshot: &config.SnapshotRetriever{
+					URL:         "http://localhost/assignments.csv",
+					Interval:    "10m",
+					Fallthrough: &config.RegionRetriever{Type: "static", Static: "euw1"},
+				},
+			},
+		},
+		{
+			name: "snapshot with url and file",
+			retriever: &config.RegionRetriever{
+				Type:     "snapshot",
+				Snapshot: &config.SnapshotRetriever{URL: "http://localhost/users.json", File: "users.json"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "snapshot with unknown format",
+			retriever: &config.RegionRetriever{
+				Type: "snapshot", Snapshot: &config.SnapshotRetriever{File: "users.xml", Format: "xml"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "snapshot with expr resolver",
+			retriever: &config.RegionRetriever{
+				Type: "snapshot", Snapshot: &config.SnapshotRetriever{File: "users.json"},
+				RegionResolver: &config.RegionResolver{Type: "expr", Expression: `"euw1"`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "file",
+			retriever: &config.RegionRetriever{
+				Type: "file", File: &config.FileRetriever{Path: "/etc/poly-route/users.yaml", Format: "yaml"},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"glob:eu-*": "euw1"}},
+			},
+		},
+		{
+			name:      "file without path",
+			retriever: &config.RegionRetriever{Type: "file", File: &config.FileRetriever{Format: "csv"}},
+			wantErr:   true,
+		},
+		{
+			name:      "file without options",
+			retriever: &config.RegionRetriever{Type: "file"},
+			wantErr:   true,
+		},
+		{
+			name:      "static with cache",
+			retriever: &config.RegionRetriever{Type: "static", Static: "euw1", Cache: &config.RegionCache{TTL: "1m"}},
+		},
+		{
+			name: "http with retry and circuit breaker",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Retry:          &config.RetryPolicy{MaxAttempts: 3, InitialBackoff: "50ms", MaxBackoff: "1s"},
+				CircuitBreaker: &config.CircuitBreaker{FailureThreshold: 5, OpenTimeout: "30s"},
+				Cache:          &config.RegionCache{TTL: "1m", StaleTTL: "10m"},
+			},
+		},
+		{
+			name: "retry without attempts",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Retry:          &config.RetryPolicy{InitialBackoff: "50ms"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "retry with initial backoff greater than max backoff",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				Retry:          &config.RetryPolicy{MaxAttempts: 2, InitialBackoff: "2s", MaxBackoff: "1s"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "circuit breaker with invalid open timeout",
+			retriever: &config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+				RegionResolver: validRegionResolver(),
+				CircuitBreaker: &config.CircuitBreaker{OpenTimeout: "later"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "static with retry",
+			retriever: &config.RegionRetriever{
+				Type: "static", Static: "euw1", Retry: &config.RetryPolicy{MaxAttempts: 2},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cache with invalid stale ttl",
+			retriever: &config.RegionRetriever{
+				Type: "static", Static: "euw1", Cache: &config.RegionCache{TTL: "1m", StaleTTL: "-1s"},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "cache with invalid ttl",
+			retriever: &config.RegionRetriever{Type: "static", Static: "euw1", Cache: &config.RegionCache{TTL: "soon"}},
+			wantErr:   true,
+		},
+		{
+			name: "chain",
+			retriever: &config.RegionRetriever{
+				Type: "chain",
+				Children: []*config.RegionRetriever{
+					{
+						Type: "http", URL: "http://localhost", Method: http.MethodGet, QueryParam: "id",
+						RegionResolver: validRegionResolver(),
+					},
+					{Type: "static", Static: "euw1"},
+				},
+			},
+		},
+		{
+			name: "first-of with deadline",
+			retriever: &config.RegionRetriever{
+				Type:     "first-of",
+				Deadline: "500ms",
+				Children: []*config.RegionRetriever{{Type: "static", Static: "euw1"}},
+			},
+		},
+		{name: "chain without children", retriever: &config.RegionRetriever{Type: "chain"}, wantErr: true},
+		{
+			name: "chain with deadline",
+			retriever: &config.RegionRetriever{
+				Type:     "chain",
+				Deadline: "500ms",
+				Children: []*config.RegionRetriever{{Type: "static", Static: "euw1"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "chain with invalid child",
+			retriever: &config.RegionRetriever{
+				Type:     "chain",
+				Children: []*config.RegionRetriever{{Type: "static", Static: "euw1"}, {Type: "sql"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validServiceCfg(tt.retriever).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_JWT(t *testing.T) {
+	tests := []struct {
+		jwt     *config.JWT
+		name    string
+		wantErr bool
+	}{
+		{name: "not configured"},
+		{
+			name: "static hmac key",
+			jwt: &config.JWT{
+				Claim: "sub", Keys: []config.JWTKey{{Algorithm: "HS256", Secret: "a-32-bytes-long-hmac-test-secret"}},
+			},
+		},
+		{
+			name: "short hmac secret",
+			jwt: &config.JWT{
+				Claim: "sub", Keys: []config.JWTKey{{Algorithm: "HS384", Secret: "a-32-bytes-long-hmac-test-secret"}},
+			},
+			wantErr: true,
+		},
+		{name: "jwks file", jwt: &config.JWT{Claim: "sub", JWKSFile: "jwks.json"}},
+		{name: "missing claim", jwt: &config.JWT{JWKSFile: "jwks.json"}, wantErr: true},
+		{name: "missing keys", jwt: &config.JWT{Claim: "sub"}, wantErr: true},
+		{
+			name:    "missing public key",
+			jwt:     &config.JWT{Claim: "sub", Keys: []config.JWTKey{{Algorithm: "RS256"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			jwt:     &config.JWT{Claim: "sub", Keys: []config.JWTKey{{Algorithm: "none"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.JWT = tt.jwt
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_RegionKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []config.RegionKeySource
+		grpc    bool
+		wantErr bool
+	}{
+		{
+			name: "http sources",
+			keys: []config.RegionKeySource{
+				{Type: "header", Name: "X-Tenant"},
+				{Type: "cookie", Name: "tenant"},
+				{Type: "path_segment", Index: 1},
+				{Type: "path_regex", Pattern: `^/tenants/(?P<id>[^/]+)`, Group: "id"},
+				{Type: "subdomain"},
+			},
+		},
+		{name: "grpc metadata", grpc: true, keys: []config.RegionKeySource{{Type: "metadata", Name: "x-tenant"}}},
+		{name: "metadata on http", keys: []config.RegionKeySource{{Type: "metadata", Name: "x"}}, wantErr: true},
+		{name: "cookie on grpc", grpc: true, keys: []config.RegionKeySource{{Type: "cookie", Name: "x"}}, wantErr: true},
+		{name: "header without name", keys: []config.RegionKeySource{{Type: "header"}}, wantErr: true},
+		{name: "invalid regex", keys: []config.RegionKeySource{{Type: "path_regex", Pattern: "("}}, wantErr: true},
+		{
+			name:    "unknown regex group",
+			keys:    []config.RegionKeySource{{Type: "path_regex", Pattern: "^/(a)", Group: "2"}},
+			wantErr: true,
+		},
+		{name: "jwt without jwt config", keys: []config.RegionKeySource{{Type: "jwt"}}, wantErr: true},
+		{name: "unknown type", keys: []config.RegionKeySource{{Type: "body"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.RegionKeys = tt.keys
+			if tt.grpc {
+				cfg.GRPC = &config.ProtocolCfg{
+					Listen:       "9090",
+					Destinations: map[string]map[string]string{"*": {"euw1": "localhost:9095"}},
+					RegionKeys:   tt.keys,
+				}
+				cfg.HTTP.RegionKeys = nil
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_TrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr bool
+	}{
+		{name: "not configured"},
+		{name: "addresses and networks", proxies: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}},
+		{name: "invalid address", proxies: []string{"proxy.local"}, wantErr: true},
+		{name: "invalid network", proxies: []string{"10.0.0.0/40"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.TrustedProxies = tt.proxies
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Admin(t *testing.T) {
+	tests := []struct {
+		admin   *config.AdminCfg
+		name    string
+		wantErr bool
+	}{
+		{name: "not configured"},
+		{name: "listen", admin: &config.AdminCfg{Listen: "9100"}},
+		{name: "missing listen", admin: &config.AdminCfg{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.Admin = tt.admin
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Affinity(t *testing.T) {
+	tests := []struct {
+		affinity *config.Affinity
+		name     string
+		grpc     bool
+		wantErr  bool
+	}{
+		{name: "not configured"},
+		{name: "secret", affinity: &config.Affinity{Secret: &config.Secret{Env: "SECRET"}, TTL: "30m", Secure: true}},
+		{name: "missing secret", affinity: &config.Affinity{TTL: "30m"}, wantErr: true},
+		{name: "invalid ttl", affinity: &config.Affinity{Secret: &config.Secret{Env: "SECRET"}, TTL: "-1m"}, wantErr: true},
+		{name: "grpc", grpc: true, affinity: &config.Affinity{Secret: &config.Secret{Env: "SECRET"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Affinity = tt.affinity
+			if tt.grpc {
+				cfg.GRPC = &config.ProtocolCfg{
+					Listen:       "9090",
+					Destinations: map[string]map[string]string{"*": {"euw1": "localhost:9095"}},
+					Affinity:     tt.affinity,
+				}
+				cfg.HTTP.Affinity = nil
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Migrations(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []config.Migration
+		wantErr    bool
+	}{
+		{name: "not configured"},
+		{
+			name: "modes",
+			migrations: []config.Migration{
+				{Key: "alice", From: "euw1", To: "use1", Mode: "shadow"},
+				{Key: "bob", From: "euw1", To: "use1", Mode: "dual"},
+				{Key: "carol", From: "use1", To: "euw1", Mode: "cutover"},
+			},
+		},
+		{name: "missing key", migrations: []config.Migration{{From: "euw1", To: "use1", Mode: "shadow"}}, wantErr: true},
+		{name: "missing to", migrations: []config.Migration{{Key: "alice", From: "euw1", Mode: "shadow"}}, wantErr: true},
+		{
+			name:       "same regions",
+			migrations: []config.Migration{{Key: "alice", From: "euw1", To: "euw1", Mode: "cutover"}},
+			wantErr:    true,
+		},
+		{
+			name:       "unknown mode",
+			migrations: []config.Migration{{Key: "alice", From: "euw1", To: "use1", Mode: "canary"}},
+			wantErr:    true,
+		},
+		{
+			name: "duplicate key",
+			migrations: []config.Migration{
+				{Key: "alice", From: "euw1", To: "use1", Mode: "shadow"},
+				{Key: "alice", From: "euw1", To: "use1", Mode: "cutover"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.Migrations = tt.migrations
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Routes(t *testing.T) {
+	tests := []struct {
+		destinations map[string]map[string]string
+		name         string
+		grpc         bool
+		wantErr      bool
+	}{
+		{
+			name: "parameters, wildcards and regular expressions",
+			destinations: map[string]map[string]string{
+				"/users/{id}/orders":               {"euw1": "http://orders-eu/v2/{id}"},
+				"/users/me/orders":                 {"euw1": "http://orders-eu/v2/me"},
+				"/api/*/health":                    {"euw1": "http://health-eu"},
+				"/tenants/{tenant}/*":              {"euw1": "http://api-eu/{tenant}"},
+				`regex:^/v(?P<version>[0-9]+)/.*$`: {"euw1": "http://api-eu/v{version}"},
+			},
+		},
+		{
+			name: "same parameters with other names",
+			destinations: map[string]map[string]string{
+				"/users/{id}":   {"euw1": "http://users-eu"},
+				"/users/{name}": {"euw1": "http://users-eu"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "parameter and wildcard",
+			destinations: map[string]map[string]string{
+				"/users/{id}/orders": {"euw1": "http://users-eu"},
+				"/users/*/orders":    {"euw1": "http://users-eu"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "match-all twice",
+			destinations: map[string]map[string]string{
+				"*":  {"euw1": "http://api-eu"},
+				"/*": {"euw1": "http://api-eu"},
+			},
+			wantErr: true,
+		},
+		{
+			name:         "partial segment parameter",
+			destinations: map[string]map[string]string{"/users/id-{id}": {"euw1": "http://users-eu"}},
+			wantErr:      true,
+		},
+		{
+			name:         "duplicate parameter",
+			destinations: map[string]map[string]string{"/{id}/{id}": {"euw1": "http://users-eu"}},
+			wantErr:      true,
+		},
+		{
+			name:         "unknown parameter",
+			destinations: map[string]map[string]string{"/users/{id}": {"euw1": "http://users-eu/{user}"}},
+			wantErr:      true,
+		},
+		{
+			name:         "parameter in query",
+			destinations: map[string]map[string]string{"/users/{id}": {"euw1": "http://users-eu/?id={id}"}},
+			wantErr:      true,
+		},
+		{
+			name:         "invalid regular expression",
+			destinations: map[string]map[string]string{"regex:^/(": {"euw1": "http://users-eu"}},
+			wantErr:      true,
+		},
+		{
+			name:         "grpc parameters",
+			grpc:         true,
+			destinations: map[string]map[string]string{"/{service}/Get": {"euw1": "localhost:9095"}},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Destinations = tt.destinations
+			if tt.grpc {
+				cfg.GRPC = &config.ProtocolCfg{Listen: "9090", Destinations: tt.destinations}
+				cfg.HTTP.Destinations = map[string]map[string]string{"*": {"euw1": "http://api-eu"}}
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Hosts(t *testing.T) {
+	users := map[string]map[string]string{"/users/*": {"euw1": "http://users-eu"}}
+	tests := []struct {
+		hosts        map[string]map[string]map[string]string
+		destinations map[string]map[string]string
+		name         string
+		grpc         bool
+		wantErr      bool
+	}{
+		{
+			name:  "exact and wildcard hosts",
+			hosts: map[string]map[string]map[string]string{"api.example.com": users, "*.example.com": users},
+		},
+		{
+			name:         "hosts without destinations",
+			hosts:        map[string]map[string]map[string]string{"api.example.com": users},
+			destinations: map[string]map[string]string{},
+		},
+		{
+			name:    "host with port",
+			hosts:   map[string]map[string]map[string]string{"api.example.com:8080": users},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard in the middle",
+			hosts:   map[string]map[string]map[string]string{"api.*.example.com": users},
+			wantErr: true,
+		},
+		{
+			name:    "bare wildcard",
+			hosts:   map[string]map[string]map[string]string{"*.": users},
+			wantErr: true,
+		},
+		{
+			name:    "empty host group",
+			hosts:   map[string]map[string]map[string]string{"api.example.com": {}},
+			wantErr: true,
+		},
+		{
+			name: "invalid host destination",
+			hosts: map[string]map[string]map[string]string{
+				"api.example.com": {"/users/*": {"euw1": "users-eu"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "grpc hosts",
+			grpc:    true,
+			hosts:   map[string]map[string]map[string]string{"api.example.com": {"/users.Users/*": {"euw1": "localhost:9095"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Hosts = tt.hosts
+			if tt.destinations != nil {
+				cfg.HTTP.Destinations = tt.destinations
+			}
+			if tt.grpc {
+				cfg.HTTP.Hosts = nil
+				cfg.GRPC = &config.ProtocolCfg{
+					Listen:       "9090",
+					Destinations: map[string]map[string]string{"*": {"euw1": "localhost:9095"}},
+					Hosts:        tt.hosts,
+				}
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_PredicateRoutes(t *testing.T) {
+	write := map[string]string{"euw1": "http://write-eu"}
+	tests := []struct {
+		name    string
+		routes  []config.Route
+		grpc    bool
+		wantErr bool
+	}{
+		{
+			name: "predicates on a destination key",
+			routes: []config.Route{
+				{Path: "/", Methods: []string{"POST"}, Destinations: write},
+				{Path: "/", Headers: map[string]string{"X-Api-Version": "2"}, Query: map[string]string{"debug": "*"},
+					Destinations: write},
+			},
+		},
+		{
+			name:   "path without destinations",
+			routes: []config.Route{{Path: "/orders/{id}", Methods: []string{"GET"}, Destinations: write}},
+		},
+		{
+			name:   "host route",
+			routes: []config.Route{{Path: "/*", Host: "*.example.com", Destinations: write}},
+		},
+		{
+			name:    "missing path",
+			routes:  []config.Route{{Methods: []string{"POST"}, Destinations: write}},
+			wantErr: true,
+		},
+		{
+			name:    "missing destinations",
+			routes:  []config.Route{{Path: "/", Methods: []string{"POST"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid destination",
+			routes:  []config.Route{{Path: "/", Destinations: map[string]string{"euw1": "write-eu"}}},
+			wantErr: true,
+		},
+		{
+			name:    "empty header name",
+			routes:  []config.Route{{Path: "/", Headers: map[string]string{"": "2"}, Destinations: write}},
+			wantErr: true,
+		},
+		{
+			name:    "metadata over http",
+			routes:  []config.Route{{Path: "/", Metadata: map[string]string{"version": "2"}, Destinations: write}},
+			wantErr: true,
+		},
+		{
+			name:    "path ambiguous with a destination key",
+			routes:  []config.Route{{Path: "/{id}", Methods: []string{"POST"}, Destinations: write}},
+			wantErr: true,
+		},
+		{
+			name: "grpc metadata",
+			grpc: true,
+			routes: []config.Route{
+				{Path: "/users.Users/*", Metadata: map[string]string{"version": "2"},
+					Destinations: map[string]string{"euw1": "localhost:9096"}},
+			},
+		},
+		{
+			name: "grpc headers",
+			grpc: true,
+			routes: []config.Route{
+				{Path: "/users.Users/*", Headers: map[string]string{"version": "2"},
+					Destinations: map[string]string{"euw1": "localhost:9096"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Destinations["/{name}"] = map[string]string{"euw1": "http://users-eu"}
+			cfg.HTTP.Routes = tt.routes
+			if tt.grpc {
+				cfg.HTTP.Routes = nil
+				cfg.GRPC = &config.ProtocolCfg{
+					Listen:       "9090",
+					Destinations: map[string]map[string]string{"*": {"euw1": "localhost:9095"}},
+					Routes:       tt.routes,
+				}
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Upstreams(t *testing.T) {
+	tests := []struct {
+		upstream config.Upstream
+		name     string
+		dest     string
+		wantErr  bool
+	}{
+		{
+			name: "weighted upstream",
+			upstream: config.Upstream{
+				Policy:    config.BalanceWeighted,
+				Endpoints: []config.Endpoint{{Address: "http://orders-1", Weight: 3}, {Address: "http://orders-2"}},
+			},
+			dest: "upstream:orders",
+		},
+		{
+			name:     "unknown upstream",
+			upstream: config.Upstream{Endpoints: []config.Endpoint{{Address: "http://orders-1"}}},
+			dest:     "upstream:users",
+			wantErr:  true,
+		},
+		{
+			name:     "unknown policy",
+			upstream: config.Upstream{Policy: "random", Endpoints: []config.Endpoint{{Address: "http://orders-1"}}},
+			dest:     "upstream:orders",
+			wantErr:  true,
+		},
+		{
+			name:     "no endpoints",
+			upstream: config.Upstream{Policy: config.BalanceConsistentHash},
+			dest:     "upstream:orders",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid endpoint",
+			upstream: config.Upstream{Endpoints: []config.Endpoint{{Address: "orders-1"}}},
+			dest:     "upstream:orders",
+			wantErr:  true,
+		},
+		{
+			name:     "negative weight",
+			upstream: config.Upstream{Endpoints: []config.Endpoint{{Address: "http://orders-1", Weight: -1}}},
+			dest:     "upstream:orders",
+			wantErr:  true,
+		},
+		{
+			name:     "endpoint with parameters",
+			upstream: config.Upstream{Endpoints: []config.Endpoint{{Address: "http://orders-1/{id}"}}},
+			dest:     "upstream:orders",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Upstreams = map[string]config.Upstream{"orders": tt.upstream}
+			cfg.HTTP.Destinations["/orders/*"] = map[string]string{"euw1": tt.dest}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_HealthCheck(t *testing.T) {
+	tests := []struct {
+		check   *config.HealthCheck
+		name    string
+		grpc    bool
+		wantErr bool
+	}{
+		{
+			name:  "http",
+			check: &config.HealthCheck{Type: config.HealthCheckHTTP, Path: "/healthz", Status: 204, Interval: "5s"},
+		},
+		{name: "tcp", check: &config.HealthCheck{Type: config.HealthCheckTCP, Rise: 1, Fall: 1}},
+		{name: "grpc", grpc: true, check: &config.HealthCheck{Type: config.HealthCheckGRPC, Service: "mock.Mock"}},
+		{name: "unknown type", check: &config.HealthCheck{Type: "icmp"}, wantErr: true},
+		{name: "grpc over http", check: &config.HealthCheck{Type: config.HealthCheckGRPC}, wantErr: true},
+		{name: "http over grpc", grpc: true, check: &config.HealthCheck{Type: config.HealthCheckHTTP}, wantErr: true},
+		{name: "relative path", check: &config.HealthCheck{Type: config.HealthCheckHTTP, Path: "healthz"}, wantErr: true},
+		{name: "invalid status", check: &config.HealthCheck{Type: config.HealthCheckHTTP, Status: 42}, wantErr: true},
+		{name: "invalid interval", check: &config.HealthCheck{Type: config.HealthCheckTCP, Interval: "5"}, wantErr: true},
+		{name: "negative timeout", check: &config.HealthCheck{Type: config.HealthCheckTCP, Timeout: "-1s"}, wantErr: true},
+		{name: "negative fall", check: &config.HealthCheck{Type: config.HealthCheckTCP, Fall: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.HealthCheck = tt.check
+			if tt.grpc {
+				cfg.HTTP.HealthCheck = nil
+				cfg.GRPC = &config.ProtocolCfg{
+					Listen:       "9090",
+					Destinations: map[string]map[string]string{"*": {"euw1": "localhost:9095"}},
+					Upstreams: map[string]config.Upstream{
+						"mock": {Endpoints: []config.Endpoint{{Address: "localhost:9096"}}, HealthCheck: tt.check},
+					},
+				}
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Failover(t *testing.T) {
+	tests := []struct {
+		failover *config.Failover
+		name     string
+		wantErr  bool
+	}{
+		{name: "regions", failover: &config.Failover{Regions: map[string][]string{"euw1": {"euw2", "use1"}}}},
+		{
+			name: "routes",
+			failover: &config.Failover{Routes: map[string]config.RouteFailover{
+				"/":         {Regions: map[string][]string{"euw1": {"use1"}}},
+				"/payments": {DataResidency: true},
+			}},
+		},
+		{name: "no failover regions", failover: &config.Failover{Regions: map[string][]string{"euw1": {}}}, wantErr: true},
+		{name: "empty region", failover: &config.Failover{Regions: map[string][]string{"": {"euw2"}}}, wantErr: true},
+		{name: "itself", failover: &config.Failover{Regions: map[string][]string{"euw1": {"euw1"}}}, wantErr: true},
+		{
+			name:     "duplicate region",
+			failover: &config.Failover{Regions: map[string][]string{"euw1": {"euw2", "euw2"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown route",
+			failover: &config.Failover{Routes: map[string]config.RouteFailover{"/other": {DataResidency: true}}},
+			wantErr:  true,
+		},
+		{
+			name: "data residency with regions",
+			failover: &config.Failover{Routes: map[string]config.RouteFailover{
+				"/": {DataResidency: true, Regions: map[string][]string{"euw1": {"use1"}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "invalid route regions",
+			failover: &config.Failover{Routes: map[string]config.RouteFailover{
+				"/": {Regions: map[string][]string{"euw1": {""}}},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validServiceCfg(&config.RegionRetriever{Type: "static", Static: "euw1"})
+			cfg.HTTP.Routes = []config.Route{
+				{Path: "/payments", Methods: []string{"POST"}, Destinations: map[string]string{"euw1": "http://localhost:8086"}},
+			}
+			cfg.HTTP.Failover = tt.failover
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// MappingRegexPrefix marks a mapping key as a regular expression.
+	MappingRegexPrefix = "regex:"
+	// MappingGlobPrefix marks a mapping key as a glob pattern, see [path.Match].
+	// Keys without a prefix are exact, even when they contain glob characters.
+	MappingGlobPrefix = "glob:"
+	// globChars are the characters that make a glob pattern more than a prefix.
+	globChars = "*?[\\"
+)
+
+// mapping is RegionResolver.Mapping once compiled.
+type mapping struct {
+	exact map[string]string
+	// prefixes is sorted from the longest to the shortest prefix.
+	prefixes []mappingPrefix
+	// patterns is sorted in declaration order.
+	patterns []mappingPattern
+}
+
+type mappingPrefix struct {
+	prefix string
+	region string
+}
+
+type mappingPattern struct {
+	match  func(s string) bool
+	region string
+}
+
+// UnmarshalYAML decodes the resolver and records the declaration order of the mapping keys,
+// which decides the precedence of the patterns.
+func (r *RegionResolver) UnmarshalYAML(value *yaml.Node) error {
+	type plain RegionResolver
+	if err := value.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	r.mappingOrder = nil
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value != "mapping" {
+			continue
+		}
+		entries := value.Content[i+1].Content
+		for j := 0; j+1 < len(entries); j += 2 {
+			r.mappingOrder = append(r.mappingOrder, entries[j].Value)
+		}
+	}
+	return nil
+}
+
+// Map returns the region mapped to value, see RegionResolver.Mapping for the precedence of the keys.
+// Only exact keys are matched until the resolver is compiled.
+func (r *RegionResolver) Map(value string) (string, bool) {
+	if r.mapping == nil {
+		region, ok := r.Mapping[value]
+		return region, ok
+	}
+
+	if region, ok := r.mapping.exact[value]; ok {
+		return region, true
+	}
+	for _, p := range r.mapping.prefixes {
+		if strings.HasPrefix(value, p.prefix) {
+			return p.region, true
+		}
+	}
+	for _, p := range r.mapping.patterns {
+		if p.match(value) {
+			return p.region, true
+		}
+	}
+	return "", false
+}
+
+// compileMapping compiles the keys of Mapping.
+func (r *RegionResolver) compileMapping() (*mapping, error) {
+	m := &mapping{exact: map[string]string{}}
+	for _, key := range r.mappingKeys() {
+		region := r.Mapping[key]
+		switch {
+		case strings.HasPrefix(key, MappingRegexPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(key, MappingRegexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("mapping: invalid regular expression %q: %w", key, err)
+			}
+			m.patterns = append(m.patterns, mappingPattern{match: re.MatchString, region: region})
+		case !strings.HasPrefix(key, MappingGlobPrefix):
+			m.exact[key] = region
+		default:
+			pattern := strings.TrimPrefix(key, MappingGlobPrefix)
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, globChars) {
+				m.prefixes = append(m.prefixes, mappingPrefix{prefix: prefix, region: region})
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("mapping: invalid pattern %q: %w", key, err)
+			}
+			m.patterns = append(m.patterns, mappingPattern{
+				match: func(s string) bool {
+					ok, _ := path.Match(pattern, s)
+					return ok
+				},
+				region: region,
+			})
+		}
+	}
+
+	slices.SortStableFunc(m.prefixes, func(a, b mappingPrefix) int {
+		return cmp.Compare(len(b.prefix), len(a.prefix))
+	})
+	return m, nil
+}
+
+// mappingKeys returns the keys of Mapping in declaration order.
+// Keys whose order is unknown, e.g. when the configuration is not loaded from YAML, are sorted.
+func (r *RegionResolver) mappingKeys() []string {
+	keys := make([]string, 0, len(r.Mapping))
+	seen := make(map[string]bool, len(r.Mapping))
+	for _, key := range r.mappingOrder {
+		if _, ok := r.Mapping[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	var rest []string
+	for key := range r.Mapping {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	slices.Sort(rest)
+	return append(keys, rest...)
+}
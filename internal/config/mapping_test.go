@@ -0,0 +1,84 @@
+package config_test
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+func TestRegionResolver_Map(t *testing.T) {
+	var r config.RegionResolver
+	err := yaml.Unmarshal([]byte(`
+type: map
+mapping:
+  "regex:^europe-west\\d+-[a-z]$": euw
+  "glob:europe-west?-*": shared
+  "glob:eu-west1-*": euw1
+  "glob:eu-*": eu
+  "eu-west1-b": euw1b
+  "us-east1": use1
+  "ap-*": apse1
+`), &r)
+	if err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	if err = r.Compile(); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		want   string
+		wantOk bool
+	}{
+		{name: "exact", value: "us-east1", want: "use1", wantOk: true},
+		{name: "exact before prefix", value: "eu-west1-b", want: "euw1b", wantOk: true},
+		{name: "longest prefix", value: "eu-west1-c", want: "euw1", wantOk: true},
+		{name: "shorter prefix", value: "eu-north1-a", want: "eu", wantOk: true},
+		{name: "regex in declaration order", value: "europe-west4-a", want: "euw", wantOk: true},
+		{name: "glob", value: "europe-west4-ab", want: "shared", wantOk: true},
+		{name: "no match", value: "asia-east1-a"},
+		{name: "glob characters without prefix are exact", value: "ap-*", want: "apse1", wantOk: true},
+		{name: "glob characters without prefix do not match", value: "ap-south1-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Map(tt.value)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Map() got = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestServiceCfg_Validate_Mapping(t *testing.T) {
+	tests := []struct {
+		mapping map[string]string
+		name    string
+		wantErr bool
+	}{
+		{
+			name:    "patterns",
+			mapping: map[string]string{"glob:eu-*": "euw1", "glob:us-east?-[ab]": "use1", "regex:^ap-": "apse1"},
+		},
+		{name: "exact keys with glob characters", mapping: map[string]string{"eu-[": "euw1"}},
+		{name: "invalid regex", mapping: map[string]string{"regex:(": "euw1"}, wantErr: true},
+		{name: "invalid glob", mapping: map[string]string{"glob:eu-[": "euw1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := validRegionResolver()
+			resolver.Mapping = tt.mapping
+			cfg := validServiceCfg(&config.RegionRetriever{
+				Type: "http", URL: "http://localhost", Method: "GET", QueryParam: "id", RegionResolver: resolver,
+			})
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
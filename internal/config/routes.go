@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RouteRegexPrefix marks a destination key as a regular expression matched against the whole entrypoint.
+// Its named groups are parameters of the route.
+const RouteRegexPrefix = "regex:"
+
+var (
+	routeParamName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	routePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+)
+
+// RouteParam reports whether a segment of a destination key matches any segment of the entrypoint,
+// returning the name of the parameter: "{name}" is a named parameter, "*" an unnamed wildcard.
+// A trailing "/*" is not a parameter but marks a prefix route.
+func RouteParam(segment string) (string, bool) {
+	if segment == "*" {
+		return "", true
+	}
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+// routeParams returns the parameters of the destination key route and its shape, which is the key
+// with every parameter replaced by "{}": routes with the same shape match the same entrypoints.
+func routeParams(route string) (params []string, shape string, err error) {
+	if pattern, ok := strings.CutPrefix(route, RouteRegexPrefix); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid regular expression: %w", err)
+		}
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				params = append(params, name)
+			}
+		}
+		return params, route, nil
+	}
+
+	if route == "*" || route == "/*" {
+		return nil, "/*", nil
+	}
+	path, prefix := strings.CutSuffix(route, "/*")
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name, ok := RouteParam(segment)
+		if !ok {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, "", errors.New("invalid segment \"" + segment + "\", parameters must be whole segments")
+			}
+			continue
+		}
+		if segment != "*" {
+			if !routeParamName.MatchString(name) {
+				return nil, "", errors.New("invalid parameter name \"" + name + "\"")
+			}
+			if slices.Contains(params, name) {
+				return nil, "", errors.New("duplicate parameter \"" + name + "\"")
+			}
+			params = append(params, name)
+		}
+		segments[i] = "{}"
+	}
+	shape = strings.Join(segments, "/")
+	if prefix {
+		shape += "/*"
+	}
+	return params, shape, nil
+}
+
+// validateRoutes checks the parameters of the destination keys and the placeholders of their addresses,
+// and rejects the routes matching the same entrypoints.
+func validateRoutes(p Protocol, scope string, destinations map[string]map[string]string) error {
+	routes := make([]string, 0, len(destinations))
+	for route := range destinations {
+		routes = append(routes, route)
+	}
+	slices.Sort(routes)
+
+	shapes := make(map[string]string, len(routes))
+	for _, route := range routes {
+		params, shape, err := routeParams(route)
+		if err != nil {
+			return fmt.Errorf("%s: route %q: %w", scope, route, err)
+		}
+		if p == ProtocolGRPC && (strings.HasPrefix(route, RouteRegexPrefix) || strings.Contains(shape, "{}")) {
+			return errors.New(scope + ": route \"" + route +
+				"\": parameters and regular expressions are only supported by http and graphql")
+		}
+		if other, ok := shapes[shape]; ok {
+			return errors.New(scope + ": routes \"" + other + "\" and \"" + route + "\" are ambiguous")
+		}
+		shapes[shape] = route
+
+		for region, addr := range destinations[route] {
+			if err = validatePlaceholders(addr, params); err != nil {
+				return fmt.Errorf("%s: route %q region %q: %w", scope, route, region, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePlaceholders checks that the placeholders of addr are parameters of the route, used in its path only.
+func validatePlaceholders(addr string, params []string) error {
+	placeholders := routePlaceholder.FindAllStringSubmatch(addr, -1)
+	if len(placeholders) == 0 {
+		return nil
+	}
+	for _, placeholder := range placeholders {
+		if !slices.Contains(params, placeholder[1]) {
+			return errors.New("unknown parameter \"" + placeholder[1] + "\"")
+		}
+	}
+	// a parameter must not choose the host the request is sent to
+	if u, err := url.Parse(addr); err == nil && strings.ContainsAny(u.Host+u.RawQuery+u.Fragment, "{}") {
+		return errors.New("parameters can only be used in the path of \"" + addr + "\"")
+	}
+	return nil
+}
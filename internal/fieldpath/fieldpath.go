@@ -0,0 +1,58 @@
+package fieldpath
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Get returns the value found in m at the given dot notation path (e.g. info.location.region.short_code).
+func Get(m map[string]any, path string) (any, error) {
+	var cur any = m
+	for _, p := range strings.Split(path, ".") {
+		mp, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("value at %s is not a nested object", path)
+		}
+		v, ok := mp[p]
+		if !ok {
+			return nil, fmt.Errorf("no value found at %s", path)
+		}
+		cur = v
+	}
+	return cur, nil
+}
+
+// String is like Get but fails if the value found is not a string.
+func String(m map[string]any, path string) (string, error) {
+	v, err := Get(m, path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("value at %s is not a string (%T)", path, v)
+	}
+	return s, nil
+}
+
+// Set sets value in m at the given dot notation path, creating the intermediate objects when missing.
+func Set(m map[string]any, path string, value any) error {
+	parts := strings.Split(path, ".")
+	cur := m
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p]
+		if !ok {
+			child := map[string]any{}
+			cur[p] = child
+			cur = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not a nested object", p)
+		}
+		cur = child
+	}
+	cur[parts[len(parts)-1]] = value
+	return nil
+}
@@ -0,0 +1,24 @@
+package forwarder
+
+// backend is the backend found for a request in region, one of its failover regions.
+type backend struct {
+	// release frees the endpoint picked from an upstream, see [routing.Upstreams.Resolve].
+	release func()
+	addr    string
+	region  string
+	// next is the index of the failover region tried when the backend is unavailable.
+	next int
+}
+
+// noBackend is returned when no backend is found, its release does nothing.
+var noBackend = backend{release: func() {}}
+
+// failover returns the backend of the first of regions, from index from, that find returns a backend for.
+func failover(regions []string, from int, find func(region string) (string, func(), bool)) (backend, bool) {
+	for i := from; i < len(regions); i++ {
+		if addr, release, ok := find(regions[i]); ok {
+			return backend{release: release, addr: addr, region: regions[i], next: i + 1}, true
+		}
+	}
+	return noBackend, false
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"io"
 	"path"
-	"strings"
 	"sync"
 
 	"google.golang.org/grpc"
@@ -14,14 +13,24 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/CanobbioE/poly-route/internal/auth"
 	"github.com/CanobbioE/poly-route/internal/codec"
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/logger"
 	"github.com/CanobbioE/poly-route/internal/routing"
 )
 
-// MetadataRegionKey is the metadata key used to retrieve the region from the api call.
-const MetadataRegionKey = "poly-route-region"
+// MetadataResolutionKey is the header metadata key reporting that the region was not resolved by the retriever
+// but by an error policy, its value is either [routing.ResolutionDefault] or [routing.ResolutionFallback].
+const MetadataResolutionKey = "poly-route-resolution"
+
+// MetadataBackendRegionKey is the trailer metadata key reporting the region of the backend that served the stream,
+// which differs from the resolved region when the stream failed over to another region, see [config.Failover].
+const MetadataBackendRegionKey = "poly-route-backend-region"
+
+// errUnreachable is returned by forwardGRPCStream when no stream could be opened to the backend,
+// in which case nothing was sent to it and the stream can fail over to another region.
+var errUnreachable = status.Error(codes.Unavailable, "failed to connect to backend")
 
 // framePool is used by forwardStream to reuse slices of bytes to ease GC stress.
 var framePool = sync.Pool{
@@ -37,24 +46,37 @@ type GRPCForwarder struct {
 	regionResolver routing.RegionResolver
 	log            logger.LazyLogger
 	pool           *ConnectionPool
-	routes         []*routing.CompiledRoute
+	routes         *routing.RouteTable
+	upstreams      routing.Upstreams
+	failover       *routing.Failover
+	opts           options
 }
 
 // GRPC creates a new GRPCForwarder with an internal connection pool.
 // Connections are dialed lazily and reused across requests.
-func GRPC(cfg *config.ProtocolCfg, resolver routing.RegionResolver, l logger.LazyLogger) *GRPCForwarder {
+func GRPC(
+	cfg *config.ProtocolCfg,
+	resolver routing.RegionResolver,
+	l logger.LazyLogger,
+	opts ...Option,
+) *GRPCForwarder {
 	pool := NewConnectionPool(
 		// Using insecure credentials: mTLS is assumed to be handled at the service-mesh/infrastructure layer.
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithDefaultCallOptions(grpc.ForceCodec(&codec.PassThrough{})),
 	)
 
+	o := newOptions(config.ProtocolGRPC, opts)
+	o.health.Watch(cfg, pool)
 	return &GRPCForwarder{
 		cfg:            cfg,
 		regionResolver: resolver,
 		log:            l,
 		pool:           pool,
 		routes:         routing.CompileRoutes(cfg, config.ProtocolGRPC),
+		upstreams:      routing.NewUpstreams(cfg.Upstreams, o.health),
+		failover:       routing.NewFailover(cfg.Failover),
+		opts:           o,
 	}
 }
 
@@ -78,31 +100,75 @@ func (x *GRPCForwarder) Handler() grpc.StreamHandler {
 		md, _ := metadata.FromIncomingContext(incomingCtx)
 		outgoingCtx := metadata.NewOutgoingContext(incomingCtx, md.Copy())
 
-		// resolve region from metadata
-		var region string
-		if vals := md.Get(MetadataRegionKey); len(vals) > 0 {
-			region = vals[0]
+		// resolve region from the incoming request
+		req := routing.RequestFromGRPC(incomingCtx, method)
+		req.ClientIP = x.opts.proxies.ClientIP(req)
+		region, err := x.opts.keys.ExtractKey(req)
+		if err != nil {
+			x.log.Error("failed to extract region", "error", err)
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrMissingToken) {
+				return status.Errorf(codes.Unauthenticated, "invalid or missing bearer token")
+			}
+			return status.Errorf(codes.InvalidArgument, "failed to extract region")
 		}
 		if region == "" {
-			x.log.Error("missing region metadata", "key", MetadataRegionKey)
+			x.log.Error("missing region")
 			return status.Errorf(codes.InvalidArgument, "missing region metadata")
 		}
+		req.Key = region
 
-		resolvedRegion, err := x.regionResolver.ResolveRegion(outgoingCtx, region)
+		resolveCtx, resolution := routing.WithResolution(routing.WithRequest(outgoingCtx, req))
+		resolvedRegion, err := x.regionResolver.ResolveRegion(resolveCtx, region)
 		if err != nil {
 			x.log.Error("failed to resolve region", "region", region, "error", err)
 			return status.Errorf(codes.InvalidArgument, "failed to resolve region")
 		}
+		if resolution.Source != "" {
+			x.log.Warn("region resolved by error policy",
+				"source", resolution.Source, "region", resolvedRegion, "cause", resolution.Cause)
+			if err = stream.SetHeader(metadata.Pairs(MetadataResolutionKey, resolution.Source)); err != nil {
+				x.log.Warn("failed to set resolution header", "error", err)
+			}
+		}
 
-		backend, ok := x.FindBackend(method, resolvedRegion)
+		targetRegion, mirrorRegion := x.opts.migrations.Route(region, resolvedRegion)
+		b, ok := x.findBackend(req, targetRegion, 0)
+		defer func() {
+			b.release()
+		}()
 		if !ok {
-			x.log.Error("no backend found for method/region", "method", method, "region", resolvedRegion)
+			x.log.Error("no backend found for method/region", "method", method, "region", targetRegion)
 			return status.Errorf(codes.Unavailable, "no backend for method")
 		}
 
-		if err = x.forwardGRPCStream(outgoingCtx, backend, method, stream); err != nil {
+		// a stream failing over to the mirror region must not be sent twice to it
+		var mirror *grpcMirror
+		if mirrorRegion != "" && mirrorRegion != b.region {
+			mirror = x.startMirror(outgoingCtx, req, mirrorRegion)
+		}
+		if mirror != nil {
+			defer mirror.close()
+		}
+		for {
+			if b.region != targetRegion {
+				x.log.Warn("stream failed over to another region",
+					"method", method, "region", targetRegion, "failover", b.region)
+			}
+			err = x.forwardGRPCStream(outgoingCtx, b.addr, method, stream, mirror)
+			if !errors.Is(err, errUnreachable) {
+				break
+			}
+			next, ok := x.findBackend(req, targetRegion, b.next)
+			if !ok {
+				break
+			}
+			b.release()
+			b = next
+		}
+		stream.SetTrailer(metadata.Pairs(MetadataBackendRegionKey, b.region))
+		if err != nil {
 			// forwardGRPCStream returns gRPC status errors when appropriate.
-			x.log.Error("failed forwarding grpc stream", "method", method, "address", backend, "error", err)
+			x.log.Error("failed forwarding grpc stream", "method", method, "address", b.addr, "error", err)
 			if s, ok := status.FromError(err); ok {
 				return s.Err()
 			}
@@ -112,10 +178,13 @@ func (x *GRPCForwarder) Handler() grpc.StreamHandler {
 	}
 }
 
+// forwardGRPCStream proxies serverStream to backendAddr, and copies the messages it sends to mirror if not nil.
+// It returns errUnreachable if the backend cannot be reached.
 func (x *GRPCForwarder) forwardGRPCStream(
 	ctx context.Context,
 	backendAddr, method string,
 	serverStream grpc.ServerStream,
+	mirror *grpcMirror,
 ) error {
 	lazyLog := x.log.WithLazy("method", method, "address", backendAddr)
 	lazyLog.Info("forwarding grpc stream")
@@ -124,7 +193,7 @@ func (x *GRPCForwarder) forwardGRPCStream(
 	conn, err := x.pool.Get(ctx, backendAddr)
 	if err != nil {
 		x.log.Error("failed getting backend connection", "address", backendAddr, "error", err)
-		return status.Errorf(codes.Unavailable, "failed to connect to backend")
+		return errUnreachable
 	}
 
 	desc := &grpc.StreamDesc{
@@ -138,12 +207,19 @@ func (x *GRPCForwarder) forwardGRPCStream(
 	clientStream, err := conn.NewStream(clientCtx, desc, method)
 	if err != nil {
 		x.log.Error("failed creating backend stream", "method", method, "address", backendAddr, "error", err)
+		if status.Code(err) == codes.Unavailable {
+			return errUnreachable
+		}
 		return status.Errorf(codes.Internal, "failed to create backend stream")
 	}
 
 	// bidirectional copy
+	var backendStream senderReceiver = clientStream
+	if mirror != nil {
+		backendStream = &mirroredStream{ClientStream: clientStream, mirror: mirror}
+	}
 	cli2SrvErrCh := forwardStream(ctx, clientStream, serverStream)
-	srv2CliErrCh := forwardStream(ctx, serverStream, clientStream)
+	srv2CliErrCh := forwardStream(ctx, serverStream, backendStream)
 
 	// run twice to ensure we capture both directions of the stream
 	for range 2 {
@@ -206,55 +282,41 @@ func forwardStream[S senderReceiver, D senderReceiver](ctx context.Context, src
 }
 
 // FindBackend finds a GRPC backend by best match using the GRPCForwarder protocol configuration.
-// The best route is either an exact match with the entrypoint or a wildcard-suffixed match.
-func (x *GRPCForwarder) FindBackend(entrypoint, region string) (string, bool) {
-	for _, r := range x.routes {
-		switch r.Kind {
-		case routing.RouteExact:
-			if r.Prefix != entrypoint {
-				continue
-			}
-		case routing.RoutePrefix:
-			// accept either exact equality or prefix + '/'
-			matchesPrefix := strings.HasPrefix(entrypoint, r.Prefix)
-			matchesPrefixOnceTrailingSlashIsRemoved := strings.HasSuffix(entrypoint, "/") &&
-				entrypoint == r.Prefix[:len(r.Prefix)-1]
-			if !matchesPrefix && !matchesPrefixOnceTrailingSlashIsRemoved {
-				continue
-			}
-			// ensure there is at most one '/' after prefix
-			// compute rest after the logical prefix (strip trailing slash if present)
-			pref := strings.TrimSuffix(r.Prefix, "/")
-			rest := entrypoint[len(pref):]
-			if strings.Count(rest, "/") > 1 {
-				continue
-			}
-		case routing.RouteMatchAll:
-			// always matches
-		}
+// The best route for the method of req is either an exact match or a wildcard-suffixed match,
+// then its metadata selects the mappings of the route, see [routing.CompiledRoute.Select].
+// Upstreams are resolved to one of their endpoints, whose connections are pooled like any other backend.
+// Unhealthy backends are never returned, the failover regions of region are tried instead, see [routing.Failover].
+func (x *GRPCForwarder) FindBackend(req *routing.Request, region string) (string, bool) {
+	b, ok := x.findBackend(req, region, 0)
+	b.release()
+	return b.addr, ok
+}
+
+// findBackend is FindBackend, trying the failover regions of region from index from.
+// The endpoint picked from an upstream is held until the backend is released.
+func (x *GRPCForwarder) findBackend(req *routing.Request, region string, from int) (backend, bool) {
+	m, ok := x.routes.Match(req.Path)
+	if !ok {
+		return noBackend, false
+	}
 
-		dest, ok := r.Mappings[region]
+	mappings := m.Route.Select(req)
+	return failover(x.failover.Regions(m.Route.Key, region), from, func(region string) (string, func(), bool) {
+		dest, ok := mappings[region]
 		if !ok {
-			return "", false
+			return "", nil, false
 		}
-
-		if r.Kind == routing.RouteExact {
-			return dest, true
+		dest, release, ok := x.upstreams.Resolve(dest, req.Key)
+		if !ok || !x.opts.health.Healthy(dest) {
+			release()
+			return "", nil, false
 		}
 
-		// build suffix:
-		// - for prefix matches append the method/name suffix
-		// - for match-all use the full entrypoint
-		suffix := entrypoint
-		if r.Kind == routing.RoutePrefix {
-			pref := strings.TrimSuffix(r.Prefix, "/")
-			suffix = ""
-			if len(entrypoint) > len(pref) {
-				suffix = entrypoint[len(pref):]
-			}
+		if m.Route.Kind == routing.RouteExact {
+			return dest, release, true
 		}
 
-		return path.Join(dest, suffix), true
-	}
-	return "", false
+		// for prefix matches append the method/name suffix, for match-all the full entrypoint
+		return path.Join(dest, m.Suffix), release, true
+	})
 }
@@ -1,11 +1,23 @@
 package forwarder_test
 
 import (
+	"context"
+	"io"
+	"net"
+	"reflect"
 	"testing"
+	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/CanobbioE/poly-route/internal/codec"
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/forwarder"
 	"github.com/CanobbioE/poly-route/internal/logger"
+	"github.com/CanobbioE/poly-route/internal/routing"
+	polyroutev1 "github.com/CanobbioE/poly-route/proto-gen/polyroute/v1"
 )
 
 func TestGRPCForwarder_FindBackend(t *testing.T) {
@@ -110,7 +122,7 @@ func TestGRPCForwarder_FindBackend(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			x := forwarder.GRPC(tt.args.cfg, nil, &logger.NoOpLogger{})
-			got, got1 := x.FindBackend(tt.args.entrypoint, tt.args.region)
+			got, got1 := x.FindBackend(&routing.Request{Path: tt.args.entrypoint}, tt.args.region)
 			if got != tt.want {
 				t.Errorf("grpc.FindBackend() got = '%v', want '%v'", got, tt.want)
 			}
@@ -120,3 +132,290 @@ func TestGRPCForwarder_FindBackend(t *testing.T) {
 		})
 	}
 }
+
+func TestGRPCForwarder_FindBackend_Metadata(t *testing.T) {
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/orders.v1.Orders/Get": {"region": "localhost:9095"},
+		},
+		Routes: []config.Route{
+			{
+				Path:         "/orders.v1.Orders/Get",
+				Metadata:     map[string]string{"X-Api-Version": "2"},
+				Destinations: map[string]string{"region": "localhost:9096"},
+			},
+		},
+	}
+	tests := []struct {
+		md   metadata.MD
+		name string
+		want string
+	}{
+		{name: "no metadata", want: "localhost:9095"},
+		{name: "matching metadata", md: metadata.Pairs("x-api-version", "2"), want: "localhost:9096"},
+		{name: "other metadata", md: metadata.Pairs("x-api-version", "1"), want: "localhost:9095"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := forwarder.GRPC(cfg, nil, &logger.NoOpLogger{})
+			got, _ := x.FindBackend(&routing.Request{Path: "/orders.v1.Orders/Get", Metadata: tt.md}, "region")
+			if got != tt.want {
+				t.Errorf("grpc.FindBackend() got = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+// newGRPCBackend starts a gRPC server answering every method with its region and the request it received.
+// Requests marked as mirrored are reported on mirrored instead.
+func newGRPCBackend(t *testing.T, region string, mirrored chan<- string) string {
+	t.Helper()
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(&codec.PassThrough{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			resp := []byte(region + ":" + string(req))
+			if md, _ := metadata.FromIncomingContext(stream.Context()); len(md[forwarder.MetadataMirrorKey]) > 0 {
+				mirrored <- string(resp)
+			}
+			return stream.SendMsg(&resp)
+		}),
+	)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCForwarder_Handler_Migrations(t *testing.T) {
+	const method = "/test.v1.Service/Call"
+	mirrored := make(chan string, 1)
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{method: {
+			"euw1": newGRPCBackend(t, "euw1", mirrored),
+			"use1": newGRPCBackend(t, "use1", mirrored),
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		mode         string
+		want         string
+		wantMirrored string
+	}{
+		{name: "shadow", mode: config.MigrationShadow, want: "euw1:hello", wantMirrored: "use1:hello"},
+		{name: "dual", mode: config.MigrationDual, want: "use1:hello", wantMirrored: "euw1:hello"},
+		{name: "cutover", mode: config.MigrationCutover, want: "use1:hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations := routing.NewMigrations([]config.Migration{
+				{Key: "alice", From: "euw1", To: "use1", Mode: tt.mode},
+			})
+			fwd := forwarder.GRPC(cfg, &recordingResolver{region: "euw1"}, &logger.NoOpLogger{},
+				forwarder.WithMigrations(migrations))
+			defer func() {
+				_ = fwd.Close()
+			}()
+			proxy := newGRPCProxy(t, fwd)
+
+			conn, err := grpc.NewClient(proxy,
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultCallOptions(grpc.ForceCodec(&codec.PassThrough{})),
+			)
+			if err != nil {
+				t.Fatalf("dial proxy: %v", err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), routing.MetadataRegionKey, "alice")
+			req, resp := []byte("hello"), []byte(nil)
+			if err = conn.Invoke(ctx, method, &req, &resp); err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			}
+			if string(resp) != tt.want {
+				t.Errorf("unexpected response: got %q, want %q", resp, tt.want)
+			}
+			select {
+			case got := <-mirrored:
+				if got != tt.wantMirrored {
+					t.Errorf("unexpected mirrored request: got %q, want %q", got, tt.wantMirrored)
+				}
+			case <-time.After(time.Second):
+				if tt.wantMirrored != "" {
+					t.Errorf("expected a mirrored request to %q", tt.wantMirrored)
+				}
+			}
+		})
+	}
+}
+
+// newGRPCProxy serves fwd and returns its address.
+func newGRPCProxy(t *testing.T, fwd *forwarder.GRPCForwarder) string {
+	t.Helper()
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(&codec.PassThrough{}),
+		grpc.UnknownServiceHandler(fwd.Handler()),
+	)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCForwarder_Handler_Failover(t *testing.T) {
+	const method = "/test.v1.Service/Call"
+	// nothing listens on the address of a closed listener
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closed := lis.Addr().String()
+	_ = lis.Close()
+
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{method: {
+			"euw1": closed,
+			"use1": newGRPCBackend(t, "use1", nil),
+		}},
+		Failover: &config.Failover{Regions: map[string][]string{"euw1": {"use1"}}},
+	}
+	fwd := forwarder.GRPC(cfg, &recordingResolver{region: "euw1"}, &logger.NoOpLogger{})
+	defer func() {
+		_ = fwd.Close()
+	}()
+	proxy := newGRPCProxy(t, fwd)
+
+	conn, err := grpc.NewClient(proxy,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(&codec.PassThrough{})),
+	)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), routing.MetadataRegionKey, "alice")
+	req, resp := []byte("hello"), []byte(nil)
+	var trailer metadata.MD
+	if err = conn.Invoke(ctx, method, &req, &resp, grpc.Trailer(&trailer)); err != nil {
+		t.Fatalf("Invoke() error = %v", err)
+	}
+	if string(resp) != "use1:hello" {
+		t.Errorf("unexpected response: got %q, want %q", resp, "use1:hello")
+	}
+	if got := trailer.Get(forwarder.MetadataBackendRegionKey); len(got) != 1 || got[0] != "use1" {
+		t.Errorf("unexpected backend region: got %v, want [use1]", got)
+	}
+}
+
+// regionService answers every lookup with region and reports the metadata it received on calls.
+type regionService struct {
+	polyroutev1.UnimplementedRegionServiceServer
+	calls  chan metadata.MD
+	region string
+}
+
+func (s *regionService) LookupRegion(
+	ctx context.Context,
+	_ *polyroutev1.LookupRegionRequest,
+) (*polyroutev1.LookupRegionResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.calls <- md
+	return &polyroutev1.LookupRegionResponse{Region: s.region}, nil
+}
+
+func TestGRPCForwarder_Handler_RetrieverMetadata(t *testing.T) {
+	const method = "/test.v1.Service/Call"
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	retriever := &regionService{calls: make(chan metadata.MD, 1), region: "euw1"}
+	server := grpc.NewServer()
+	polyroutev1.RegisterRegionServiceServer(server, retriever)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	tests := []struct {
+		headers map[string]string
+		want    metadata.MD
+		name    string
+	}{
+		{name: "without headers", want: metadata.MD{}},
+		{
+			name:    "with headers",
+			headers: map[string]string{"X-Api-Key": "secret"},
+			want:    metadata.MD{"x-api-key": {"secret"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, err := routing.NewResolver(&config.RegionRetriever{
+				Type:           config.RegionResolverTypeGRPC,
+				Headers:        tt.headers,
+				GRPC:           &config.GRPCRetriever{Address: lis.Addr().String()},
+				RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"euw1": "euw1"}},
+			})
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			defer func() {
+				_ = resolver.(io.Closer).Close()
+			}()
+			cfg := &config.ProtocolCfg{
+				Destinations: map[string]map[string]string{method: {"euw1": newGRPCBackend(t, "euw1", nil)}},
+			}
+			fwd := forwarder.GRPC(cfg, resolver, &logger.NoOpLogger{})
+			defer func() {
+				_ = fwd.Close()
+			}()
+
+			conn, err := grpc.NewClient(newGRPCProxy(t, fwd),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithDefaultCallOptions(grpc.ForceCodec(&codec.PassThrough{})),
+			)
+			if err != nil {
+				t.Fatalf("dial proxy: %v", err)
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(),
+				routing.MetadataRegionKey, "alice", "authorization", "Bearer client-token", "x-client", "app")
+			req, resp := []byte("hello"), []byte(nil)
+			if err = conn.Invoke(ctx, method, &req, &resp); err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			}
+
+			got := <-retriever.calls
+			// keeps the metadata set by the client of the retriever, not by the proxied one
+			for _, key := range []string{":authority", "content-type", "user-agent"} {
+				delete(got, key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("retriever metadata got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,13 @@ package forwarder
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
 
+	"github.com/CanobbioE/poly-route/internal/auth"
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/logger"
 	"github.com/CanobbioE/poly-route/internal/routing"
@@ -15,46 +16,107 @@ import (
 
 type proxyKey string
 
-const targetKey proxyKey = "proxy-target"
-
 const (
-	// HeaderRegionKey is the header key used to retrieve the region from the api call.
-	HeaderRegionKey = "X-Poly-Route-Region"
-	// QueryParamRegionKey is the query parameter key used to retrieve the region from the api call.
-	// Used only if HeaderRegionKey was not specified.
-	QueryParamRegionKey = "region"
+	targetKey  proxyKey = "proxy-target"
+	attemptKey proxyKey = "proxy-attempt"
 )
 
+// HeaderResolutionKey is the response header reporting that the region was not resolved by the retriever
+// but by an error policy, its value is either [routing.ResolutionDefault] or [routing.ResolutionFallback].
+const HeaderResolutionKey = "X-Poly-Route-Resolution"
+
+// HeaderBackendRegionKey is the response header reporting the region of the backend that served the request,
+// which differs from the resolved region when the request failed over to another region, see [config.Failover].
+const HeaderBackendRegionKey = "X-Poly-Route-Backend-Region"
+
 // HTTPForwarder implements a reverse transport proxy for HTTP.
 type HTTPForwarder struct {
 	cfg            *config.ProtocolCfg
 	regionResolver routing.RegionResolver
 	log            logger.LazyLogger
 	proxy          *httputil.ReverseProxy
-	routes         []*routing.CompiledRoute
+	mirrorClient   *http.Client
+	hosts          *routing.VirtualHosts
+	upstreams      routing.Upstreams
+	failover       *routing.Failover
+	opts           options
+}
+
+// attempt is a request being proxied, kept in its context so that it can fail over when its backend is unreachable.
+type attempt struct {
+	r       *http.Request
+	req     *routing.Request
+	region  string
+	backend backend
+	// replayable reports whether r can be sent again, only requests without a body are.
+	replayable bool
 }
 
 // HTTP creates a new HTTPForwarder.
-func HTTP(cfg *config.ProtocolCfg, resolver routing.RegionResolver, l logger.LazyLogger) *HTTPForwarder {
+func HTTP(
+	cfg *config.ProtocolCfg,
+	resolver routing.RegionResolver,
+	l logger.LazyLogger,
+	opts ...Option,
+) *HTTPForwarder {
+	o := newOptions(config.ProtocolHTTP, opts)
+	o.health.Watch(cfg, nil)
 	fwd := &HTTPForwarder{
 		cfg:            cfg,
 		regionResolver: resolver,
 		log:            l,
-		routes:         routing.CompileRoutes(cfg, config.ProtocolHTTP),
+		hosts:          routing.CompileVirtualHosts(cfg, config.ProtocolHTTP),
+		upstreams:      routing.NewUpstreams(cfg.Upstreams, o.health),
+		failover:       routing.NewFailover(cfg.Failover),
+		opts:           o,
 	}
 
-	fwd.proxy = &httputil.ReverseProxy{
-		Director: fwd.director,
-		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-			l.Error("http proxy error", "error", err, "url", r.URL.String())
-			w.WriteHeader(http.StatusBadGateway)
-		},
+	fwd.mirrorClient = &http.Client{
 		Transport: http.DefaultTransport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	fwd.proxy = &httputil.ReverseProxy{
+		Director:     fwd.director,
+		ErrorHandler: fwd.errorHandler,
+		Transport:    http.DefaultTransport,
 	}
 
 	return fwd
 }
 
+// errorHandler sends the request of the failed attempt to the next failover region when its backend is unreachable,
+// or replies with a bad gateway error.
+func (x *HTTPForwarder) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	x.log.Error("http proxy error", "error", err, "url", r.URL.String())
+
+	var opErr *net.OpError
+	a, ok := r.Context().Value(attemptKey).(*attempt)
+	if !ok || !a.replayable || !errors.As(err, &opErr) || opErr.Op != "dial" {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	next, ok := x.findBackend(a.req, a.region, a.backend.next)
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	target, err := url.Parse(next.addr)
+	if err != nil {
+		next.release()
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	x.log.Warn("request failed over to another region",
+		"path", a.r.URL.Path, "region", a.backend.region, "failover", next.region)
+	a.backend.release()
+	a.backend = next
+	w.Header().Set(HeaderBackendRegionKey, next.region)
+	x.proxy.ServeHTTP(w, a.r.WithContext(context.WithValue(r.Context(), targetKey, target)))
+}
+
 func (*HTTPForwarder) director(req *http.Request) {
 	target, ok := req.Context().Value(targetKey).(*url.URL)
 	if !ok {
@@ -78,75 +140,124 @@ func (*HTTPForwarder) director(req *http.Request) {
 // Handler returns a [http.HandlerFunc] that uses a [httputil.ReverseProxy] to forward the incoming request.
 func (x *HTTPForwarder) Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		region := r.Header.Get(HeaderRegionKey)
-		if region == "" {
-			region = r.URL.Query().Get(QueryParamRegionKey)
+		req := routing.RequestFromHTTP(r)
+		req.ClientIP = x.opts.proxies.ClientIP(req)
+		region, err := x.opts.keys.ExtractKey(req)
+		if err != nil {
+			x.log.Error("failed to extract region", "error", err)
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrMissingToken) {
+				http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "failed to extract region", http.StatusBadRequest)
+			return
 		}
 		if region == "" {
-			http.Error(w, "missing region (set "+HeaderRegionKey+" header or ?"+QueryParamRegionKey+"=)", http.StatusBadRequest)
+			http.Error(w, "missing region", http.StatusBadRequest)
 			return
 		}
+		req.Key = region
 
-		resolvedRegion, err := x.regionResolver.ResolveRegion(r.Context(), region)
-		if err != nil {
-			x.log.Error("region resolver failed", "error", err)
-			http.Error(w, "failed to resolve region", http.StatusBadRequest)
-			return
+		// regions chosen by an error policy are not pinned, the next request tries the retriever again
+		resolvedRegion, pinned := x.opts.affinity.Region(r, region)
+		pin := !pinned
+		if !pinned {
+			resolveCtx, resolution := routing.WithResolution(routing.WithRequest(r.Context(), req))
+			resolvedRegion, err = x.regionResolver.ResolveRegion(resolveCtx, region)
+			if err != nil {
+				x.log.Error("region resolver failed", "error", err)
+				http.Error(w, "failed to resolve region", http.StatusBadRequest)
+				return
+			}
+			if resolution.Source != "" {
+				x.log.Warn("region resolved by error policy",
+					"source", resolution.Source, "region", resolvedRegion, "cause", resolution.Cause)
+				w.Header().Set(HeaderResolutionKey, resolution.Source)
+				pin = false
+			}
 		}
 
-		targetAddr, ok := x.FindBackend(r.URL.Path, resolvedRegion)
+		// migrations apply after the affinity, so that changing their mode takes effect immediately
+		targetRegion, mirrorRegion := x.opts.migrations.Route(region, resolvedRegion)
+		a := &attempt{r: r, req: req, region: targetRegion, replayable: r.Body == nil || r.Body == http.NoBody}
+		var ok bool
+		a.backend, ok = x.findBackend(req, targetRegion, 0)
+		defer func() {
+			a.backend.release()
+		}()
 		if !ok {
 			http.Error(w, "no backend found", http.StatusBadGateway)
 			return
 		}
+		if pin {
+			x.opts.affinity.Pin(w, region, resolvedRegion)
+		}
 
-		targetURL, err := url.Parse(targetAddr)
+		targetURL, err := url.Parse(a.backend.addr)
 		if err != nil {
 			http.Error(w, "invalid backend address", http.StatusInternalServerError)
 			return
 		}
+		if a.backend.region != targetRegion {
+			x.log.Warn("request failed over to another region",
+				"path", r.URL.Path, "region", targetRegion, "failover", a.backend.region)
+		}
+		w.Header().Set(HeaderBackendRegionKey, a.backend.region)
+		// a request failing over to the mirror region must not be sent twice to it
+		if mirrorRegion != "" && mirrorRegion != a.backend.region {
+			x.mirror(r, req, mirrorRegion)
+		}
 
-		ctx := context.WithValue(r.Context(), targetKey, targetURL)
-		// targetURL is resolved from a static configuration allow-list in x.cfg.Destinations.
+		ctx := context.WithValue(context.WithValue(r.Context(), attemptKey, a), targetKey, targetURL)
+		// targetURL is resolved from a static configuration allow-list in x.cfg.Destinations and x.cfg.Hosts.
 		// This prevents arbitrary SSRF as only pre-defined backends are reachable.
 		x.proxy.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
 // FindBackend finds an HTTP backend by best match using the HTTPForwarder protocol configuration.
-// The best route is either an exact match with the entrypoint or the longest wild-card-suffixed match.
-func (x *HTTPForwarder) FindBackend(entrypoint, region string) (string, bool) {
-	for _, r := range x.routes {
-		switch r.Kind {
-		case routing.RouteExact:
-			if r.Prefix != entrypoint {
-				continue
-			}
-		case routing.RoutePrefix:
-			// accept either exact equality or prefix + '/'
-			if entrypoint != r.Prefix && !strings.HasPrefix(entrypoint, r.Prefix+"/") {
-				continue
-			}
-		case routing.RouteMatchAll:
-			// always matches
-		}
+// The routes of the host of req are chosen first, see [routing.VirtualHosts.Routes], then matched against its path,
+// see [routing.RouteTable.Match] for the precedence of the routes, and finally against its method, headers
+// and query, see [routing.CompiledRoute.Select]. The parameters of the route are replaced in the backend address.
+// Upstreams are resolved to one of their endpoints, see [routing.Upstreams.Resolve].
+// Unhealthy backends are never returned, the failover regions of region are tried instead, see [routing.Failover].
+func (x *HTTPForwarder) FindBackend(req *routing.Request, region string) (string, bool) {
+	b, ok := x.findBackend(req, region, 0)
+	b.release()
+	return b.addr, ok
+}
+
+// findBackend is FindBackend, trying the failover regions of region from index from.
+// The endpoint picked from an upstream is held until the backend is released.
+func (x *HTTPForwarder) findBackend(req *routing.Request, region string, from int) (backend, bool) {
+	m, ok := x.hosts.Routes(req.Host).Match(req.Path)
+	if !ok {
+		return noBackend, false
+	}
 
-		dest, ok := r.Mappings[region]
+	mappings := m.Route.Select(req)
+	return failover(x.failover.Regions(m.Route.Key, region), from, func(region string) (string, func(), bool) {
+		dest, ok := mappings[region]
 		if !ok {
-			return "", false
+			return "", nil, false
+		}
+		dest, release, ok := x.upstreams.Resolve(dest, req.Key)
+		if !ok || !x.opts.health.Healthy(dest) {
+			release()
+			return "", nil, false
 		}
+		dest = m.Expand(dest)
 
-		if r.Kind == routing.RouteExact {
-			return dest, true
+		if m.Route.Kind == routing.RouteExact || m.Route.Kind == routing.RouteRegex {
+			return dest, release, true
 		}
 
 		// for prefix matches, append the suffix only if present
-		suffix := entrypoint[len(r.Prefix):]
-		if r.Kind == routing.RouteMatchAll {
-			suffix = entrypoint
+		u, err := url.JoinPath(dest, m.Suffix)
+		if err != nil {
+			release()
+			return "", nil, false
 		}
-		u, err := url.JoinPath(dest, suffix)
-		return u, err == nil
-	}
-	return "", false
+		return u, release, true
+	})
 }
@@ -1,16 +1,44 @@
 package forwarder_test
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/CanobbioE/poly-route/internal/auth"
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/forwarder"
 	"github.com/CanobbioE/poly-route/internal/logger"
+	"github.com/CanobbioE/poly-route/internal/routing"
 )
 
 func TestHTTPForwarder_FindBackend(t *testing.T) {
+	hosts := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/*": {"region": "http://default-eu"},
+		},
+		Hosts: map[string]map[string]map[string]string{
+			"api.example.com": {
+				"/*": {"region": "http://api-eu"},
+			},
+			"*.example.com": {
+				"/users/*": {"region": "http://tenants-eu"},
+			},
+			"*.eu.example.com": {
+				"/*": {"region": "http://eu-eu"},
+			},
+		},
+	}
 	type args struct {
 		cfg        *config.ProtocolCfg
+		host       string
 		entrypoint string
 		region     string
 	}
@@ -121,11 +149,208 @@ func TestHTTPForwarder_FindBackend(t *testing.T) {
 			want:  "",
 			want1: false,
 		},
+		{
+			name: "path parameters",
+			args: args{
+				cfg: &config.ProtocolCfg{
+					Destinations: map[string]map[string]string{
+						"/users/{id}/orders": {"region": "http://orders-eu/v2/{id}"},
+					},
+				},
+				entrypoint: "/users/42/orders",
+				region:     "region",
+			},
+			want:  "http://orders-eu/v2/42",
+			want1: true,
+		},
+		{
+			name: "prefix with parameters",
+			args: args{
+				cfg: &config.ProtocolCfg{
+					Destinations: map[string]map[string]string{
+						"/tenants/{tenant}/*": {"region": "http://api-eu/{tenant}/v1"},
+					},
+				},
+				entrypoint: "/tenants/acme/users",
+				region:     "region",
+			},
+			want:  "http://api-eu/acme/v1/users",
+			want1: true,
+		},
+		{
+			name: "regex",
+			args: args{
+				cfg: &config.ProtocolCfg{
+					Destinations: map[string]map[string]string{
+						`regex:^/orders/(?P<year>[0-9]{4})/`: {"region": "http://archive-eu/{year}"},
+					},
+				},
+				entrypoint: "/orders/2024/42",
+				region:     "region",
+			},
+			want:  "http://archive-eu/2024",
+			want1: true,
+		},
+		{
+			name:  "exact host",
+			args:  args{cfg: hosts, host: "api.example.com", entrypoint: "/users/1", region: "region"},
+			want:  "http://api-eu/users/1",
+			want1: true,
+		},
+		{
+			name:  "exact host with port and upper case",
+			args:  args{cfg: hosts, host: "API.example.com:8080", entrypoint: "/users/1", region: "region"},
+			want:  "http://api-eu/users/1",
+			want1: true,
+		},
+		{
+			name:  "wildcard host",
+			args:  args{cfg: hosts, host: "acme.example.com", entrypoint: "/users/1", region: "region"},
+			want:  "http://tenants-eu/1",
+			want1: true,
+		},
+		{
+			name:  "longest wildcard host",
+			args:  args{cfg: hosts, host: "acme.eu.example.com", entrypoint: "/users/1", region: "region"},
+			want:  "http://eu-eu/users/1",
+			want1: true,
+		},
+		{
+			name:  "host group does not fall back to destinations",
+			args:  args{cfg: hosts, host: "acme.example.com", entrypoint: "/orders/1", region: "region"},
+			want:  "",
+			want1: false,
+		},
+		{
+			name:  "wildcard host does not match apex",
+			args:  args{cfg: hosts, host: "example.com", entrypoint: "/users/1", region: "region"},
+			want:  "http://default-eu/users/1",
+			want1: true,
+		},
+		{
+			name:  "unknown host",
+			args:  args{cfg: hosts, host: "other.org", entrypoint: "/users/1", region: "region"},
+			want:  "http://default-eu/users/1",
+			want1: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ht := forwarder.HTTP(tt.args.cfg, nil, &logger.NoOpLogger{})
-			got, got1 := ht.FindBackend(tt.args.entrypoint, tt.args.region)
+			got, got1 := ht.FindBackend(&routing.Request{Host: tt.args.host, Path: tt.args.entrypoint}, tt.args.region)
+			if got != tt.want {
+				t.Errorf("http.FindBackend() got = '%v', want '%v'", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("http.FindBackend() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_FindBackend_Predicates(t *testing.T) {
+	regionOf := func(addr string) map[string]string {
+		return map[string]string{"region": addr}
+	}
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/orders/*": {"region": "http://read-eu"},
+		},
+		Hosts: map[string]map[string]map[string]string{
+			"admin.example.com": {"/*": {"region": "http://admin-eu"}},
+		},
+		Routes: []config.Route{
+			{Path: "/orders/*", Methods: []string{"post", "PUT"}, Destinations: regionOf("http://write-eu")},
+			{Path: "/orders/*", Headers: map[string]string{"x-api-version": "2"}, Destinations: regionOf("http://v2-eu")},
+			{Path: "/orders/*", Query: map[string]string{"debug": "*"}, Destinations: regionOf("http://debug-eu")},
+			{Path: "/reports", Methods: []string{"GET"}, Destinations: regionOf("http://reports-eu")},
+			{
+				Path:         "/*",
+				Host:         "admin.example.com",
+				Headers:      map[string]string{"X-Canary": "*"},
+				Destinations: regionOf("http://admin-canary-eu"),
+			},
+		},
+	}
+	tests := []struct {
+		req   *routing.Request
+		name  string
+		want  string
+		want1 bool
+	}{
+		{
+			name:  "no predicate matches",
+			req:   &routing.Request{Method: http.MethodGet, Path: "/orders/1"},
+			want:  "http://read-eu/1",
+			want1: true,
+		},
+		{
+			name:  "method",
+			req:   &routing.Request{Method: http.MethodPost, Path: "/orders/1"},
+			want:  "http://write-eu/1",
+			want1: true,
+		},
+		{
+			name: "header value",
+			req: &routing.Request{
+				Method: http.MethodGet, Path: "/orders/1", Header: http.Header{"X-Api-Version": {"1", "2"}},
+			},
+			want:  "http://v2-eu/1",
+			want1: true,
+		},
+		{
+			name: "other header value",
+			req: &routing.Request{
+				Method: http.MethodGet, Path: "/orders/1", Header: http.Header{"X-Api-Version": {"3"}},
+			},
+			want:  "http://read-eu/1",
+			want1: true,
+		},
+		{
+			name:  "query presence",
+			req:   &routing.Request{Method: http.MethodGet, Path: "/orders/1", Query: map[string][]string{"debug": {""}}},
+			want:  "http://debug-eu/1",
+			want1: true,
+		},
+		{
+			name: "first matching route wins",
+			req: &routing.Request{
+				Method: http.MethodPut, Path: "/orders/1", Header: http.Header{"X-Api-Version": {"2"}},
+			},
+			want:  "http://write-eu/1",
+			want1: true,
+		},
+		{
+			name:  "route without destinations",
+			req:   &routing.Request{Method: http.MethodGet, Path: "/reports"},
+			want:  "http://reports-eu",
+			want1: true,
+		},
+		{
+			name:  "route without destinations not matching",
+			req:   &routing.Request{Method: http.MethodPost, Path: "/reports"},
+			want:  "",
+			want1: false,
+		},
+		{
+			name: "host route",
+			req: &routing.Request{
+				Method: http.MethodGet, Host: "admin.example.com", Path: "/users", Header: http.Header{"X-Canary": {"1"}},
+			},
+			want:  "http://admin-canary-eu/users",
+			want1: true,
+		},
+		{
+			name:  "host destinations",
+			req:   &routing.Request{Method: http.MethodGet, Host: "admin.example.com", Path: "/users"},
+			want:  "http://admin-eu/users",
+			want1: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ht := forwarder.HTTP(cfg, nil, &logger.NoOpLogger{})
+			got, got1 := ht.FindBackend(tt.req, "region")
 			if got != tt.want {
 				t.Errorf("http.FindBackend() got = '%v', want '%v'", got, tt.want)
 			}
@@ -135,3 +360,405 @@ func TestHTTPForwarder_FindBackend(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPForwarder_FindBackend_Upstreams(t *testing.T) {
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/orders/*": {"region": "upstream:orders"},
+			"/users/*":  {"region": "http://users-eu"},
+		},
+		Upstreams: map[string]config.Upstream{
+			"orders": {Endpoints: []config.Endpoint{{Address: "http://orders-1/v1"}, {Address: "http://orders-2/v1"}}},
+		},
+	}
+	ht := forwarder.HTTP(cfg, nil, &logger.NoOpLogger{})
+	req := &routing.Request{Path: "/orders/42", Key: "user"}
+
+	for _, want := range []string{"http://orders-1/v1/42", "http://orders-2/v1/42", "http://orders-1/v1/42"} {
+		got, ok := ht.FindBackend(req, "region")
+		if got != want || !ok {
+			t.Errorf("http.FindBackend() got = '%v', %v, want '%v', true", got, ok, want)
+		}
+	}
+	if got, _ := ht.FindBackend(&routing.Request{Path: "/users/42"}, "region"); got != "http://users-eu/42" {
+		t.Errorf("http.FindBackend() got = '%v', want '%v'", got, "http://users-eu/42")
+	}
+}
+
+func TestHTTPForwarder_FindBackend_Unhealthy(t *testing.T) {
+	// nothing listens on the address of a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	alive := httptest.NewServer(http.NotFoundHandler())
+	defer alive.Close()
+
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/orders/*": {"region": "upstream:orders"},
+			"/users/*":  {"region": closed.URL},
+		},
+		Upstreams: map[string]config.Upstream{
+			"orders": {Endpoints: []config.Endpoint{{Address: closed.URL}, {Address: alive.URL}}},
+		},
+		HealthCheck: &config.HealthCheck{Type: config.HealthCheckTCP, Interval: "5ms", Fall: 1},
+	}
+	health := routing.NewHealthChecker()
+	defer func() {
+		_ = health.Close()
+	}()
+	ht := forwarder.HTTP(cfg, nil, &logger.NoOpLogger{}, forwarder.WithHealthChecker(health))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for health.Healthy(closed.URL) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Healthy() got = true, want false")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for range 3 {
+		if got, ok := ht.FindBackend(&routing.Request{Path: "/orders/1"}, "region"); got != alive.URL+"/1" || !ok {
+			t.Errorf("http.FindBackend() got = '%v', %v, want '%v', true", got, ok, alive.URL+"/1")
+		}
+	}
+	if got, ok := ht.FindBackend(&routing.Request{Path: "/users/1"}, "region"); ok {
+		t.Errorf("http.FindBackend() got = '%v', true, want no backend", got)
+	}
+}
+
+// recordingResolver maps every param to the same region and records the last param received.
+type recordingResolver struct {
+	param  string
+	region string
+}
+
+func (r *recordingResolver) ResolveRegion(_ context.Context, param string) (string, error) {
+	r.param = param
+	return r.region, nil
+}
+
+func TestHTTPForwarder_Handler_Token(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	verifier, err := auth.NewVerifier(&config.JWT{
+		Claim: "sub",
+		Keys:  []config.JWTKey{{Algorithm: "HS256", Secret: "a-32-bytes-long-hmac-test-secret"}},
+	})
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	keys, err := routing.NewKeyPipeline(nil, config.ProtocolHTTP, verifier)
+	if err != nil {
+		t.Fatalf("new key pipeline: %v", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+	mac := hmac.New(sha256.New, []byte("a-32-bytes-long-hmac-test-secret"))
+	mac.Write([]byte(signed))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		headers   map[string]string
+		name      string
+		wantParam string
+		wantCode  int
+	}{
+		{
+			name:      "claim takes precedence over region header",
+			headers:   map[string]string{"Authorization": "Bearer " + token, routing.HeaderRegionKey: "mallory"},
+			wantCode:  http.StatusOK,
+			wantParam: "alice",
+		},
+		{
+			name:     "invalid token is rejected",
+			headers:  map[string]string{"Authorization": "Bearer " + token + "x"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:      "falls back to region header without token",
+			headers:   map[string]string{routing.HeaderRegionKey: "bob"},
+			wantCode:  http.StatusOK,
+			wantParam: "bob",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &recordingResolver{region: "region"}
+			cfg := &config.ProtocolCfg{
+				Destinations: map[string]map[string]string{"*": {"region": backend.URL}},
+			}
+			handler := forwarder.HTTP(cfg, resolver, &logger.NoOpLogger{}, forwarder.WithKeyExtractor(keys)).Handler()
+
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("unexpected status code: got %d, want %d", rec.Code, tt.wantCode)
+			}
+			if resolver.param != tt.wantParam {
+				t.Errorf("unexpected lookup value: got %q, want %q", resolver.param, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_Handler_ClientIP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	keys, err := routing.NewKeyPipeline(
+		[]config.RegionKeySource{{Type: config.RegionKeyClientIP}}, config.ProtocolHTTP, nil)
+	if err != nil {
+		t.Fatalf("new key pipeline: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		trusted   []string
+		wantParam string
+	}{
+		// httptest requests come from 192.0.2.1
+		{name: "forwarded for is ignored by default", wantParam: "192.0.2.1"},
+		{name: "forwarded for from trusted proxy", trusted: []string{"192.0.2.0/24"}, wantParam: "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := routing.NewTrustedProxies(tt.trusted)
+			if err != nil {
+				t.Fatalf("new trusted proxies: %v", err)
+			}
+			resolver := &recordingResolver{region: "region"}
+			cfg := &config.ProtocolCfg{
+				Destinations: map[string]map[string]string{"*": {"region": backend.URL}},
+			}
+			handler := forwarder.HTTP(cfg, resolver, &logger.NoOpLogger{},
+				forwarder.WithKeyExtractor(keys), forwarder.WithTrustedProxies(proxies)).Handler()
+
+			req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+			req.Header.Set("X-Forwarded-For", "198.51.100.7")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+			}
+			if resolver.param != tt.wantParam {
+				t.Errorf("unexpected lookup value: got %q, want %q", resolver.param, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_Handler_Affinity(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	t.Setenv("AFFINITY_SECRET", "s3cr3t")
+	affinity, err := routing.NewAffinity(&config.Affinity{Secret: &config.Secret{Env: "AFFINITY_SECRET"}})
+	if err != nil {
+		t.Fatalf("new affinity: %v", err)
+	}
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{"*": {"euw1": backend.URL, "use1": backend.URL}},
+	}
+	serve := func(resolver routing.RegionResolver, user string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		handler := forwarder.HTTP(cfg, resolver, &logger.NoOpLogger{}, forwarder.WithAffinity(affinity)).Handler()
+		req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+		req.Header.Set(routing.HeaderRegionKey, user)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := serve(&recordingResolver{region: "euw1"}, "alice", nil)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != config.DefaultAffinityCookie || !cookies[0].HttpOnly {
+		t.Fatalf("unexpected cookies: got %v, want a %s cookie", cookies, config.DefaultAffinityCookie)
+	}
+	pinned := cookies[0]
+	tampered := *pinned
+	tampered.Value = base64.RawURLEncoding.EncodeToString([]byte("use1")) + pinned.Value[len("ZXV3MQ"):]
+
+	tests := []struct {
+		cookie    *http.Cookie
+		name      string
+		user      string
+		wantParam string
+	}{
+		{name: "pinned region skips the resolver", cookie: pinned, user: "alice"},
+		{name: "tampered cookie", cookie: &tampered, user: "alice", wantParam: "alice"},
+		{name: "cookie of another lookup value", cookie: pinned, user: "bob", wantParam: "bob"},
+		{name: "garbage cookie", cookie: &http.Cookie{Name: pinned.Name, Value: "x.y.z"}, user: "alice", wantParam: "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &recordingResolver{region: "use1"}
+			rec := serve(resolver, tt.user, tt.cookie)
+			if rec.Code != http.StatusOK {
+				t.Errorf("unexpected status code: got %d, want %d", rec.Code, http.StatusOK)
+			}
+			if resolver.param != tt.wantParam {
+				t.Errorf("unexpected lookup value: got %q, want %q", resolver.param, tt.wantParam)
+			}
+			if pin := len(rec.Result().Cookies()) == 1; pin != (tt.wantParam != "") {
+				t.Errorf("unexpected cookies: got %v", rec.Result().Cookies())
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_Handler_Migrations(t *testing.T) {
+	mirrored := make(chan string, 1)
+	newBackend := func(region string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get(forwarder.HeaderMirrorKey) != "" {
+				mirrored <- region + ":" + string(body)
+				return
+			}
+			_, _ = io.WriteString(w, region+":"+string(body))
+		}))
+	}
+	euw1, use1 := newBackend("euw1"), newBackend("use1")
+	defer euw1.Close()
+	defer use1.Close()
+
+	tests := []struct {
+		name         string
+		mode         string
+		want         string
+		wantMirrored string
+	}{
+		{name: "shadow", mode: config.MigrationShadow, want: "euw1:hello", wantMirrored: "use1:hello"},
+		{name: "dual", mode: config.MigrationDual, want: "use1:hello", wantMirrored: "euw1:hello"},
+		{name: "cutover", mode: config.MigrationCutover, want: "use1:hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.ProtocolCfg{
+				Destinations: map[string]map[string]string{"*": {"euw1": euw1.URL, "use1": use1.URL}},
+			}
+			migrations := routing.NewMigrations([]config.Migration{
+				{Key: "alice", From: "euw1", To: "use1", Mode: tt.mode},
+			})
+			handler := forwarder.HTTP(cfg, &recordingResolver{region: "euw1"}, &logger.NoOpLogger{},
+				forwarder.WithMigrations(migrations)).Handler()
+
+			req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader("hello"))
+			req.Header.Set(routing.HeaderRegionKey, "alice")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("unexpected response: got %q, want %q", got, tt.want)
+			}
+			select {
+			case got := <-mirrored:
+				if got != tt.wantMirrored {
+					t.Errorf("unexpected mirrored request: got %q, want %q", got, tt.wantMirrored)
+				}
+			case <-time.After(time.Second):
+				if tt.wantMirrored != "" {
+					t.Errorf("expected a mirrored request to %q", tt.wantMirrored)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_Handler_Failover(t *testing.T) {
+	// nothing listens on the address of a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	use1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "use1")
+	}))
+	defer use1.Close()
+
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{
+			"/orders":   {"euw1": closed.URL, "use1": use1.URL},
+			"/payments": {"euw1": closed.URL, "use1": use1.URL},
+		},
+		Failover: &config.Failover{
+			Regions: map[string][]string{"euw1": {"euw2", "use1"}},
+			Routes:  map[string]config.RouteFailover{"/payments": {DataResidency: true}},
+		},
+	}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		want       int
+		wantRegion string
+	}{
+		{name: "failover", method: http.MethodGet, path: "/orders", want: http.StatusOK, wantRegion: "use1"},
+		{name: "data residency", method: http.MethodGet, path: "/payments", want: http.StatusBadGateway, wantRegion: "euw1"},
+		{name: "request body", method: http.MethodPost, path: "/orders", body: "order", want: http.StatusBadGateway,
+			wantRegion: "euw1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := forwarder.HTTP(cfg, &recordingResolver{region: "euw1"}, &logger.NoOpLogger{}).Handler()
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body == "" {
+				req = httptest.NewRequest(tt.method, tt.path, http.NoBody)
+			}
+			req.Header.Set(routing.HeaderRegionKey, "alice")
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("unexpected status code: got %d, want %d", rec.Code, tt.want)
+			}
+			if got := rec.Header().Get(forwarder.HeaderBackendRegionKey); got != tt.wantRegion {
+				t.Errorf("unexpected backend region: got %q, want %q", got, tt.wantRegion)
+			}
+		})
+	}
+}
+
+func TestHTTPForwarder_FindBackend_Failover(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	alive := httptest.NewServer(http.NotFoundHandler())
+	defer alive.Close()
+
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{"/orders": {"euw1": closed.URL, "use1": alive.URL}},
+		HealthCheck:  &config.HealthCheck{Type: config.HealthCheckTCP, Interval: "5ms", Fall: 1},
+		Failover:     &config.Failover{Regions: map[string][]string{"euw1": {"use1"}}},
+	}
+	health := routing.NewHealthChecker()
+	defer func() {
+		_ = health.Close()
+	}()
+	ht := forwarder.HTTP(cfg, nil, &logger.NoOpLogger{}, forwarder.WithHealthChecker(health))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for health.Healthy(closed.URL) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Healthy() got = true, want false")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, ok := ht.FindBackend(&routing.Request{Path: "/orders"}, "euw1"); got != alive.URL || !ok {
+		t.Errorf("http.FindBackend() got = '%v', %v, want '%v', true", got, ok, alive.URL)
+	}
+}
@@ -0,0 +1,188 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+const (
+	// HeaderMirrorKey is the request header marking the copies of the requests mirrored to another region.
+	HeaderMirrorKey = "X-Poly-Route-Mirror"
+	// MetadataMirrorKey is the metadata key marking the copies of the streams mirrored to another region.
+	MetadataMirrorKey = "poly-route-mirror"
+
+	// mirrorTimeout bounds the mirrored requests, which outlive the request they copy.
+	mirrorTimeout = 30 * time.Second
+	// maxMirrorBody is the size of the largest HTTP request body mirrored, larger requests are not mirrored.
+	maxMirrorBody = 10 << 20
+	// mirrorQueueSize is the number of gRPC messages queued for a mirrored stream before it is given up.
+	mirrorQueueSize = 64
+)
+
+// mirror sends a copy of r, described by req, to the backend of region in the background, discarding the response.
+// The body of r is buffered so that it can be sent twice.
+func (x *HTTPForwarder) mirror(r *http.Request, req *routing.Request, region string) {
+	b, ok := x.findBackend(req, region, 0)
+	// mirrored requests never fail over, the other regions might already hold the data
+	if !ok || b.region != region {
+		b.release()
+		x.log.Warn("no backend found for mirrored request", "path", r.URL.Path, "region", region)
+		return
+	}
+	target, err := url.Parse(b.addr)
+	if err != nil {
+		b.release()
+		x.log.Warn("invalid backend address for mirrored request", "address", b.addr, "error", err)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMirrorBody+1))
+	// whatever was read is still forwarded to the target region
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxMirrorBody {
+		b.release()
+		x.log.Warn("request body not mirrored", "path", r.URL.Path, "region", region, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.WithoutCancel(r.Context()), targetKey, target),
+		mirrorTimeout)
+	clone := r.Clone(ctx)
+	clone.RequestURI = ""
+	clone.Body, clone.ContentLength = http.NoBody, int64(len(body))
+	if len(body) > 0 {
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	clone.Header.Set(HeaderMirrorKey, "true")
+	x.director(clone)
+
+	go func() {
+		defer b.release()
+		defer cancel()
+		resp, err := x.mirrorClient.Do(clone)
+		if err != nil {
+			x.log.Warn("mirrored request failed", "url", clone.URL.String(), "error", err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+}
+
+// grpcMirror sends a copy of the messages of a stream to the backend of another region, discarding the responses.
+// Messages are queued so that the mirrored backend never slows down the proxied stream:
+// when the queue is full the mirrored stream is given up.
+type grpcMirror struct {
+	msgs   chan []byte
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+}
+
+// startMirror opens the stream mirroring the call described by req to the backend of region,
+// or returns nil if there is none.
+// The metadata of ctx is copied but not its cancellation, the mirrored stream outlives the proxied one.
+func (x *GRPCForwarder) startMirror(ctx context.Context, req *routing.Request, region string) *grpcMirror {
+	method := req.Path
+	b, ok := x.findBackend(req, region, 0)
+	if !ok || b.region != region {
+		b.release()
+		x.log.Warn("no backend found for mirrored stream", "method", method, "region", region)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mirrorTimeout)
+	ctx = metadata.AppendToOutgoingContext(ctx, MetadataMirrorKey, "true")
+	m := &grpcMirror{msgs: make(chan []byte, mirrorQueueSize), cancel: cancel}
+	go func() {
+		defer b.release()
+		defer cancel()
+		if err := m.run(ctx, x.pool, b.addr, method); err != nil {
+			x.log.Warn("mirrored stream failed", "method", method, "address", b.addr, "error", err)
+		}
+	}()
+	return m
+}
+
+// run sends the queued messages until the queue is closed, then drains the responses.
+func (m *grpcMirror) run(ctx context.Context, pool *ConnectionPool, addr, method string) error {
+	conn, err := pool.Get(ctx, addr)
+	if err != nil {
+		return err
+	}
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method)
+	if err != nil {
+		return err
+	}
+	for msg := range m.msgs {
+		if err = stream.SendMsg(&msg); err != nil {
+			break
+		}
+	}
+	_ = stream.CloseSend()
+	var raw []byte
+	for {
+		if err = stream.RecvMsg(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// send queues a copy of raw, giving up the mirrored stream if the queue is full.
+func (m *grpcMirror) send(raw []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.msgs <- bytes.Clone(raw):
+	default:
+		m.closed = true
+		close(m.msgs)
+		m.cancel()
+	}
+}
+
+// close ends the mirrored stream once the queued messages are sent.
+func (m *grpcMirror) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.msgs)
+	}
+}
+
+// mirroredStream sends the messages to both the proxied stream and its mirror.
+type mirroredStream struct {
+	grpc.ClientStream
+	mirror *grpcMirror
+}
+
+func (s *mirroredStream) SendMsg(msg any) error {
+	if err := s.ClientStream.SendMsg(msg); err != nil {
+		return err
+	}
+	if raw, ok := msg.(*[]byte); ok {
+		s.mirror.send(*raw)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package forwarder
+
+import (
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// Option configures optional behavior shared by all forwarders.
+type Option interface {
+	apply(o *options)
+}
+
+type options struct {
+	keys       routing.KeyExtractor
+	affinity   *routing.Affinity
+	health     *routing.HealthChecker
+	migrations routing.Migrations
+	proxies    routing.TrustedProxies
+}
+
+// newOptions applies opts on top of the defaults for protocol p.
+func newOptions(p config.Protocol, opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.keys == nil {
+		// the default pipeline has no configurable parts and cannot fail
+		o.keys, _ = routing.NewKeyPipeline(nil, p, nil)
+	}
+	return o
+}
+
+type withKeyExtractor struct {
+	keys routing.KeyExtractor
+}
+
+func (w *withKeyExtractor) apply(o *options) {
+	o.keys = w.keys
+}
+
+// WithKeyExtractor specifies how the forwarder reads the region lookup value from the incoming requests.
+// By default, the value is read from the region header or query parameter for HTTP,
+// and from the region metadata key for gRPC.
+func WithKeyExtractor(keys routing.KeyExtractor) Option {
+	return &withKeyExtractor{keys}
+}
+
+type withTrustedProxies struct {
+	proxies routing.TrustedProxies
+}
+
+func (w *withTrustedProxies) apply(o *options) {
+	o.proxies = w.proxies
+}
+
+// WithTrustedProxies specifies the proxies allowed to report the client IP address with X-Forwarded-For.
+// By default, the client IP address is the address of the peer that sent the request.
+func WithTrustedProxies(proxies routing.TrustedProxies) Option {
+	return &withTrustedProxies{proxies}
+}
+
+type withAffinity struct {
+	affinity *routing.Affinity
+}
+
+func (w *withAffinity) apply(o *options) {
+	o.affinity = w.affinity
+}
+
+// WithAffinity pins the region resolved for a client with a signed cookie, see [routing.Affinity].
+// It is ignored by the gRPC forwarder.
+func WithAffinity(affinity *routing.Affinity) Option {
+	return &withAffinity{affinity}
+}
+
+type withMigrations struct {
+	migrations routing.Migrations
+}
+
+func (w *withMigrations) apply(o *options) {
+	o.migrations = w.migrations
+}
+
+// WithMigrations overrides the region resolved for the lookup values being migrated, see [routing.Migrations].
+// Depending on the migration mode, the requests are also mirrored to another region.
+func WithMigrations(migrations routing.Migrations) Option {
+	return &withMigrations{migrations}
+}
+
+type withHealthChecker struct {
+	health *routing.HealthChecker
+}
+
+func (w *withHealthChecker) apply(o *options) {
+	o.health = w.health
+}
+
+// WithHealthChecker makes the forwarder check its backends with health, see [routing.HealthChecker.Watch],
+// and skip the unhealthy ones. By default, backends are not checked and always considered healthy.
+func WithHealthChecker(health *routing.HealthChecker) Option {
+	return &withHealthChecker{health}
+}
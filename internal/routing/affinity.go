@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const defaultAffinityTTL = time.Hour
+
+// Affinity pins the region resolved for a lookup value with a signed cookie,
+// so that the following requests of the same client skip the region resolver.
+// A nil Affinity pins nothing.
+type Affinity struct {
+	// now returns the current time, against which the cookies expire.
+	now    func() time.Time
+	cookie string
+	secret []byte
+	ttl    time.Duration
+	secure bool
+}
+
+// NewAffinity creates an Affinity reading the signing secret defined in cfg.
+func NewAffinity(cfg *config.Affinity) (*Affinity, error) {
+	secret, err := readSecret(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("affinity: %w", err)
+	}
+	ttl := defaultAffinityTTL
+	if cfg.TTL != "" {
+		if ttl, err = time.ParseDuration(cfg.TTL); err != nil {
+			return nil, fmt.Errorf("affinity: invalid ttl %q: %w", cfg.TTL, err)
+		}
+	}
+	return &Affinity{
+		now:    time.Now,
+		secret: []byte(secret),
+		cookie: cmp.Or(cfg.Cookie, config.DefaultAffinityCookie),
+		ttl:    ttl,
+		secure: cfg.Secure,
+	}, nil
+}
+
+// Region returns the region pinned by the cookie of r for the lookup value key.
+// Missing, expired or tampered cookies, and cookies pinned for another lookup value, are ignored.
+func (a *Affinity) Region(r *http.Request, key string) (string, bool) {
+	if a == nil {
+		return "", false
+	}
+	cookie, err := r.Cookie(a.cookie)
+	if err != nil {
+		return "", false
+	}
+
+	// the value is base64(region).expiry.base64(signature)
+	encodedRegion, rest, _ := strings.Cut(cookie.Value, ".")
+	expiry, signature, _ := strings.Cut(rest, ".")
+	regionBytes, err := base64.RawURLEncoding.DecodeString(encodedRegion)
+	if err != nil {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return "", false
+	}
+	region := string(regionBytes)
+	if !hmac.Equal(got, a.sign(key, region, expiry)) {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || a.now().Unix() >= expiresAt {
+		return "", false
+	}
+	return region, region != ""
+}
+
+// Pin sets the cookie pinning region for the lookup value key on the response.
+func (a *Affinity) Pin(w http.ResponseWriter, key, region string) {
+	if a == nil {
+		return
+	}
+	expiry := strconv.FormatInt(a.now().Add(a.ttl).Unix(), 10)
+	value := base64.RawURLEncoding.EncodeToString([]byte(region)) + "." + expiry + "." +
+		base64.RawURLEncoding.EncodeToString(a.sign(key, region, expiry))
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.cookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(a.ttl.Seconds()),
+		Secure:   a.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign returns the signature of the cookie pinning region for key until expiry.
+// The lookup value is signed but not stored, so a cookie cannot be replayed for another lookup value.
+func (a *Affinity) sign(key, region, expiry string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	for _, s := range []string{key, region, expiry} {
+		mac.Write([]byte(s))
+		mac.Write([]byte("\n"))
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,49 @@
+package routing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestAffinity(t *testing.T) {
+	secret := &config.Secret{File: writeFile(t, "secret", []byte("s3cr3t\n"))}
+	tests := []struct {
+		name       string
+		ttl        string
+		wait       time.Duration
+		key        string
+		wantRegion string
+	}{
+		{name: "pinned", key: "alice", wantRegion: "euw1"},
+		{name: "other lookup value", key: "bob"},
+		{name: "expired", ttl: "1m", wait: time.Minute, key: "alice"},
+		{name: "not expired yet", ttl: "1m", wait: time.Minute - time.Second, key: "alice", wantRegion: "euw1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			affinity, err := routing.NewAffinity(&config.Affinity{Secret: secret, Cookie: "region", TTL: tt.ttl})
+			if err != nil {
+				t.Fatalf("NewAffinity() error = %v", err)
+			}
+			now := time.Now()
+			affinity.SetClock(func() time.Time { return now })
+			rec := httptest.NewRecorder()
+			affinity.Pin(rec, "alice", "euw1")
+			now = now.Add(tt.wait)
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			for _, c := range rec.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			got, ok := affinity.Region(req, tt.key)
+			if got != tt.wantRegion || ok != (tt.wantRegion != "") {
+				t.Errorf("Region() got = %v, %v, want %v", got, ok, tt.wantRegion)
+			}
+		})
+	}
+}
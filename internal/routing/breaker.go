@@ -0,0 +1,97 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the retriever while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("region resolver: circuit breaker is open")
+
+// breakerResolver stops calling the wrapped resolver after consecutive transient failures.
+type breakerResolver struct {
+	next RegionResolver
+	// openedAt is the zero time while the circuit is closed.
+	openedAt    time.Time
+	openTimeout time.Duration
+	threshold   int
+	failures    int
+	mu          sync.Mutex
+	// probing is set while a single call checks whether the retriever recovered.
+	probing bool
+}
+
+func newBreakerResolver(next RegionResolver, cfg *config.CircuitBreaker) RegionResolver {
+	openTimeout, err := time.ParseDuration(cfg.OpenTimeout)
+	if err != nil || openTimeout <= 0 {
+		openTimeout = defaultOpenTimeout
+	}
+	threshold := cfg.FailureThreshold
+	if threshold == 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	return &breakerResolver{next: next, openTimeout: openTimeout, threshold: threshold}
+}
+
+func (x *breakerResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	probe, ok := x.allow()
+	if !ok {
+		return "", ErrCircuitOpen
+	}
+
+	region, err := x.next.ResolveRegion(ctx, param)
+	x.record(ctx, probe, err)
+	return region, err
+}
+
+// Close releases the resources held by the wrapped resolver.
+func (x *breakerResolver) Close() error {
+	return closeResolver(x.next)
+}
+
+// allow reports whether a call can be made, and whether it is the one probing an open circuit.
+func (x *breakerResolver) allow() (probe, ok bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.openedAt.IsZero() {
+		return false, true
+	}
+	if x.probing || time.Since(x.openedAt) < x.openTimeout {
+		return false, false
+	}
+	x.probing = true
+	return true, true
+}
+
+func (x *breakerResolver) record(ctx context.Context, probe bool, err error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if probe {
+		x.probing = false
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the call was interrupted by its caller, which says nothing about the retriever
+	case err != nil && isTransient(ctx, err):
+		x.failures++
+		if probe || x.failures >= x.threshold {
+			x.openedAt = time.Now()
+		}
+	default:
+		x.failures = 0
+		x.openedAt = time.Time{}
+	}
+}
@@ -0,0 +1,200 @@
+package routing
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// defaultCacheMaxEntries is used when the cache configuration does not specify a size.
+const defaultCacheMaxEntries = 10_000
+
+// cachedResolver decorates a RegionResolver with an LRU cache.
+// Regions are keyed on the parameter and the attributes of the incoming request they depend on,
+// see config.RegionRetriever.RequestAttributes.
+// Concurrent lookups for the same key are coalesced into a single upstream call.
+// Regions whose TTL expired less than staleTTL ago are served while being refreshed in the background.
+type cachedResolver struct {
+	next        RegionResolver
+	entries     map[string]*list.Element
+	lru         *list.List
+	group       singleflight.Group
+	attributes  []string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	staleTTL    time.Duration
+	maxEntries  int
+	mu          sync.Mutex
+}
+
+type cacheEntry struct {
+	expiresAt time.Time
+	// staleUntil is when the entry is evicted, it is expiresAt for errors.
+	staleUntil time.Time
+	err        error
+	key        string
+	region     string
+}
+
+func newCachedResolver(next RegionResolver, cfg *config.RegionCache, attributes []string) (RegionResolver, error) {
+	ttl, err := time.ParseDuration(cfg.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("region cache: invalid ttl %q: %w", cfg.TTL, err)
+	}
+
+	var negativeTTL time.Duration
+	if cfg.NegativeTTL != "" {
+		negativeTTL, err = time.ParseDuration(cfg.NegativeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("region cache: invalid negative_ttl %q: %w", cfg.NegativeTTL, err)
+		}
+	}
+
+	var staleTTL time.Duration
+	if cfg.StaleTTL != "" {
+		staleTTL, err = time.ParseDuration(cfg.StaleTTL)
+		if err != nil {
+			return nil, fmt.Errorf("region cache: invalid stale_ttl %q: %w", cfg.StaleTTL, err)
+		}
+	}
+
+	maxEntries := cfg.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
+	return &cachedResolver{
+		next:        next,
+		attributes:  attributes,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		staleTTL:    staleTTL,
+		maxEntries:  maxEntries,
+	}, nil
+}
+
+func (x *cachedResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	key := x.key(ctx, param)
+	if entry, ok := x.get(key); ok {
+		if time.Now().After(entry.expiresAt) {
+			// stale, the refresh result is not awaited
+			x.lookup(ctx, key, param)
+		}
+		return entry.region, entry.err
+	}
+
+	ch := x.lookup(ctx, key, param)
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
+
+// key returns the cache key of param for the incoming request stored in ctx.
+func (x *cachedResolver) key(ctx context.Context, param string) string {
+	if len(x.attributes) == 0 {
+		return param
+	}
+	r, ok := RequestFromContext(ctx)
+	var b strings.Builder
+	b.WriteString(param)
+	for _, name := range x.attributes {
+		// NUL cannot be part of the attributes of HTTP requests nor gRPC metadata
+		b.WriteByte(0)
+		if ok {
+			b.WriteString(requestAttribute(r, name))
+		}
+	}
+	return b.String()
+}
+
+// lookup calls the wrapped resolver, unless a call for key is already in flight.
+// The callers sharing a lookup only differ by the attributes of their request that the region does not depend on.
+// The shared lookup must not be cancelled when the caller that started it goes away,
+// every caller still honours its own context while waiting for the result.
+func (x *cachedResolver) lookup(ctx context.Context, key, param string) <-chan singleflight.Result {
+	return x.group.DoChan(key, func() (any, error) {
+		region, err := x.next.ResolveRegion(context.WithoutCancel(ctx), param)
+		x.store(key, region, err)
+		return region, err
+	})
+}
+
+// Close releases the resources held by the cached resolver.
+func (x *cachedResolver) Close() error {
+	return closeResolver(x.next)
+}
+
+func (x *cachedResolver) get(key string) (*cacheEntry, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	elem, ok := x.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.staleUntil) {
+		x.lru.Remove(elem)
+		delete(x.entries, key)
+		return nil, false
+	}
+	x.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (x *cachedResolver) store(key, region string, err error) {
+	ttl := x.ttl
+	if err != nil {
+		// context errors and open circuits say nothing about the param itself, never cache them
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+			errors.Is(err, ErrCircuitOpen) {
+			return
+		}
+		ttl = x.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry := &cacheEntry{key: key, region: region, err: err, expiresAt: time.Now().Add(ttl)}
+	entry.staleUntil = entry.expiresAt
+	if err == nil {
+		entry.staleUntil = entry.expiresAt.Add(x.staleTTL)
+	}
+	if elem, ok := x.entries[key]; ok {
+		if old := elem.Value.(*cacheEntry); err != nil && old.err == nil && time.Now().Before(old.staleUntil) {
+			// a failed refresh keeps serving the stale region
+			return
+		}
+		elem.Value = entry
+		x.lru.MoveToFront(elem)
+		return
+	}
+
+	x.entries[key] = x.lru.PushFront(entry)
+	for x.lru.Len() > x.maxEntries {
+		oldest := x.lru.Back()
+		x.lru.Remove(oldest)
+		delete(x.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
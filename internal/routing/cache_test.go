@@ -0,0 +1,239 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// newCountingServer returns a region retriever that echoes the user_id query parameter
+// as the "country" field and counts how many times it was called.
+func newCountingServer(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(delay)
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newCachedRetriever(url string, cache *config.RegionCache) *config.RegionRetriever {
+	return &config.RegionRetriever{
+		Type:       config.RegionResolverTypeHTTP,
+		URL:        url,
+		Method:     http.MethodGet,
+		QueryParam: "user_id",
+		RegionResolver: &config.RegionResolver{
+			Type:    "map",
+			Field:   "country",
+			Mapping: map[string]string{"alice": "region-A", "bob": "region-B"},
+		},
+		Cache: cache,
+	}
+}
+
+func TestCachedResolver(t *testing.T) {
+	t.Run("hits are served from cache", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m"}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		for range 3 {
+			region, err := rslv.ResolveRegion(context.Background(), "alice")
+			if err != nil {
+				t.Fatalf("unexpected error resolving region: %v", err)
+			}
+			if region != "region-A" {
+				t.Fatalf("unexpected region: %s", region)
+			}
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+	})
+
+	t.Run("entries expire after ttl", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "20ms"}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		_, _ = rslv.ResolveRegion(context.Background(), "alice")
+		time.Sleep(40 * time.Millisecond)
+		_, _ = rslv.ResolveRegion(context.Background(), "alice")
+
+		if got := calls.Load(); got != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("least recently used entry is evicted", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m", MaxEntries: 1}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		for _, param := range []string{"alice", "bob", "alice"} {
+			if _, err = rslv.ResolveRegion(context.Background(), param); err != nil {
+				t.Fatalf("unexpected error resolving region: %v", err)
+			}
+		}
+		if got := calls.Load(); got != 3 {
+			t.Errorf("expected 3 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("negative results are cached", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m", NegativeTTL: "1m"}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		for range 2 {
+			if _, err = rslv.ResolveRegion(context.Background(), "mallory"); err == nil {
+				t.Fatal("expected an error for an unmapped value")
+			}
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+	})
+
+	t.Run("negative results are not cached by default", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m"}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		for range 2 {
+			_, _ = rslv.ResolveRegion(context.Background(), "mallory")
+		}
+		if got := calls.Load(); got != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("concurrent lookups are coalesced", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 50*time.Millisecond)
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m"}))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		const goroutines = 20
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for range goroutines {
+			go func() {
+				defer wg.Done()
+				region, err := rslv.ResolveRegion(context.Background(), "bob")
+				if err != nil {
+					t.Errorf("unexpected error resolving region: %v", err)
+					return
+				}
+				if region != "region-B" {
+					t.Errorf("unexpected region: %s", region)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected 1 upstream call, got %d", got)
+		}
+	})
+
+	t.Run("stale entries are served while refreshing", func(t *testing.T) {
+		var down atomic.Bool
+		var calls atomic.Int64
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+		}))
+		t.Cleanup(srv.Close)
+		cache := &config.RegionCache{TTL: "20ms", NegativeTTL: "1m", StaleTTL: "1m"}
+		rslv, err := routing.NewResolver(newCachedRetriever(srv.URL, cache))
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		_, _ = rslv.ResolveRegion(context.Background(), "alice")
+		down.Store(true)
+		time.Sleep(40 * time.Millisecond)
+
+		for range 3 {
+			region, err := rslv.ResolveRegion(context.Background(), "alice")
+			if err != nil {
+				t.Fatalf("unexpected error resolving region: %v", err)
+			}
+			if region != "region-A" {
+				t.Fatalf("unexpected region: %s", region)
+			}
+			// let the background refresh complete
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := calls.Load(); got != 4 {
+			t.Errorf("expected 4 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("request attributes of the templates are part of the key", func(t *testing.T) {
+		srv, calls := newCountingServer(t, 0)
+		cfg := newCachedRetriever(srv.URL, &config.RegionCache{TTL: "1m"})
+		cfg.QueryParam = ""
+		cfg.QueryParams = map[string]string{"user_id": "{header:X-User}", "lookup": config.ParamPlaceholder}
+		rslv, err := routing.NewResolver(cfg)
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		for _, tt := range []struct{ user, want string }{{"alice", "region-A"}, {"bob", "region-B"}, {"alice", "region-A"}} {
+			ctx := routing.WithRequest(context.Background(), &routing.Request{Header: http.Header{"X-User": {tt.user}}})
+			if got, err := rslv.ResolveRegion(ctx, "anyone"); got != tt.want || err != nil {
+				t.Errorf("ResolveRegion() got = %v, %v, want %v, nil", got, err, tt.want)
+			}
+		}
+		if got := calls.Load(); got != 2 {
+			t.Errorf("expected 2 upstream calls, got %d", got)
+		}
+	})
+
+	t.Run("static resolver", func(t *testing.T) {
+		rslv, err := routing.NewResolver(&config.RegionRetriever{
+			Type:   config.RegionResolverTypeStatic,
+			Static: "region-S",
+			Cache:  &config.RegionCache{TTL: "1m"},
+		})
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+		region, err := rslv.ResolveRegion(context.Background(), "anyone")
+		if err != nil {
+			t.Fatalf("unexpected error resolving region: %v", err)
+		}
+		if region != "region-S" {
+			t.Fatalf("unexpected region: %s", region)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// chainResolver tries its children in order and returns the first region successfully resolved.
+type chainResolver struct {
+	children []RegionResolver
+}
+
+// firstOfResolver races its children concurrently and returns the first region successfully resolved.
+type firstOfResolver struct {
+	children []RegionResolver
+	deadline time.Duration
+}
+
+func newChildren(cfg *config.RegionRetriever, opts ...ResolverOption) ([]RegionResolver, error) {
+	children := make([]RegionResolver, 0, len(cfg.Children))
+	for i, childCfg := range cfg.Children {
+		child, err := NewResolver(childCfg, opts...)
+		if err != nil {
+			_ = closeResolvers(children)
+			return nil, fmt.Errorf("children[%d]: %w", i, err)
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+func newChainResolver(cfg *config.RegionRetriever, opts ...ResolverOption) (RegionResolver, error) {
+	children, err := newChildren(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &chainResolver{children: children}, nil
+}
+
+func newFirstOfResolver(cfg *config.RegionRetriever, opts ...ResolverOption) (RegionResolver, error) {
+	children, err := newChildren(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, err := time.ParseDuration(cfg.Deadline)
+	if err != nil || deadline == 0 {
+		deadline = 3 * time.Second
+	}
+	return &firstOfResolver{children: children, deadline: deadline}, nil
+}
+
+func (x *chainResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	errs := make([]error, 0, len(x.children))
+	for _, child := range x.children {
+		region, err := child.ResolveRegion(ctx, param)
+		if err == nil {
+			return region, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errs = append(errs, err)
+	}
+	return "", fmt.Errorf("region resolver: all chained resolvers failed: %w", errors.Join(errs...))
+}
+
+// Close releases the resources held by the children.
+func (x *chainResolver) Close() error {
+	return closeResolvers(x.children)
+}
+
+type raceResult struct {
+	err    error
+	region string
+}
+
+func (x *firstOfResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, x.deadline)
+	// cancelling stops the children still running once a region has been found
+	defer cancel()
+
+	results := make(chan raceResult, len(x.children))
+	for _, child := range x.children {
+		go func() {
+			region, err := child.ResolveRegion(ctx, param)
+			results <- raceResult{region: region, err: err}
+		}()
+	}
+
+	errs := make([]error, 0, len(x.children))
+	for range x.children {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("region resolver: no resolver succeeded in time: %w", ctx.Err())
+		case res := <-results:
+			if res.err == nil {
+				return res.region, nil
+			}
+			errs = append(errs, res.err)
+		}
+	}
+	return "", fmt.Errorf("region resolver: all raced resolvers failed: %w", errors.Join(errs...))
+}
+
+// Close releases the resources held by the children.
+func (x *firstOfResolver) Close() error {
+	return closeResolvers(x.children)
+}
+
+func closeResolvers(resolvers []RegionResolver) error {
+	errs := make([]error, 0, len(resolvers))
+	for _, r := range resolvers {
+		errs = append(errs, closeResolver(r))
+	}
+	return errors.Join(errs...)
+}
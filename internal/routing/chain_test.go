@@ -0,0 +1,127 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestCompositeResolvers(t *testing.T) {
+	newServer := func(delay time.Duration, mapping map[string]string) *config.RegionRetriever {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+		}))
+		t.Cleanup(srv.Close)
+		return &config.RegionRetriever{
+			Type:       config.RegionResolverTypeHTTP,
+			URL:        srv.URL,
+			Method:     http.MethodGet,
+			QueryParam: "user_id",
+			RegionResolver: &config.RegionResolver{
+				Type:    "map",
+				Field:   "country",
+				Mapping: mapping,
+			},
+		}
+	}
+
+	local := newServer(0, map[string]string{"alice": "region-L"})
+	authoritative := newServer(0, map[string]string{"alice": "region-A", "bob": "region-A"})
+	slow := newServer(time.Second, map[string]string{"alice": "region-S", "bob": "region-S"})
+	static := &config.RegionRetriever{Type: config.RegionResolverTypeStatic, Static: "region-D"}
+
+	tests := []struct {
+		retriever *config.RegionRetriever
+		name      string
+		param     string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name: "chain returns the first success",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeChain,
+				Children: []*config.RegionRetriever{local, authoritative, static},
+			},
+			param: "alice",
+			want:  "region-L",
+		},
+		{
+			name: "chain moves on after a failure",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeChain,
+				Children: []*config.RegionRetriever{local, authoritative, static},
+			},
+			param: "bob",
+			want:  "region-A",
+		},
+		{
+			name: "chain fails when every child fails",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeChain,
+				Children: []*config.RegionRetriever{local, authoritative},
+			},
+			param:   "mallory",
+			wantErr: true,
+		},
+		{
+			name: "first-of returns the fastest success",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeFirstOf,
+				Children: []*config.RegionRetriever{slow, local, authoritative},
+			},
+			param: "bob",
+			want:  "region-A",
+		},
+		{
+			name: "first-of fails after the deadline",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeFirstOf,
+				Deadline: "50ms",
+				Children: []*config.RegionRetriever{slow, local},
+			},
+			param:   "bob",
+			wantErr: true,
+		},
+		{
+			name: "first-of fails when every child fails",
+			retriever: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeFirstOf,
+				Children: []*config.RegionRetriever{local, authoritative},
+			},
+			param:   "mallory",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(tt.retriever)
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+
+			start := time.Now()
+			got, err := rslv.ResolveRegion(context.Background(), tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("ResolveRegion() took %v, slow children should not be awaited", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package routing
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// headerForwardedFor is the header, or metadata key, listing the addresses a request was forwarded for.
+const headerForwardedFor = "X-Forwarded-For"
+
+// TrustedProxies lists the networks of the proxies allowed to report the client address via X-Forwarded-For.
+type TrustedProxies []netip.Prefix
+
+// NewTrustedProxies parses a list of IP addresses or CIDR networks.
+func NewTrustedProxies(networks []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(networks))
+	for _, n := range networks {
+		prefix, err := parsePrefix(n)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", n, err)
+		}
+		proxies = append(proxies, prefix)
+	}
+	return proxies, nil
+}
+
+// parsePrefix parses either a CIDR network or a single IP address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ClientIP returns the address of the client that sent r.
+// X-Forwarded-For is only honoured when the request comes from a trusted proxy:
+// its addresses are walked from the closest hop and the first one that is not a trusted proxy is returned.
+func (t TrustedProxies) ClientIP(r *Request) string {
+	remote := hostOf(r.RemoteAddr)
+	if !t.trusts(remote) {
+		return remote
+	}
+
+	var hops []string
+	if r.Metadata != nil {
+		hops = r.Metadata.Get(headerForwardedFor)
+	} else {
+		hops = r.Header.Values(headerForwardedFor)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addrs := strings.Split(hops[i], ",")
+		for j := len(addrs) - 1; j >= 0; j-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(addrs[j]))
+			if err != nil {
+				// a malformed entry cannot be trusted, neither can anything before it
+				return client
+			}
+			client = addr.Unmap().String()
+			if !t.trusts(client) {
+				return client
+			}
+		}
+	}
+	return client
+}
+
+func (t TrustedProxies) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
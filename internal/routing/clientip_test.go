@@ -0,0 +1,84 @@
+package routing_test
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := routing.NewTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("new trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		req  *routing.Request
+		name string
+		want string
+	}{
+		{
+			name: "direct client",
+			req:  &routing.Request{RemoteAddr: "203.0.113.7:51234"},
+			want: "203.0.113.7",
+		},
+		{
+			name: "forwarded for by untrusted peer",
+			req: &routing.Request{
+				RemoteAddr: "203.0.113.7:51234",
+				Header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name: "forwarded for by trusted proxy",
+			req: &routing.Request{
+				RemoteAddr: "10.1.2.3:51234",
+				Header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "spoofed entries before the first untrusted hop are ignored",
+			req: &routing.Request{
+				RemoteAddr: "10.1.2.3:51234",
+				Header:     http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1", "192.0.2.1"}},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name: "only trusted hops",
+			req: &routing.Request{
+				RemoteAddr: "10.1.2.3:51234",
+				Header:     http.Header{"X-Forwarded-For": {"10.9.9.9"}},
+			},
+			want: "10.9.9.9",
+		},
+		{
+			name: "malformed hop",
+			req: &routing.Request{
+				RemoteAddr: "10.1.2.3:51234",
+				Header:     http.Header{"X-Forwarded-For": {"198.51.100.1, unknown"}},
+			},
+			want: "10.1.2.3",
+		},
+		{
+			name: "grpc metadata",
+			req: &routing.Request{
+				RemoteAddr: "[::ffff:10.1.2.3]:51234",
+				Metadata:   metadata.Pairs("x-forwarded-for", "2001:db8::1"),
+			},
+			want: "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxies.ClientIP(tt.req); got != tt.want {
+				t.Errorf("ClientIP() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package routing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	// DefaultSignatureHeader carries the signature of the requests to the http retriever, see [config.HMACAuth].
+	DefaultSignatureHeader = "X-Poly-Route-Signature"
+	// TimestampHeader carries the unix time at which the request to the http retriever was signed.
+	TimestampHeader = "X-Poly-Route-Timestamp"
+)
+
+// authenticator adds credentials to a request sent to the http retriever, body is the request body.
+type authenticator func(req *http.Request, body []byte)
+
+// newAuthenticator reads the secrets of cfg and returns the matching authenticator.
+func newAuthenticator(cfg *config.RetrieverAuth) (authenticator, error) {
+	switch {
+	case cfg == nil:
+		return func(*http.Request, []byte) {}, nil
+	case cfg.Bearer != nil:
+		token, err := readSecret(cfg.Bearer)
+		if err != nil {
+			return nil, fmt.Errorf("bearer: %w", err)
+		}
+		return func(req *http.Request, _ []byte) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}, nil
+	case cfg.Basic != nil:
+		password, err := readSecret(cfg.Basic.Password)
+		if err != nil {
+			return nil, fmt.Errorf("basic: %w", err)
+		}
+		return func(req *http.Request, _ []byte) {
+			req.SetBasicAuth(cfg.Basic.Username, password)
+		}, nil
+	case cfg.HMAC != nil:
+		return newHMACAuthenticator(cfg.HMAC)
+	default:
+		return nil, errors.New("no authentication method defined")
+	}
+}
+
+func newHMACAuthenticator(cfg *config.HMACAuth) (authenticator, error) {
+	secret, err := readSecret(cfg.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("hmac: %w", err)
+	}
+
+	var newHash func() hash.Hash
+	switch cfg.Algorithm {
+	case "", config.HMACSHA256:
+		newHash = sha256.New
+	case config.HMACSHA512:
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("hmac: unknown algorithm %q", cfg.Algorithm)
+	}
+	header := cfg.Header
+	if header == "" {
+		header = DefaultSignatureHeader
+	}
+
+	return func(req *http.Request, body []byte) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(newHash, []byte(secret))
+		for _, part := range [][]byte{[]byte(req.Method), []byte(req.URL.RequestURI()), []byte(timestamp), body} {
+			mac.Write(part)
+			mac.Write([]byte("\n"))
+		}
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(header, hex.EncodeToString(mac.Sum(nil)))
+	}, nil
+}
+
+// readSecret returns the value of s, without the trailing new line files usually end with.
+func readSecret(s *config.Secret) (string, error) {
+	if s.Env != "" {
+		value, ok := os.LookupEnv(s.Env)
+		if !ok || value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(s.File))
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", s.File)
+	}
+	return value, nil
+}
+
+// newTLSConfig loads the certificates configured in cfg.
+func newTLSConfig(cfg *config.RetrieverTLS) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(filepath.Clean(cfg.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(filepath.Clean(cfg.CertFile), filepath.Clean(cfg.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,196 @@
+package routing_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestHTTPResolver_Auth(t *testing.T) {
+	t.Setenv("RETRIEVER_TOKEN", "s3cr3t")
+	tokenFile := writeFile(t, "token", []byte("from-file\n"))
+	passwordFile := writeFile(t, "password", []byte("hunter2"))
+	hmacFile := writeFile(t, "hmac", []byte("shared"))
+
+	tests := []struct {
+		auth *config.RetrieverAuth
+		// authorized reports whether the retriever accepts r, whose body was already read.
+		authorized func(r *http.Request, body []byte) bool
+		name       string
+		method     string
+	}{
+		{
+			name:   "bearer from env",
+			method: http.MethodGet,
+			auth:   &config.RetrieverAuth{Bearer: &config.Secret{Env: "RETRIEVER_TOKEN"}},
+			authorized: func(r *http.Request, _ []byte) bool {
+				return r.Header.Get("Authorization") == "Bearer s3cr3t"
+			},
+		},
+		{
+			name:   "bearer from file",
+			method: http.MethodGet,
+			auth:   &config.RetrieverAuth{Bearer: &config.Secret{File: tokenFile}},
+			authorized: func(r *http.Request, _ []byte) bool {
+				return r.Header.Get("Authorization") == "Bearer from-file"
+			},
+		},
+		{
+			name:   "basic",
+			method: http.MethodGet,
+			auth: &config.RetrieverAuth{
+				Basic: &config.BasicAuth{Username: "poly-route", Password: &config.Secret{File: passwordFile}},
+			},
+			authorized: func(r *http.Request, _ []byte) bool {
+				user, password, ok := r.BasicAuth()
+				return ok && user == "poly-route" && password == "hunter2"
+			},
+		},
+		{
+			name:   "hmac",
+			method: http.MethodPost,
+			auth:   &config.RetrieverAuth{HMAC: &config.HMACAuth{Secret: &config.Secret{File: hmacFile}}},
+			authorized: func(r *http.Request, body []byte) bool {
+				mac := hmac.New(sha256.New, []byte("shared"))
+				mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + r.Header.Get(routing.TimestampHeader) + "\n"))
+				mac.Write(append(body, '\n'))
+				return r.Header.Get(routing.DefaultSignatureHeader) == hex.EncodeToString(mac.Sum(nil))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if !tt.authorized(r, body) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"country": "alice"})
+			}))
+			defer srv.Close()
+
+			retr := newCachedRetriever(srv.URL, nil)
+			retr.Auth = tt.auth
+			if tt.method == http.MethodPost {
+				retr.Method, retr.QueryParam, retr.BodyParam = http.MethodPost, "", "user_id"
+			}
+			rslv, err := routing.NewResolver(retr, routing.WithHTTPClient(srv.Client()))
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			region, err := rslv.ResolveRegion(context.Background(), "alice")
+			if err != nil {
+				t.Fatalf("ResolveRegion() error = %v", err)
+			}
+			if region != "region-A" {
+				t.Errorf("ResolveRegion() got = %v, want %v", region, "region-A")
+			}
+		})
+	}
+}
+
+func TestHTTPResolver_Auth_MissingSecret(t *testing.T) {
+	retr := newCachedRetriever("http://localhost", nil)
+	retr.Auth = &config.RetrieverAuth{Bearer: &config.Secret{Env: "POLY_ROUTE_UNSET_TOKEN"}}
+	if _, err := routing.NewResolver(retr); err == nil {
+		t.Errorf("NewResolver() error = %v, wantErr %v", err, true)
+	}
+}
+
+// newClientCert returns a self-signed client certificate and its key, PEM encoded.
+func newClientCert(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestHTTPResolver_TLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	certPEM, keyPEM := newClientCert(t)
+	certFile, keyFile := writeFile(t, "client.pem", certPEM), writeFile(t, "client-key.pem", keyPEM)
+
+	tests := []struct {
+		tls     *config.RetrieverTLS
+		name    string
+		wantErr bool
+	}{
+		{name: "mutual tls", tls: &config.RetrieverTLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}},
+		{name: "without client certificate", tls: &config.RetrieverTLS{CAFile: caFile}, wantErr: true},
+		{name: "untrusted server", tls: &config.RetrieverTLS{CertFile: certFile, KeyFile: keyFile}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retr := newCachedRetriever(srv.URL, nil)
+			retr.TLS = tt.tls
+			rslv, err := routing.NewResolver(retr, routing.WithHTTPClient(&http.Client{Timeout: time.Second}))
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			region, err := rslv.ResolveRegion(context.Background(), "alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && region != "region-A" {
+				t.Errorf("ResolveRegion() got = %v, want %v", region, "region-A")
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package routing
+
+import "time"
+
+// SetClock replaces the clock the cookies of a expire against, so that tests can move it forward.
+func (a *Affinity) SetClock(now func() time.Time) {
+	a.now = now
+}
@@ -0,0 +1,65 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/expr-lang/expr"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// evalRegion computes the region by evaluating the expression of cfg against the retriever response,
+// the incoming request stored in ctx and the lookup value.
+// An empty result means that the expression could not map the response to a region.
+func evalRegion(ctx context.Context, cfg *config.RegionResolver, param string, resp map[string]any) (string, error) {
+	program := cfg.Program()
+	if program == nil {
+		return "", errors.New("expression is not compiled")
+	}
+
+	env := map[string]any{"resp": resp, "req": requestEnv(ctx), "param": param}
+	out, err := expr.Run(program, env)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate expression: %w", err)
+	}
+	region, _ := out.(string)
+	if region == "" {
+		return "", fmt.Errorf("%w for %s: expression returned no region", ErrNoMapping, param)
+	}
+	return region, nil
+}
+
+// requestEnv exposes the attributes of the incoming request to expressions, using the first value of
+// multi-valued attributes.
+func requestEnv(ctx context.Context) map[string]any {
+	r, ok := RequestFromContext(ctx)
+	if !ok {
+		return map[string]any{}
+	}
+
+	header := make(map[string]any, len(r.Header))
+	for k := range r.Header {
+		header[k] = r.Header.Get(k)
+	}
+	md := make(map[string]any, len(r.Metadata))
+	for k, v := range r.Metadata {
+		if len(v) > 0 {
+			md[k] = v[0]
+		}
+	}
+	query := make(map[string]any, len(r.Query))
+	for k := range r.Query {
+		query[k] = r.Query.Get(k)
+	}
+
+	return map[string]any{
+		"header":    header,
+		"metadata":  md,
+		"query":     query,
+		"host":      r.Host,
+		"path":      r.Path,
+		"client_ip": r.ClientIP,
+	}
+}
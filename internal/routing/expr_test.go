@@ -0,0 +1,158 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestExprResolver(t *testing.T) {
+	users := map[string]map[string]any{
+		"alice": {"tier": "enterprise", "home_region": "euw1"},
+		"bob":   {"tier": "free", "home_region": "use1"},
+		"carol": {"tier": "enterprise"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(users[r.URL.Query().Get("user_id")])
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		req        *routing.Request
+		name       string
+		expression string
+		param      string
+		want       string
+		wantErr    error
+	}{
+		{
+			name:       "enterprise tier",
+			expression: `resp.tier == "enterprise" ? resp.home_region : "shared-eu"`,
+			param:      "alice",
+			want:       "euw1",
+		},
+		{
+			name:       "shared tier",
+			expression: `resp.tier == "enterprise" ? resp.home_region : "shared-eu"`,
+			param:      "bob",
+			want:       "shared-eu",
+		},
+		{
+			name:       "request attributes",
+			expression: `req.header["X-Canary"] == "true" ? "canary-" + param : resp.home_region`,
+			req:        &routing.Request{Header: http.Header{"X-Canary": {"true"}}},
+			param:      "bob",
+			want:       "canary-bob",
+		},
+		{
+			name:       "without request",
+			expression: `req.header?.["X-Canary"] == "true" ? "canary" : resp.home_region`,
+			param:      "bob",
+			want:       "use1",
+		},
+		{
+			name:       "no region",
+			expression: `resp.home_region ?? ""`,
+			param:      "carol",
+			wantErr:    routing.ErrNoMapping,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retr := &config.RegionRetriever{
+				Type:       config.RegionResolverTypeHTTP,
+				URL:        srv.URL,
+				Method:     http.MethodGet,
+				QueryParam: "user_id",
+				RegionResolver: &config.RegionResolver{
+					Type:       config.RegionResolverTypeExpr,
+					Expression: tt.expression,
+				},
+			}
+			rslv, err := routing.NewResolver(retr)
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+
+			ctx := context.Background()
+			if tt.req != nil {
+				ctx = routing.WithRequest(ctx, tt.req)
+			}
+			got, err := rslv.ResolveRegion(ctx, tt.param)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprResolver_Cache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{})
+	}))
+	defer srv.Close()
+
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type:       config.RegionResolverTypeHTTP,
+		URL:        srv.URL,
+		Method:     http.MethodGet,
+		QueryParam: "user_id",
+		RegionResolver: &config.RegionResolver{
+			Type:       config.RegionResolverTypeExpr,
+			Expression: `req.header["X-Tier"] == "gold" ? "use1" : "euw1"`,
+		},
+		Cache: &config.RegionCache{TTL: "1m"},
+	})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+
+	// both requests send the same lookup value, their region still comes from their own header
+	for _, tt := range []struct{ tier, want string }{{"gold", "use1"}, {"free", "euw1"}, {"gold", "use1"}} {
+		ctx := routing.WithRequest(context.Background(), &routing.Request{Header: http.Header{"X-Tier": {tt.tier}}})
+		if got, err := rslv.ResolveRegion(ctx, "bob"); got != tt.want || err != nil {
+			t.Errorf("ResolveRegion() got = %v, %v, want %v, nil", got, err, tt.want)
+		}
+	}
+}
+
+func TestExprResolver_SQL(t *testing.T) {
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type: config.RegionResolverTypeSQL,
+		SQL: &config.SQLRetriever{
+			Driver: "sqlite",
+			DSN:    newSQLiteDB(t),
+			Query:  "SELECT name, country FROM users WHERE id = ?",
+		},
+		RegionResolver: &config.RegionResolver{
+			Type:       config.RegionResolverTypeExpr,
+			Expression: `resp.country == nil ? "shared-" + lower(resp.name) : resp.country`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+	defer func() {
+		_ = rslv.(io.Closer).Close()
+	}()
+
+	for param, want := range map[string]string{"alice": "eu-west1", "bob": "shared-bob"} {
+		got, err := rslv.ResolveRegion(context.Background(), param)
+		if err != nil {
+			t.Fatalf("ResolveRegion(%s) error = %v", param, err)
+		}
+		if got != want {
+			t.Errorf("ResolveRegion(%s) got = %v, want %v", param, got, want)
+		}
+	}
+}
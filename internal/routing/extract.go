@@ -0,0 +1,243 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CanobbioE/poly-route/internal/auth"
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	// HeaderRegionKey is the default header key used to retrieve the region from the api call.
+	HeaderRegionKey = "X-Poly-Route-Region"
+	// QueryParamRegionKey is the default query parameter key used to retrieve the region from the api call.
+	// Used only if HeaderRegionKey was not specified.
+	QueryParamRegionKey = "region"
+	// MetadataRegionKey is the default metadata key used to retrieve the region from the api call.
+	MetadataRegionKey = "poly-route-region"
+)
+
+// KeyExtractor extracts the value used to resolve the region from an incoming request.
+type KeyExtractor interface {
+	// ExtractKey returns the lookup value found in r, or an empty string if r does not carry one.
+	ExtractKey(r *Request) (string, error)
+}
+
+// KeyPipeline is an ordered list of KeyExtractor, the first non-empty value wins.
+type KeyPipeline []KeyExtractor
+
+// ExtractKey runs every extractor in order and returns the first non-empty value.
+// Extraction stops at the first error.
+func (p KeyPipeline) ExtractKey(r *Request) (string, error) {
+	for _, e := range p {
+		key, err := e.ExtractKey(r)
+		if err != nil {
+			return "", err
+		}
+		if key != "" {
+			return key, nil
+		}
+	}
+	return "", nil
+}
+
+// NewKeyPipeline builds the KeyPipeline for protocol p from the configured sources.
+// When no source is configured, the region is read from HeaderRegionKey and QueryParamRegionKey for HTTP
+// and from MetadataRegionKey for gRPC, preceded by the token claim if verifier is not nil.
+func NewKeyPipeline(sources []config.RegionKeySource, p config.Protocol, verifier *auth.Verifier) (KeyPipeline, error) {
+	if len(sources) == 0 {
+		sources = defaultKeySources(p, verifier != nil)
+	}
+
+	pipeline := make(KeyPipeline, 0, len(sources))
+	for i, src := range sources {
+		e, err := newKeyExtractor(src, p, verifier)
+		if err != nil {
+			return nil, fmt.Errorf("region key %d: %w", i, err)
+		}
+		pipeline = append(pipeline, e)
+	}
+	return pipeline, nil
+}
+
+func defaultKeySources(p config.Protocol, withToken bool) []config.RegionKeySource {
+	var sources []config.RegionKeySource
+	if withToken {
+		sources = append(sources, config.RegionKeySource{Type: config.RegionKeyJWT})
+	}
+	if p == config.ProtocolGRPC {
+		return append(sources, config.RegionKeySource{Type: config.RegionKeyMetadata, Name: MetadataRegionKey})
+	}
+	return append(sources,
+		config.RegionKeySource{Type: config.RegionKeyHeader, Name: HeaderRegionKey},
+		config.RegionKeySource{Type: config.RegionKeyQuery, Name: QueryParamRegionKey},
+	)
+}
+
+func newKeyExtractor(src config.RegionKeySource, p config.Protocol, verifier *auth.Verifier) (KeyExtractor, error) {
+	switch src.Type {
+	case config.RegionKeyHeader:
+		return headerExtractor(src.Name), nil
+	case config.RegionKeyQuery:
+		return queryExtractor(src.Name), nil
+	case config.RegionKeyCookie:
+		return cookieExtractor(src.Name), nil
+	case config.RegionKeyMetadata:
+		return metadataExtractor(strings.ToLower(src.Name)), nil
+	case config.RegionKeyPathSegment:
+		return pathSegmentExtractor(src.Index), nil
+	case config.RegionKeySubdomain:
+		return subdomainExtractor(src.Index), nil
+	case config.RegionKeyPathRegex:
+		return newPathRegexExtractor(src)
+	case config.RegionKeyJWT:
+		if verifier == nil {
+			return nil, errors.New("a token verifier is required for jwt sources")
+		}
+		return &tokenExtractor{verifier: verifier, grpc: p == config.ProtocolGRPC}, nil
+	case config.RegionKeyClientIP:
+		return clientIPExtractor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown region key type: %s", src.Type)
+	}
+}
+
+type headerExtractor string
+
+func (x headerExtractor) ExtractKey(r *Request) (string, error) {
+	return r.Header.Get(string(x)), nil
+}
+
+type queryExtractor string
+
+func (x queryExtractor) ExtractKey(r *Request) (string, error) {
+	return r.Query.Get(string(x)), nil
+}
+
+type cookieExtractor string
+
+func (x cookieExtractor) ExtractKey(r *Request) (string, error) {
+	c, err := (&http.Request{Header: r.Header}).Cookie(string(x))
+	if err != nil {
+		// a missing cookie is not an error, other sources can still be tried
+		return "", nil //nolint:nilerr // see above
+	}
+	return c.Value, nil
+}
+
+type metadataExtractor string
+
+func (x metadataExtractor) ExtractKey(r *Request) (string, error) {
+	if vals := r.Metadata.Get(string(x)); len(vals) > 0 {
+		return vals[0], nil
+	}
+	return "", nil
+}
+
+// clientIPExtractor uses the client IP address as lookup value.
+type clientIPExtractor struct{}
+
+func (clientIPExtractor) ExtractKey(r *Request) (string, error) {
+	return r.ClientIP, nil
+}
+
+// pathSegmentExtractor reads the segment at the given index of the path, negative indexes count from the end.
+type pathSegmentExtractor int
+
+func (x pathSegmentExtractor) ExtractKey(r *Request) (string, error) {
+	segments := strings.Split(strings.Trim(r.Path, "/"), "/")
+	idx := int(x)
+	if idx < 0 {
+		idx += len(segments)
+	}
+	if idx < 0 || idx >= len(segments) {
+		return "", nil
+	}
+	return segments[idx], nil
+}
+
+// subdomainExtractor reads the label at the given index of the Host, only when the host has a subdomain.
+type subdomainExtractor int
+
+func (x subdomainExtractor) ExtractKey(r *Request) (string, error) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return "", nil
+	}
+	labels := strings.Split(host, ".")
+	// the last two labels are the registered domain (e.g. example.com)
+	if int(x) >= len(labels)-2 {
+		return "", nil
+	}
+	return labels[x], nil
+}
+
+type pathRegexExtractor struct {
+	re    *regexp.Regexp
+	group int
+}
+
+func newPathRegexExtractor(src config.RegionKeySource) (KeyExtractor, error) {
+	re, err := regexp.Compile(src.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", src.Pattern, err)
+	}
+
+	x := &pathRegexExtractor{re: re}
+	switch {
+	case src.Group != "":
+		if x.group, err = strconv.Atoi(src.Group); err != nil {
+			x.group = re.SubexpIndex(src.Group)
+		}
+		if x.group < 0 || x.group > re.NumSubexp() {
+			return nil, fmt.Errorf("group %s does not exist in pattern %q", src.Group, src.Pattern)
+		}
+	case re.NumSubexp() > 0:
+		x.group = 1
+	}
+	return x, nil
+}
+
+func (x *pathRegexExtractor) ExtractKey(r *Request) (string, error) {
+	m := x.re.FindStringSubmatch(r.Path)
+	if m == nil {
+		return "", nil
+	}
+	return m[x.group], nil
+}
+
+// tokenExtractor reads the lookup value from the claim of the bearer token in the authorization header.
+type tokenExtractor struct {
+	verifier *auth.Verifier
+	grpc     bool
+}
+
+func (x *tokenExtractor) ExtractKey(r *Request) (string, error) {
+	var authorization string
+	if x.grpc {
+		if vals := r.Metadata.Get("authorization"); len(vals) > 0 {
+			authorization = vals[0]
+		}
+	} else {
+		authorization = r.Header.Get("Authorization")
+	}
+
+	token, ok := auth.BearerToken(authorization)
+	if !ok {
+		if x.verifier.Required() {
+			return "", auth.ErrMissingToken
+		}
+		// the next sources of the pipeline are read instead, their values are chosen by the client
+		return "", nil
+	}
+	return x.verifier.Claim(token)
+}
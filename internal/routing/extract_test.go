@@ -0,0 +1,156 @@
+package routing_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestKeyPipeline_ExtractKey(t *testing.T) {
+	httpReq := &routing.Request{
+		Header: http.Header{
+			"X-Tenant": {"from-header"},
+			"Cookie":   {"session=abc; tenant=from-cookie"},
+		},
+		Query:    url.Values{"tenant": {"from-query"}},
+		Host:     "acme.eu.example.com:8080",
+		Path:     "/tenants/from-path/orders/42",
+		ClientIP: "203.0.113.7",
+	}
+	grpcReq := &routing.Request{
+		Metadata: metadata.Pairs("x-tenant", "from-metadata"),
+		Path:     "/tenants.v1.TenantService/Get",
+	}
+
+	tests := []struct {
+		req     *routing.Request
+		name    string
+		want    string
+		p       config.Protocol
+		sources []config.RegionKeySource
+	}{
+		{
+			name:    "header",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyHeader, Name: "X-Tenant"}},
+			want:    "from-header",
+		},
+		{
+			name:    "query",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyQuery, Name: "tenant"}},
+			want:    "from-query",
+		},
+		{
+			name:    "cookie",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyCookie, Name: "tenant"}},
+			want:    "from-cookie",
+		},
+		{
+			name:    "client ip",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyClientIP}},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "path segment",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyPathSegment, Index: 1}},
+			want:    "from-path",
+		},
+		{
+			name:    "path segment from the end",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyPathSegment, Index: -1}},
+			want:    "42",
+		},
+		{
+			name:    "path segment out of range",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyPathSegment, Index: 10}},
+			want:    "",
+		},
+		{
+			name:    "path regex first group",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyPathRegex, Pattern: `^/tenants/([^/]+)/`}},
+			want:    "from-path",
+		},
+		{
+			name: "path regex named group",
+			req:  httpReq,
+			sources: []config.RegionKeySource{
+				{Type: config.RegionKeyPathRegex, Pattern: `^/tenants/[^/]+/orders/(?P<order>\d+)$`, Group: "order"},
+			},
+			want: "42",
+		},
+		{
+			name:    "subdomain",
+			req:     httpReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeySubdomain}},
+			want:    "acme",
+		},
+		{
+			name:    "subdomain of apex domain",
+			req:     &routing.Request{Host: "example.com"},
+			sources: []config.RegionKeySource{{Type: config.RegionKeySubdomain}},
+			want:    "",
+		},
+		{
+			name: "first non-empty wins",
+			req:  httpReq,
+			sources: []config.RegionKeySource{
+				{Type: config.RegionKeyHeader, Name: "X-Missing"},
+				{Type: config.RegionKeyCookie, Name: "tenant"},
+				{Type: config.RegionKeyHeader, Name: "X-Tenant"},
+			},
+			want: "from-cookie",
+		},
+		{
+			name: "default http sources",
+			req: &routing.Request{
+				Header: http.Header{},
+				Query:  url.Values{routing.QueryParamRegionKey: {"from-query"}},
+			},
+			want: "from-query",
+		},
+		{
+			name:    "metadata",
+			p:       config.ProtocolGRPC,
+			req:     grpcReq,
+			sources: []config.RegionKeySource{{Type: config.RegionKeyMetadata, Name: "X-Tenant"}},
+			want:    "from-metadata",
+		},
+		{
+			name: "default grpc sources",
+			p:    config.ProtocolGRPC,
+			req:  &routing.Request{Metadata: metadata.Pairs(routing.MetadataRegionKey, "from-metadata")},
+			want: "from-metadata",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			if p == "" {
+				p = config.ProtocolHTTP
+			}
+			pipeline, err := routing.NewKeyPipeline(tt.sources, p, nil)
+			if err != nil {
+				t.Fatalf("new key pipeline: %v", err)
+			}
+			got, err := pipeline.ExtractKey(tt.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractKey() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package routing
+
+import (
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// Failover holds the failover regions of the routes of a protocol, see config.Failover.
+// A nil Failover never fails over.
+type Failover struct {
+	regions map[string][]string
+	routes  map[string]config.RouteFailover
+}
+
+// NewFailover returns the Failover defined in cfg, or nil if cfg is nil.
+func NewFailover(cfg *config.Failover) *Failover {
+	if cfg == nil {
+		return nil
+	}
+	return &Failover{regions: cfg.Regions, routes: cfg.Routes}
+}
+
+// Regions returns region followed by the regions to fail over to, in order, for the routes of the destination key.
+// Routes with data residency never fail over.
+func (f *Failover) Regions(key, region string) []string {
+	regions := []string{region}
+	if f == nil {
+		return regions
+	}
+	failover := f.regions[region]
+	if route, ok := f.routes[key]; ok {
+		if route.DataResidency {
+			return regions
+		}
+		if route.Regions != nil {
+			failover = route.Regions[region]
+		}
+	}
+	return append(regions, failover...)
+}
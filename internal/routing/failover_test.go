@@ -0,0 +1,39 @@
+package routing_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestFailover_Regions(t *testing.T) {
+	failover := routing.NewFailover(&config.Failover{
+		Regions: map[string][]string{"euw1": {"euw2", "use1"}},
+		Routes: map[string]config.RouteFailover{
+			"/eu/*":     {Regions: map[string][]string{"euw1": {"euw2"}}},
+			"/payments": {DataResidency: true},
+		},
+	})
+	tests := []struct {
+		failover *routing.Failover
+		name     string
+		key      string
+		region   string
+		want     []string
+	}{
+		{name: "default", failover: failover, key: "/", region: "euw1", want: []string{"euw1", "euw2", "use1"}},
+		{name: "no failover regions", failover: failover, key: "/", region: "use1", want: []string{"use1"}},
+		{name: "route regions", failover: failover, key: "/eu/*", region: "euw1", want: []string{"euw1", "euw2"}},
+		{name: "data residency", failover: failover, key: "/payments", region: "euw1", want: []string{"euw1"}},
+		{name: "no failover", key: "/", region: "euw1", want: []string{"euw1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.failover.Regions(tt.key, tt.region); !slices.Equal(got, tt.want) {
+				t.Errorf("Regions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
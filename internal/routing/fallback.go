@@ -0,0 +1,124 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// ErrNoMapping is returned when the value retrieved for a param has no entry in the region mapping.
+var ErrNoMapping = errors.New("no mapping specified")
+
+const (
+	// ResolutionDefault reports that the default region was used.
+	ResolutionDefault = "default"
+	// ResolutionFallback reports that the fallback resolver was used.
+	ResolutionFallback = "fallback"
+)
+
+// Resolution records how a region was resolved when it did not come from the configured retriever.
+type Resolution struct {
+	// Cause is the error that triggered the policy.
+	Cause error
+	// Source is either empty, ResolutionDefault or ResolutionFallback.
+	Source string
+}
+
+type resolutionKey struct{}
+
+// WithResolution returns a copy of ctx in which resolvers record how the region was resolved.
+func WithResolution(ctx context.Context) (context.Context, *Resolution) {
+	res := &Resolution{}
+	return context.WithValue(ctx, resolutionKey{}, res), res
+}
+
+func recordResolution(ctx context.Context, source string, cause error) {
+	if res, ok := ctx.Value(resolutionKey{}).(*Resolution); ok {
+		res.Source = source
+		res.Cause = cause
+	}
+}
+
+// fallbackResolver applies the configured error policies when the wrapped resolver fails.
+type fallbackResolver struct {
+	next            RegionResolver
+	fallback        RegionResolver
+	defaultRegion   string
+	retrieverPolicy string
+	unmappedPolicy  string
+}
+
+func newFallbackResolver(
+	next RegionResolver,
+	cfg *config.RegionResolver,
+	opts ...ResolverOption,
+) (RegionResolver, error) {
+	x := &fallbackResolver{
+		next:            next,
+		defaultRegion:   cfg.Default,
+		retrieverPolicy: policyOrDefault(cfg, func(p *config.ErrorPolicy) string { return p.Retriever }),
+		unmappedPolicy:  policyOrDefault(cfg, func(p *config.ErrorPolicy) string { return p.Unmapped }),
+	}
+
+	if cfg.Fallback != nil {
+		fallback, err := NewResolver(cfg.Fallback, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+		x.fallback = fallback
+	}
+	return x, nil
+}
+
+func policyOrDefault(cfg *config.RegionResolver, policy func(p *config.ErrorPolicy) string) string {
+	if cfg.OnError != nil && policy(cfg.OnError) != "" {
+		return policy(cfg.OnError)
+	}
+	if cfg.Default != "" {
+		return config.ErrorPolicyDefault
+	}
+	return config.ErrorPolicyReject
+}
+
+// needsFallback reports whether cfg defines any policy other than rejecting the request.
+func needsFallback(cfg *config.RegionResolver) bool {
+	return cfg != nil && (cfg.Default != "" || cfg.OnError != nil)
+}
+
+func (x *fallbackResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	region, err := x.next.ResolveRegion(ctx, param)
+	if err == nil {
+		return region, nil
+	}
+
+	policy := x.retrieverPolicy
+	if errors.Is(err, ErrNoMapping) {
+		policy = x.unmappedPolicy
+	}
+
+	switch policy {
+	case config.ErrorPolicyDefault:
+		recordResolution(ctx, ResolutionDefault, err)
+		return x.defaultRegion, nil
+	case config.ErrorPolicyFallback:
+		region, fallbackErr := x.fallback.ResolveRegion(ctx, param)
+		if fallbackErr != nil {
+			return "", fmt.Errorf("region resolver: fallback failed: %w (after: %w)", fallbackErr, err)
+		}
+		recordResolution(ctx, ResolutionFallback, err)
+		return region, nil
+	default:
+		return "", err
+	}
+}
+
+// Close releases the resources held by both the wrapped and the fallback resolvers.
+func (x *fallbackResolver) Close() error {
+	err := closeResolver(x.next)
+	if x.fallback != nil {
+		err = errors.Join(err, closeResolver(x.fallback))
+	}
+	return err
+}
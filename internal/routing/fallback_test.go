@@ -0,0 +1,120 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestFallbackResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("user_id")
+		if key == "broken" {
+			_, _ = w.Write([]byte("not json"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": key})
+	}))
+	defer srv.Close()
+
+	newRetriever := func(resolver *config.RegionResolver) *config.RegionRetriever {
+		resolver.Type = "map"
+		resolver.Field = "country"
+		resolver.Mapping = map[string]string{"alice": "region-A"}
+		return &config.RegionRetriever{
+			Type:           config.RegionResolverTypeHTTP,
+			URL:            srv.URL,
+			Method:         http.MethodGet,
+			QueryParam:     "user_id",
+			RegionResolver: resolver,
+		}
+	}
+	fallback := &config.RegionRetriever{Type: config.RegionResolverTypeStatic, Static: "region-F"}
+
+	tests := []struct {
+		resolver       *config.RegionResolver
+		name           string
+		param          string
+		want           string
+		wantResolution string
+		wantErr        bool
+		wantNoMapping  bool
+	}{
+		{
+			name:     "resolved by the retriever",
+			resolver: &config.RegionResolver{Default: "region-D"},
+			param:    "alice",
+			want:     "region-A",
+		},
+		{
+			name:           "default on unmapped value",
+			resolver:       &config.RegionResolver{Default: "region-D"},
+			param:          "bob",
+			want:           "region-D",
+			wantResolution: routing.ResolutionDefault,
+		},
+		{
+			name:           "default on retriever error",
+			resolver:       &config.RegionResolver{Default: "region-D"},
+			param:          "broken",
+			want:           "region-D",
+			wantResolution: routing.ResolutionDefault,
+		},
+		{
+			name: "reject unmapped, fallback on retriever error",
+			resolver: &config.RegionResolver{
+				Default:  "region-D",
+				Fallback: fallback,
+				OnError:  &config.ErrorPolicy{Retriever: config.ErrorPolicyFallback, Unmapped: config.ErrorPolicyReject},
+			},
+			param:         "bob",
+			wantErr:       true,
+			wantNoMapping: true,
+		},
+		{
+			name: "fallback on retriever error",
+			resolver: &config.RegionResolver{
+				Fallback: fallback,
+				OnError:  &config.ErrorPolicy{Retriever: config.ErrorPolicyFallback},
+			},
+			param:          "broken",
+			want:           "region-F",
+			wantResolution: routing.ResolutionFallback,
+		},
+		{
+			name:     "reject by default",
+			resolver: &config.RegionResolver{},
+			param:    "broken",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(newRetriever(tt.resolver))
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+
+			ctx, resolution := routing.WithResolution(context.Background())
+			region, err := rslv.ResolveRegion(ctx, tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantNoMapping && !errors.Is(err, routing.ErrNoMapping) {
+				t.Errorf("ResolveRegion() error = %v, want ErrNoMapping", err)
+			}
+			if region != tt.want {
+				t.Errorf("unexpected region: got %q, want %q", region, tt.want)
+			}
+			if resolution.Source != tt.wantResolution {
+				t.Errorf("unexpected resolution: got %q, want %q", resolution.Source, tt.wantResolution)
+			}
+		})
+	}
+}
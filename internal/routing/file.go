@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// fileReloadDelay groups the events of a single change, e.g. an editor truncating then writing the file.
+const fileReloadDelay = 100 * time.Millisecond
+
+// newFileResolver returns a snapshot resolver reading its table from a file, reloaded whenever the file changes.
+// The file must be valid when the resolver is created, later invalid versions keep the previous table.
+func newFileResolver(cfg *config.RegionRetriever, opts ...ResolverOption) (RegionResolver, error) {
+	table := &config.SnapshotRetriever{
+		File:         cfg.File.Path,
+		Format:       cfg.File.Format,
+		KeyColumn:    cfg.File.KeyColumn,
+		RegionColumn: cfg.File.RegionColumn,
+	}
+	x := &snapshotResolver{
+		cfg:          table,
+		resolverCfg:  cfg.RegionResolver,
+		stop:         make(chan struct{}),
+		format:       snapshotFormat(table),
+		keyColumn:    cmp.Or(table.KeyColumn, defaultSnapshotKeyColumn),
+		regionColumn: cmp.Or(table.RegionColumn, defaultSnapshotRegionColumn),
+	}
+
+	if err := x.reload(); err != nil {
+		return nil, fmt.Errorf("region resolver: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: watch %s: %w", table.File, err)
+	}
+	// watching the directory also catches files replaced by a rename,
+	// e.g. editors saving atomically or Kubernetes updating a mounted ConfigMap
+	if err = watcher.Add(filepath.Dir(table.File)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("region resolver: watch %s: %w", table.File, err)
+	}
+	x.watcher = watcher
+
+	// applied last, so that the monitor only knows the resolvers that were created
+	for _, option := range opts {
+		option.apply(x)
+	}
+	go x.watch()
+	return x, nil
+}
+
+// watch reloads the table when the directory of the file changes, until the resolver is closed.
+// A failed reload keeps the previous table.
+func (x *snapshotResolver) watch() {
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-x.stop:
+			return
+		case event, ok := <-x.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op != fsnotify.Chmod {
+				reload = time.After(fileReloadDelay)
+			}
+		case err, ok := <-x.watcher.Errors:
+			if !ok {
+				return
+			}
+			msg := err.Error()
+			x.lastErr.Store(&msg)
+		case <-reload:
+			reload = nil
+			_ = x.reload()
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestFileResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		format  string
+		data    string
+		param   string
+		want    string
+		wantErr error
+	}{
+		{name: "yaml object", file: "users.yaml", data: "alice: euw1\nbob: use1\n", param: "bob", want: "use1"},
+		{
+			name:  "yaml array",
+			file:  "users.yml",
+			data:  "- key: alice\n  region: euw1\n- key: bob\n  region: use1\n",
+			param: "alice",
+			want:  "euw1",
+		},
+		{name: "json", file: "users.json", data: `{"alice": "euw1"}`, param: "alice", want: "euw1"},
+		{name: "csv", file: "users", format: "csv", data: "key,region\nalice,euw1\n", param: "alice", want: "euw1"},
+		{name: "missing value", file: "users.yaml", data: "alice: euw1\n", param: "bob", wantErr: routing.ErrNoMapping},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(&config.RegionRetriever{
+				Type: config.RegionResolverTypeFile,
+				File: &config.FileRetriever{Path: writeFile(t, tt.file, []byte(tt.data)), Format: tt.format},
+			})
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			defer func() {
+				_ = rslv.(io.Closer).Close()
+			}()
+
+			got, err := rslv.ResolveRegion(context.Background(), tt.param)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileResolver_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+	}{
+		{name: "malformed yaml", file: "users.yaml", data: "alice: [euw1"},
+		{name: "empty yaml", file: "users.yaml"},
+		{name: "empty json object", file: "users.json", data: "{}"},
+		{name: "csv header only", file: "users.csv", data: "key,region\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := routing.NewResolver(&config.RegionRetriever{
+				Type: config.RegionResolverTypeFile,
+				File: &config.FileRetriever{Path: writeFile(t, tt.file, []byte(tt.data))},
+			})
+			if err == nil {
+				t.Errorf("NewResolver() error = %v, wantErr %v", err, true)
+			}
+		})
+	}
+}
+
+func TestFileResolver_Monitor(t *testing.T) {
+	valid := &config.RegionRetriever{
+		Type: config.RegionResolverTypeFile,
+		File: &config.FileRetriever{Path: writeFile(t, "users.yaml", []byte("alice: euw1\n"))},
+	}
+	missing := &config.RegionRetriever{
+		Type: config.RegionResolverTypeFile,
+		File: &config.FileRetriever{Path: filepath.Join(t.TempDir(), "missing.yaml")},
+	}
+	tests := []struct {
+		cfg  *config.RegionRetriever
+		name string
+	}{
+		{name: "missing file", cfg: missing},
+		{
+			name: "failing sibling",
+			cfg: &config.RegionRetriever{
+				Type:     config.RegionResolverTypeChain,
+				Children: []*config.RegionRetriever{valid, missing},
+			},
+		},
+		{
+			name: "failing fallback",
+			cfg: &config.RegionRetriever{
+				Type: config.RegionResolverTypeFile,
+				File: valid.File,
+				RegionResolver: &config.RegionResolver{
+					OnError:  &config.ErrorPolicy{Unmapped: config.ErrorPolicyFallback},
+					Fallback: missing,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := routing.NewMonitor()
+			if _, err := routing.NewResolver(tt.cfg, routing.WithMonitor(monitor)); err == nil {
+				t.Fatalf("NewResolver() error = nil, want an error")
+			}
+			if got := monitor.Snapshots(); len(got) != 0 {
+				t.Errorf("Snapshots() got = %+v, want none", got)
+			}
+		})
+	}
+}
+
+func TestFileResolver_Watch(t *testing.T) {
+	path := writeFile(t, "users.yaml", []byte("alice: euw1\n"))
+	monitor := routing.NewMonitor()
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type: config.RegionResolverTypeFile,
+		File: &config.FileRetriever{Path: path},
+	}, routing.WithMonitor(monitor))
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+	defer func() {
+		_ = rslv.(io.Closer).Close()
+	}()
+
+	// editing the file moves alice
+	if err = os.WriteFile(path, []byte("alice: use1\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	waitForRegion(t, rslv, "alice", "use1")
+
+	// a broken table keeps the previous one
+	if err = os.WriteFile(path, []byte("alice: [euw1"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for status := monitor.Snapshots(); status[0].LastError == ""; status = monitor.Snapshots() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Snapshots() got = %+v, want a failed reload", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, err := rslv.ResolveRegion(context.Background(), "alice"); err != nil || got != "use1" {
+		t.Fatalf("ResolveRegion() got = %v, %v, want %v", got, err, "use1")
+	}
+
+	// truncating the file, as a writer does before writing the new table, keeps the previous one too
+	for _, data := range []string{"", "{}\n"} {
+		if err = os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if got, err := rslv.ResolveRegion(context.Background(), "alice"); err != nil || got != "use1" {
+			t.Fatalf("ResolveRegion() got = %v, %v, want %v", got, err, "use1")
+		}
+	}
+
+	// replacing the file with a rename, as editors and ConfigMap updates do
+	tmp := filepath.Join(filepath.Dir(path), ".users.yaml.tmp")
+	if err = os.WriteFile(tmp, []byte("alice: apse1\n"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		t.Fatalf("rename file: %v", err)
+	}
+	waitForRegion(t, rslv, "alice", "apse1")
+	if status := monitor.Snapshots(); status[0].LastError != "" {
+		t.Errorf("Snapshots() got = %+v, want a successful reload", status)
+	}
+}
+
+// waitForRegion fails the test unless param resolves to want within a couple of seconds.
+func waitForRegion(t *testing.T, rslv routing.RegionResolver, param, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, err := rslv.ResolveRegion(context.Background(), param)
+		if err == nil && got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ResolveRegion() got = %v, %v, want %v", got, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
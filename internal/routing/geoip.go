@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/fieldpath"
+)
+
+// defaultGeoIPField is the field of the database records mapped to a region when none is configured,
+// it holds the country ISO code in the MaxMind GeoIP2 and GeoLite2 databases.
+const defaultGeoIPField = "country.iso_code"
+
+// geoIPResolver resolves the region of an IP address, either the lookup value itself or,
+// when the value is not an IP address, the client IP address of the incoming request.
+type geoIPResolver struct {
+	db          *maxminddb.Reader
+	resolverCfg *config.RegionResolver
+	field       string
+	// cidrs is sorted from the most to the least specific network.
+	cidrs []cidrRegion
+}
+
+type cidrRegion struct {
+	region string
+	prefix netip.Prefix
+}
+
+func newGeoIPResolver(cfg *config.RegionRetriever) (RegionResolver, error) {
+	r := &geoIPResolver{resolverCfg: cfg.RegionResolver, field: defaultGeoIPField}
+
+	for network, region := range cfg.GeoIP.CIDRs {
+		prefix, err := parsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("region resolver: invalid network %q: %w", network, err)
+		}
+		r.cidrs = append(r.cidrs, cidrRegion{prefix: prefix, region: region})
+	}
+	slices.SortFunc(r.cidrs, func(a, b cidrRegion) int {
+		return cmp.Compare(b.prefix.Bits(), a.prefix.Bits())
+	})
+
+	if cfg.GeoIP.Database != "" {
+		db, err := maxminddb.Open(filepath.Clean(cfg.GeoIP.Database))
+		if err != nil {
+			return nil, fmt.Errorf("region resolver: failed to open geoip database: %w", err)
+		}
+		r.db = db
+		if cfg.RegionResolver.Field != "" {
+			r.field = cfg.RegionResolver.Field
+		}
+	}
+	return r, nil
+}
+
+func (x *geoIPResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	addr, err := netip.ParseAddr(param)
+	if err != nil {
+		// the lookup value is something else (e.g. a user ID), fall back to the address of the client
+		req, ok := RequestFromContext(ctx)
+		if !ok {
+			return "", errors.New("region resolver: no client IP address available")
+		}
+		if addr, err = netip.ParseAddr(req.ClientIP); err != nil {
+			return "", fmt.Errorf("region resolver: invalid client IP address %q: %w", req.ClientIP, err)
+		}
+	}
+	addr = addr.Unmap()
+
+	for _, c := range x.cidrs {
+		if c.prefix.Contains(addr) {
+			return c.region, nil
+		}
+	}
+	if x.db == nil {
+		return "", fmt.Errorf("region resolver: %w for %s", ErrNoMapping, addr)
+	}
+
+	var record map[string]any
+	_, found, err := x.db.LookupNetwork(net.IP(addr.AsSlice()), &record)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: geoip lookup failed: %w", err)
+	}
+	if !found {
+		return "", fmt.Errorf("region resolver: %w for %s", ErrNoMapping, addr)
+	}
+
+	if x.resolverCfg.Type == config.RegionResolverTypeExpr {
+		region, err := evalRegion(ctx, x.resolverCfg, addr.String(), record)
+		if err != nil {
+			return "", fmt.Errorf("region resolver: %w", err)
+		}
+		return region, nil
+	}
+
+	key, err := fieldpath.String(record, x.field)
+	if err != nil {
+		// the database simply has no such information for this address
+		return "", fmt.Errorf("region resolver: %w for %s: %w", ErrNoMapping, addr, err)
+	}
+	region, err := mapRegion(x.resolverCfg, key)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: %w", err)
+	}
+	return region, nil
+}
+
+// Close releases the geoip database.
+func (x *geoIPResolver) Close() error {
+	if x.db == nil {
+		return nil
+	}
+	return x.db.Close()
+}
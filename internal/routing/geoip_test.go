@@ -0,0 +1,134 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// testdata/geoip.mmdb holds the following records:
+//   - 81.2.69.0/24: {"country": {"iso_code": "GB"}}
+//   - 216.160.83.0/24: {"country": {"iso_code": "US"}}
+//   - 2a02:26f0::/29: {"country": {"iso_code": "IT"}}
+//   - 89.160.20.0/24: {"continent": {"code": "EU"}}
+func TestGeoIPResolver(t *testing.T) {
+	retriever := &config.RegionRetriever{
+		Type: config.RegionResolverTypeGeoIP,
+		GeoIP: &config.GeoIPRetriever{
+			Database: "testdata/geoip.mmdb",
+			CIDRs:    map[string]string{"10.0.0.0/8": "region-internal", "81.2.69.160/27": "region-office"},
+		},
+		RegionResolver: &config.RegionResolver{
+			Type:    "map",
+			Mapping: map[string]string{"GB": "region-EU", "IT": "region-EU", "US": "region-US"},
+		},
+	}
+	rslv, err := routing.NewResolver(retriever)
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = rslv.(io.Closer).Close()
+	})
+
+	tests := []struct {
+		ctx           context.Context
+		name          string
+		param         string
+		want          string
+		wantErr       bool
+		wantNoMapping bool
+	}{
+		{name: "database ipv4", param: "81.2.69.142", want: "region-EU"},
+		{name: "database ipv6", param: "2a02:26f0:1::1", want: "region-EU"},
+		{name: "database ipv4 mapped ipv6", param: "::ffff:216.160.83.56", want: "region-US"},
+		{name: "cidr", param: "10.20.30.40", want: "region-internal"},
+		{name: "most specific cidr wins over the database", param: "81.2.69.170", want: "region-office"},
+		{name: "address not in database", param: "203.0.113.7", wantErr: true, wantNoMapping: true},
+		{name: "record without field", param: "89.160.20.112", wantErr: true, wantNoMapping: true},
+		{
+			name:  "client ip when the lookup value is not an ip",
+			ctx:   routing.WithRequest(context.Background(), &routing.Request{ClientIP: "216.160.83.56"}),
+			param: "alice",
+			want:  "region-US",
+		},
+		{name: "no client ip", param: "alice", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			got, err := rslv.ResolveRegion(ctx, tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, routing.ErrNoMapping) != tt.wantNoMapping {
+				t.Errorf("ResolveRegion() error = %v, wantNoMapping %v", err, tt.wantNoMapping)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("combined with user based routing", func(t *testing.T) {
+		chain, err := routing.NewResolver(&config.RegionRetriever{
+			Type: config.RegionResolverTypeChain,
+			Children: []*config.RegionRetriever{
+				{
+					Type: config.RegionResolverTypeSQL,
+					SQL: &config.SQLRetriever{
+						Driver: "sqlite",
+						DSN:    "file::memory:",
+						Query:  "SELECT country FROM (SELECT 'alice' AS id, 'US' AS country) WHERE id = ?",
+					},
+					RegionResolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"US": "region-US"}},
+				},
+				{
+					Type:  config.RegionResolverTypeGeoIP,
+					GeoIP: &config.GeoIPRetriever{CIDRs: map[string]string{"0.0.0.0/0": "region-nearest"}},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("new resolver: %v", err)
+		}
+
+		ctx := routing.WithRequest(context.Background(), &routing.Request{ClientIP: "198.51.100.1"})
+		for param, want := range map[string]string{"alice": "region-US", "anonymous": "region-nearest"} {
+			got, err := chain.ResolveRegion(ctx, param)
+			if err != nil {
+				t.Fatalf("ResolveRegion(%s) unexpected error: %v", param, err)
+			}
+			if got != want {
+				t.Errorf("ResolveRegion(%s) got = %v, want %v", param, got, want)
+			}
+		}
+	})
+}
+
+func TestGeoIPResolver_Cache(t *testing.T) {
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type:           config.RegionResolverTypeGeoIP,
+		GeoIP:          &config.GeoIPRetriever{CIDRs: map[string]string{"10.0.0.0/8": "euw1", "192.168.0.0/16": "use1"}},
+		RegionResolver: &config.RegionResolver{Type: "map"},
+		Cache:          &config.RegionCache{TTL: "1m"},
+	})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	// both clients send the same lookup value, their region still comes from their own address
+	for _, tt := range []struct{ clientIP, want string }{{"10.0.0.1", "euw1"}, {"192.168.0.1", "use1"}} {
+		ctx := routing.WithRequest(context.Background(), &routing.Request{ClientIP: tt.clientIP})
+		if got, err := rslv.ResolveRegion(ctx, "bob"); got != tt.want || err != nil {
+			t.Errorf("ResolveRegion() got = %v, %v, want %v, nil", got, err, tt.want)
+		}
+	}
+}
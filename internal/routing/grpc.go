@@ -0,0 +1,283 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/fieldpath"
+	polyroutev1 "github.com/CanobbioE/poly-route/proto-gen/polyroute/v1"
+)
+
+const (
+	// WellKnownLookupMethod is the method called by the grpc resolver when no descriptor set is configured,
+	// its definition is shipped in proto/polyroute/v1/region.proto.
+	WellKnownLookupMethod = polyroutev1.RegionService_LookupRegion_FullMethodName
+
+	// wellKnownRequestField and wellKnownResponseField are the fields of the well-known lookup messages.
+	wellKnownRequestField  = "key"
+	wellKnownResponseField = "region"
+)
+
+// ConnGetter provides client connections to gRPC services, [forwarder.ConnectionPool] implements it.
+type ConnGetter interface {
+	Get(ctx context.Context, addr string) (*grpc.ClientConn, error)
+}
+
+type grpcResolver struct {
+	conns        ConnGetter
+	resolverCfg  *config.RegionResolver
+	conn         *grpc.ClientConn
+	headers      metadata.MD
+	method       protoreflect.MethodDescriptor
+	address      string
+	fullMethod   string
+	field        string
+	requestField []protoreflect.FieldDescriptor
+	timeout      time.Duration
+}
+
+type withConnGetter struct {
+	conns ConnGetter
+}
+
+func (w *withConnGetter) apply(r RegionResolver) {
+	if v, ok := r.(*grpcResolver); ok {
+		v.conns = w.conns
+	}
+}
+
+// WithConnGetter makes the grpc resolver obtain its connections from conns instead of dialing its own.
+// It does nothing for other resolvers.
+func WithConnGetter(conns ConnGetter) ResolverOption {
+	return &withConnGetter{conns}
+}
+
+func newGRPCResolver(cfg *config.RegionRetriever, options ...ResolverOption) (RegionResolver, error) {
+	method, err := loadMethod(cfg.GRPC)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: %w", err)
+	}
+
+	requestField, field := cfg.GRPC.RequestField, cfg.RegionResolver.Field
+	if cfg.GRPC.DescriptorSet == "" {
+		requestField, field = wellKnownRequestField, wellKnownResponseField
+	}
+	path, err := fieldDescriptors(method.Input(), requestField)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: request_field: %w", err)
+	}
+
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	r := &grpcResolver{
+		resolverCfg:  cfg.RegionResolver,
+		headers:      metadata.New(cfg.Headers),
+		method:       method,
+		address:      cfg.GRPC.Address,
+		fullMethod:   "/" + string(method.Parent().FullName()) + "/" + string(method.Name()),
+		field:        field,
+		requestField: path,
+		timeout:      timeout,
+	}
+
+	for _, option := range options {
+		option.apply(r)
+	}
+
+	if r.conns == nil {
+		// no pool was provided, the connection is dialed lazily on the first call
+		if r.conn, err = grpc.NewClient(r.address, grpc.WithTransportCredentials(insecure.NewCredentials())); err != nil {
+			return nil, fmt.Errorf("region resolver: dial %s: %w", r.address, err)
+		}
+	}
+	return r, nil
+}
+
+func (x *grpcResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	req, err := x.newRequest(param)
+	if err != nil {
+		return "", err
+	}
+
+	conn := x.conn
+	if x.conns != nil {
+		if conn, err = x.conns.Get(ctx, x.address); err != nil {
+			return "", fmt.Errorf("region resolver: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, x.timeout)
+	defer cancel()
+	// replaces the metadata of the proxied call, e.g. the client credentials, that ctx may carry
+	ctx = metadata.NewOutgoingContext(ctx, x.headers)
+
+	resp := dynamicpb.NewMessage(x.method.Output())
+	if err = conn.Invoke(ctx, x.fullMethod, req, resp); err != nil {
+		return "", fmt.Errorf("region resolver: failed to call %s: %w", x.fullMethod, err)
+	}
+
+	// the response is converted to JSON so that fields are looked up exactly like the http retriever does
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(resp)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: marshal response failed: %w", err)
+	}
+	responseJSON := map[string]any{}
+	if err = json.Unmarshal(b, &responseJSON); err != nil {
+		return "", fmt.Errorf("region resolver: unmarshal response failed: %w", err)
+	}
+
+	region, err := x.resolve(ctx, param, responseJSON)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: failed to resolve response: %w", err)
+	}
+	return region, nil
+}
+
+func (x *grpcResolver) resolve(ctx context.Context, param string, m map[string]any) (string, error) {
+	if x.resolverCfg.Type == config.RegionResolverTypeExpr {
+		return evalRegion(ctx, x.resolverCfg, param, m)
+	}
+	key, err := fieldpath.String(m, x.field)
+	if err != nil {
+		return "", err
+	}
+	return mapRegion(x.resolverCfg, key)
+}
+
+// Close releases the connection dialed by the resolver, pooled connections are left to their owner.
+func (x *grpcResolver) Close() error {
+	if x.conn == nil {
+		return nil
+	}
+	return x.conn.Close()
+}
+
+// newRequest builds the request message with param set at the configured request field.
+func (x *grpcResolver) newRequest(param string) (proto.Message, error) {
+	req := dynamicpb.NewMessage(x.method.Input())
+
+	var msg protoreflect.Message = req
+	last := len(x.requestField) - 1
+	for _, fd := range x.requestField[:last] {
+		msg = msg.Mutable(fd).Message()
+	}
+
+	value, err := scalarValue(x.requestField[last], param)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: invalid lookup value: %w", err)
+	}
+	msg.Set(x.requestField[last], value)
+	return req, nil
+}
+
+// loadMethod returns the descriptor of the configured method, or of the well-known one.
+func loadMethod(cfg *config.GRPCRetriever) (protoreflect.MethodDescriptor, error) {
+	if cfg.DescriptorSet == "" {
+		return polyroutev1.File_polyroute_v1_region_proto.Services().Get(0).Methods().Get(0), nil
+	}
+
+	data, err := os.ReadFile(filepath.Clean(cfg.DescriptorSet))
+	if err != nil {
+		return nil, fmt.Errorf("read descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("parse descriptor set: %w", err)
+	}
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(cfg.Method, "/"), "/")
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", service, err)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	method := sd.Methods().ByName(protoreflect.Name(name))
+	if method == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", name, service)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s must be unary", cfg.Method)
+	}
+	return method, nil
+}
+
+// fieldDescriptors resolves the dot notation path of a scalar field nested in md.
+func fieldDescriptors(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	names := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, 0, len(names))
+	for i, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, fmt.Errorf("no field %s in %s", name, md.FullName())
+		}
+		if fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("field %s is repeated", fd.FullName())
+		}
+		fields = append(fields, fd)
+
+		if i < len(names)-1 {
+			if fd.Message() == nil {
+				return nil, fmt.Errorf("field %s is not a message", fd.FullName())
+			}
+			md = fd.Message()
+			continue
+		}
+		if _, err := scalarValue(fd, "0"); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// scalarValue converts s to the value of the scalar field fd.
+func scalarValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	default:
+		return protoreflect.Value{}, errors.New("field " + string(fd.FullName()) + " of kind " + fd.Kind().String() +
+			" cannot hold the lookup value")
+	}
+}
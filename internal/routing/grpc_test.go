@@ -0,0 +1,299 @@
+package routing_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/CanobbioE/poly-route/internal/codec"
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/forwarder"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// usersFile describes a user directory whose request and response carry the lookup values in nested messages.
+func usersFile() *descriptorpb.FileDescriptorProto {
+	type fieldType = descriptorpb.FieldDescriptorProto_Type
+	field := func(name string, typ fieldType, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	message := func(name string, f *descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: []*descriptorpb.FieldDescriptorProto{f}}
+	}
+	msgType := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("users/v1/users.proto"),
+		Package: proto.String("users.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("User", field("id", descriptorpb.FieldDescriptorProto_TYPE_INT64, "")),
+			message("GetUserRequest", field("user", msgType, ".users.v1.User")),
+			message("Profile", field("country", descriptorpb.FieldDescriptorProto_TYPE_STRING, "")),
+			message("GetUserResponse", field("profile", msgType, ".users.v1.Profile")),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("UserDirectory"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:       proto.String("GetUser"),
+					InputType:  proto.String(".users.v1.GetUserRequest"),
+					OutputType: proto.String(".users.v1.GetUserResponse"),
+				},
+				{
+					Name:            proto.String("WatchUser"),
+					InputType:       proto.String(".users.v1.GetUserRequest"),
+					OutputType:      proto.String(".users.v1.GetUserResponse"),
+					ServerStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}
+}
+
+// writeDescriptorSet writes the users descriptor set to a temporary file and returns its path.
+func writeDescriptorSet(t *testing.T) string {
+	t.Helper()
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{usersFile()}})
+	if err != nil {
+		t.Fatalf("marshal descriptor set: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "users.pb")
+	if err = os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatalf("write descriptor set: %v", err)
+	}
+	return path
+}
+
+// newBufconnPool serves handle over an in-memory listener and returns a pool dialing it.
+// handle receives the full method name, the incoming metadata and the wire format of the request.
+func newBufconnPool(
+	t *testing.T,
+	handle func(method string, md metadata.MD, req []byte) ([]byte, error),
+) *forwarder.ConnectionPool {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(&codec.PassThrough{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			var req []byte
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			resp, err := handle(method, md, req)
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(resp)
+		}),
+	)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	pool := forwarder.NewConnectionPool(
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	t.Cleanup(func() {
+		_ = pool.CloseAll()
+	})
+	return pool
+}
+
+func TestGRPCResolver(t *testing.T) {
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{usersFile()},
+	})
+	if err != nil {
+		t.Fatalf("parse descriptors: %v", err)
+	}
+	d, err := files.FindDescriptorByName("users.v1.UserDirectory.GetUser")
+	if err != nil {
+		t.Fatalf("find method: %v", err)
+	}
+	getUser := d.(protoreflect.MethodDescriptor)
+
+	countries := map[int64]string{42: "us", 7: "unknown"}
+	regions := map[string]string{"alice": "eu", "bob": "unknown"}
+
+	pool := newBufconnPool(t, func(method string, md metadata.MD, req []byte) ([]byte, error) {
+		if got := md.Get("x-api-key"); len(got) != 1 || got[0] != "secret" {
+			return nil, status.Error(codes.Unauthenticated, "missing api key")
+		}
+
+		switch method {
+		case routing.WellKnownLookupMethod:
+			key, err := decodeStringField(req)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			region, ok := regions[key]
+			if !ok {
+				return nil, status.Error(codes.NotFound, "unknown key")
+			}
+			b := protowire.AppendTag(nil, 1, protowire.BytesType)
+			return protowire.AppendString(b, region), nil
+		case "/users.v1.UserDirectory/GetUser":
+			in := dynamicpb.NewMessage(getUser.Input())
+			if err := proto.Unmarshal(req, in); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			user := in.Get(in.Descriptor().Fields().ByName("user")).Message()
+			id := user.Get(user.Descriptor().Fields().ByName("id")).Int()
+
+			out := dynamicpb.NewMessage(getUser.Output())
+			profile := out.Mutable(getUser.Output().Fields().ByName("profile")).Message()
+			profile.Set(profile.Descriptor().Fields().ByName("country"), protoreflect.ValueOfString(countries[id]))
+			return proto.Marshal(out)
+		default:
+			return nil, status.Error(codes.Unimplemented, method)
+		}
+	})
+
+	descriptorSet := writeDescriptorSet(t)
+	wellKnown := func() *config.RegionRetriever {
+		return &config.RegionRetriever{
+			Type:    config.RegionResolverTypeGRPC,
+			Headers: map[string]string{"X-Api-Key": "secret"},
+			GRPC:    &config.GRPCRetriever{Address: "passthrough:///bufnet"},
+			RegionResolver: &config.RegionResolver{
+				Type:    "map",
+				Mapping: map[string]string{"eu": "region-A"},
+			},
+		}
+	}
+	users := func() *config.RegionRetriever {
+		return &config.RegionRetriever{
+			Type:    config.RegionResolverTypeGRPC,
+			Headers: map[string]string{"X-Api-Key": "secret"},
+			GRPC: &config.GRPCRetriever{
+				Address:       "passthrough:///bufnet",
+				Method:        "/users.v1.UserDirectory/GetUser",
+				DescriptorSet: descriptorSet,
+				RequestField:  "user.id",
+			},
+			RegionResolver: &config.RegionResolver{
+				Type:    "map",
+				Field:   "profile.country",
+				Mapping: map[string]string{"us": "region-B"},
+			},
+		}
+	}
+
+	tests := []struct {
+		retriever     *config.RegionRetriever
+		name          string
+		param         string
+		want          string
+		wantErr       bool
+		wantNoMapping bool
+	}{
+		{name: "well-known method", retriever: wellKnown(), param: "alice", want: "region-A"},
+		{name: "well-known method unmapped", retriever: wellKnown(), param: "bob", wantErr: true, wantNoMapping: true},
+		{name: "well-known method error", retriever: wellKnown(), param: "mallory", wantErr: true},
+		{name: "descriptor set", retriever: users(), param: "42", want: "region-B"},
+		{name: "descriptor set unmapped", retriever: users(), param: "7", wantErr: true, wantNoMapping: true},
+		{name: "descriptor set invalid lookup value", retriever: users(), param: "alice", wantErr: true},
+		{
+			name: "missing metadata",
+			retriever: func() *config.RegionRetriever {
+				r := wellKnown()
+				r.Headers = nil
+				return r
+			}(),
+			param:   "alice",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(tt.retriever, routing.WithConnGetter(pool))
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+
+			got, err := rslv.ResolveRegion(context.Background(), tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, routing.ErrNoMapping) != tt.wantNoMapping {
+				t.Errorf("ResolveRegion() error = %v, wantNoMapping %v", err, tt.wantNoMapping)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		for name, grpcCfg := range map[string]*config.GRPCRetriever{
+			"unknown method":        {Method: "/users.v1.UserDirectory/DeleteUser", RequestField: "user.id"},
+			"streaming method":      {Method: "/users.v1.UserDirectory/WatchUser", RequestField: "user.id"},
+			"unknown request field": {Method: "/users.v1.UserDirectory/GetUser", RequestField: "user.email"},
+			"message request field": {Method: "/users.v1.UserDirectory/GetUser", RequestField: "user"},
+		} {
+			r := users()
+			grpcCfg.Address, grpcCfg.DescriptorSet = "passthrough:///bufnet", descriptorSet
+			r.GRPC = grpcCfg
+			if _, err := routing.NewResolver(r, routing.WithConnGetter(pool)); err == nil {
+				t.Errorf("NewResolver() expected an error for %s", name)
+			}
+		}
+	})
+}
+
+// decodeStringField returns the value of the string field number 1 encoded in b.
+func decodeStringField(b []byte) (string, error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return "", protowire.ParseError(n)
+			}
+			return v, nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return "", nil
+}
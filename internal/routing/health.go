@@ -0,0 +1,322 @@
+package routing
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	encodingproto "google.golang.org/grpc/encoding/proto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+	defaultHealthRise     = 2
+	defaultHealthFall     = 3
+)
+
+// HealthChecker actively checks the backends of the protocols registered with Watch,
+// and serves their status as JSON, e.g. on an administration endpoint.
+// Backends are healthy until proven otherwise, and so is every backend of a nil HealthChecker.
+type HealthChecker struct {
+	client *http.Client
+	// targets is keyed by the scheme and host of the HTTP backends, and by the host of the gRPC ones.
+	targets  map[string]*healthTarget
+	stop     chan struct{}
+	mu       sync.RWMutex
+	stopOnce sync.Once
+}
+
+// BackendStatus is the health of a backend.
+type BackendStatus struct {
+	// Since is when the backend last changed health, the zero time if it never did.
+	Since time.Time `json:"since"`
+	// LastCheck is the zero time until the backend is checked for the first time.
+	LastCheck time.Time `json:"last_check"`
+	// LastError is the error of the last check, empty if it succeeded.
+	LastError string `json:"last_error,omitempty"`
+	Target    string `json:"target"`
+	Type      string `json:"type"`
+	Healthy   bool   `json:"healthy"`
+}
+
+// healthTarget is a checked backend.
+type healthTarget struct {
+	check *config.HealthCheck
+	// conns provides the connections of gRPC checks, the ones of the forwarder of the backend.
+	conns    ConnGetter
+	target   string
+	status   BackendStatus
+	interval time.Duration
+	timeout  time.Duration
+	rise     int
+	fall     int
+	// successes and failures count the consecutive results of the checks.
+	successes int
+	failures  int
+	mu        sync.Mutex
+	healthy   atomic.Bool
+}
+
+// NewHealthChecker returns a HealthChecker with no backends.
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{
+		client:  &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+		targets: map[string]*healthTarget{},
+		stop:    make(chan struct{}),
+	}
+}
+
+// Watch starts checking the backends of cfg: the endpoints of its upstreams with the health check of their
+// upstream, or else of cfg, and the other destination addresses with the health check of cfg.
+// A backend shared by several destinations is checked once, with the first health check found.
+// gRPC checks obtain their connections from conns, which should be the ones the proxied calls go through,
+// so that a broken connection makes its backend unhealthy.
+func (h *HealthChecker) Watch(cfg *config.ProtocolCfg, conns ConnGetter) {
+	if h == nil || cfg == nil {
+		return
+	}
+
+	for _, upstream := range cfg.Upstreams {
+		check := cmp.Or(upstream.HealthCheck, cfg.HealthCheck)
+		for _, e := range upstream.Endpoints {
+			h.add(e.Address, check, conns)
+		}
+	}
+	if cfg.HealthCheck == nil {
+		return
+	}
+	add := func(mappings map[string]string) {
+		for _, addr := range mappings {
+			if !strings.HasPrefix(addr, config.UpstreamPrefix) {
+				h.add(addr, cfg.HealthCheck, conns)
+			}
+		}
+	}
+	for _, mappings := range cfg.Destinations {
+		add(mappings)
+	}
+	for _, destinations := range cfg.Hosts {
+		for _, mappings := range destinations {
+			add(mappings)
+		}
+	}
+	for i := range cfg.Routes {
+		add(cfg.Routes[i].Destinations)
+	}
+}
+
+// add starts checking the backend of addr with check, unless it is already checked.
+func (h *HealthChecker) add(addr string, check *config.HealthCheck, conns ConnGetter) {
+	if check == nil {
+		return
+	}
+	target := healthTargetOf(addr)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.targets[target]; ok || target == "" {
+		return
+	}
+
+	interval, err := time.ParseDuration(check.Interval)
+	if err != nil || interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	timeout, err := time.ParseDuration(check.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	t := &healthTarget{
+		check:    check,
+		conns:    conns,
+		status:   BackendStatus{Target: target, Type: check.Type, Healthy: true},
+		target:   target,
+		interval: interval,
+		timeout:  timeout,
+		rise:     cmp.Or(check.Rise, defaultHealthRise),
+		fall:     cmp.Or(check.Fall, defaultHealthFall),
+	}
+	t.healthy.Store(true)
+	h.targets[target] = t
+	go h.run(t)
+}
+
+// healthTargetOf returns the checked part of a backend address: the scheme and host of an HTTP URL,
+// or the host of a gRPC address.
+func healthTargetOf(addr string) string {
+	if strings.Contains(addr, "://") {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return ""
+		}
+		return u.Scheme + "://" + u.Host
+	}
+	host, _, _ := strings.Cut(addr, "/")
+	return host
+}
+
+// Healthy reports whether the backend of addr is healthy, backends that are not checked always are.
+func (h *HealthChecker) Healthy(addr string) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.RLock()
+	t, ok := h.targets[healthTargetOf(addr)]
+	h.mu.RUnlock()
+	return !ok || t.healthy.Load()
+}
+
+// run checks t on its interval until h is closed.
+func (h *HealthChecker) run(t *healthTarget) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+		t.record(h.check(ctx, t), time.Now())
+		cancel()
+
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs a single health check of t.
+func (h *HealthChecker) check(ctx context.Context, t *healthTarget) error {
+	target := t.target
+	switch t.check.Type {
+	case config.HealthCheckHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target+cmp.Or(t.check.Path, "/"), http.NoBody)
+		if err != nil {
+			return err
+		}
+		resp, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if want := cmp.Or(t.check.Status, http.StatusOK); resp.StatusCode != want {
+			return errors.New("unexpected status " + strconv.Itoa(resp.StatusCode) + ", want " + strconv.Itoa(want))
+		}
+	case config.HealthCheckGRPC:
+		if t.conns == nil {
+			return errors.New("no gRPC connections available")
+		}
+		conn, err := t.conns.Get(ctx, target)
+		if err != nil {
+			return err
+		}
+		// the connections of the forwarder announce their pass-through codec by default, not the proto one
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: t.check.Service},
+			grpc.ForceCodecV2(encoding.GetCodecV2(encodingproto.Name)))
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return errors.New("status " + resp.GetStatus().String())
+		}
+	case config.HealthCheckTCP:
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", dialAddress(target))
+		if err != nil {
+			return err
+		}
+		_ = conn.Close()
+	}
+	return nil
+}
+
+// dialAddress returns the host and port of target, using the default port of the scheme of HTTP targets.
+func dialAddress(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return target
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// record updates the health of t with the result of a check done at now.
+func (t *healthTarget) record(err error, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.LastCheck = now
+	healthy := t.healthy.Load()
+	if err == nil {
+		t.status.LastError = ""
+		t.successes++
+		t.failures = 0
+		if !healthy && t.successes >= t.rise {
+			t.setHealthy(true, now)
+		}
+		return
+	}
+	t.status.LastError = err.Error()
+	t.failures++
+	t.successes = 0
+	if healthy && t.failures >= t.fall {
+		t.setHealthy(false, now)
+	}
+}
+
+func (t *healthTarget) setHealthy(healthy bool, now time.Time) {
+	t.healthy.Store(healthy)
+	t.status.Healthy = healthy
+	t.status.Since = now
+}
+
+// Statuses returns the health of the checked backends, sorted by target.
+func (h *HealthChecker) Statuses() []BackendStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	statuses := make([]BackendStatus, 0, len(h.targets))
+	for _, t := range h.targets {
+		t.mu.Lock()
+		statuses = append(statuses, t.status)
+		t.mu.Unlock()
+	}
+	slices.SortFunc(statuses, func(a, b BackendStatus) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	return statuses
+}
+
+// ServeHTTP writes the health of the checked backends as JSON.
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"backends": h.Statuses()})
+}
+
+// Close stops the health checks.
+func (h *HealthChecker) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	return nil
+}
@@ -0,0 +1,200 @@
+package routing_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/CanobbioE/poly-route/internal/codec"
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/forwarder"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// waitForHealth polls h until addr has the wanted health.
+func waitForHealth(t *testing.T, h *routing.HealthChecker, addr string, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.Healthy(addr) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Healthy(%q) got = %v, want %v, statuses %+v", addr, !want, want, h.Statuses())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHealthChecker_HTTP(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusNoContent)
+	var paths atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths.Store(r.URL.Path)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	h := routing.NewHealthChecker()
+	defer func() {
+		_ = h.Close()
+	}()
+	h.Watch(&config.ProtocolCfg{
+		Destinations: map[string]map[string]string{"/*": {"euw1": srv.URL + "/api"}},
+		HealthCheck: &config.HealthCheck{
+			Type: config.HealthCheckHTTP, Path: "/healthz", Status: http.StatusNoContent,
+			Interval: "5ms", Rise: 2, Fall: 2,
+		},
+	}, nil)
+
+	addr := srv.URL + "/api/users"
+	if !h.Healthy(addr) {
+		t.Errorf("Healthy() got = false before any failed check, want true")
+	}
+	status.Store(http.StatusInternalServerError)
+	waitForHealth(t, h, addr, false)
+	if got := paths.Load(); got != "/healthz" {
+		t.Errorf("check path got = %v, want /healthz", got)
+	}
+	statuses := h.Statuses()
+	if len(statuses) != 1 || statuses[0].Target != srv.URL || statuses[0].Healthy || statuses[0].LastError == "" {
+		t.Errorf("Statuses() got = %+v, want %v unhealthy with an error", statuses, srv.URL)
+	}
+
+	status.Store(http.StatusNoContent)
+	waitForHealth(t, h, addr, true)
+	if !h.Healthy("http://unchecked") {
+		t.Errorf("Healthy() got = false for an unchecked backend, want true")
+	}
+}
+
+func TestHealthChecker_TCP(t *testing.T) {
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+
+	h := routing.NewHealthChecker()
+	defer func() {
+		_ = h.Close()
+	}()
+	h.Watch(&config.ProtocolCfg{
+		Upstreams: map[string]config.Upstream{
+			"mock": {
+				Endpoints:   []config.Endpoint{{Address: addr}},
+				HealthCheck: &config.HealthCheck{Type: config.HealthCheckTCP, Interval: "5ms", Fall: 1},
+			},
+		},
+	}, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	if !h.Healthy(addr) {
+		t.Errorf("Healthy() got = false while listening, want true")
+	}
+	_ = lis.Close()
+	waitForHealth(t, h, addr, false)
+}
+
+func TestHealthChecker_GRPC(t *testing.T) {
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contentType atomic.Value
+	srv := grpc.NewServer(grpc.UnaryInterceptor(
+		func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			contentType.Store(md.Get("content-type"))
+			return handler(ctx, req)
+		},
+	))
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	// configured like the pool of the gRPC forwarder, which passes the proxied messages through
+	pool := forwarder.NewConnectionPool(
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(&codec.PassThrough{})),
+	)
+	defer func() {
+		_ = pool.CloseAll()
+	}()
+	h := routing.NewHealthChecker()
+	defer func() {
+		_ = h.Close()
+	}()
+	addr := lis.Addr().String()
+	h.Watch(&config.ProtocolCfg{
+		Destinations: map[string]map[string]string{"/mock.Mock/*": {"euw1": addr}},
+		HealthCheck: &config.HealthCheck{
+			Type: config.HealthCheckGRPC, Service: "mock.Mock", Interval: "5ms", Rise: 1, Fall: 1,
+		},
+	}, pool)
+
+	// the service is unknown until its status is set
+	waitForHealth(t, h, addr, false)
+	hs.SetServingStatus("mock.Mock", healthpb.HealthCheckResponse_SERVING)
+	waitForHealth(t, h, addr, true)
+	hs.SetServingStatus("mock.Mock", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitForHealth(t, h, addr, false)
+	if got := contentType.Load(); !reflect.DeepEqual(got, []string{"application/grpc+proto"}) {
+		t.Errorf("content-type got = %v, want [application/grpc+proto]", got)
+	}
+}
+
+func TestBalancer_Pick_Unhealthy(t *testing.T) {
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = lis.Close()
+	}()
+	// nothing listens on the address of a closed listener
+	closed, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	for _, policy := range []string{
+		config.BalanceRoundRobin, config.BalanceLeastOutstanding, config.BalanceWeighted, config.BalanceConsistentHash,
+	} {
+		t.Run(policy, func(t *testing.T) {
+			upstream := config.Upstream{
+				Policy:      policy,
+				Endpoints:   []config.Endpoint{{Address: closed.Addr().String()}, {Address: lis.Addr().String()}},
+				HealthCheck: &config.HealthCheck{Type: config.HealthCheckTCP, Interval: "5ms", Fall: 1},
+			}
+			h := routing.NewHealthChecker()
+			defer func() {
+				_ = h.Close()
+			}()
+			h.Watch(&config.ProtocolCfg{Upstreams: map[string]config.Upstream{"mock": upstream}}, nil)
+			waitForHealth(t, h, closed.Addr().String(), false)
+
+			b := routing.NewBalancer(upstream, h)
+			for i := range 4 {
+				got, release, ok := b.Pick("key-" + string(rune('a'+i)))
+				release()
+				if !ok || got != lis.Addr().String() {
+					t.Errorf("Pick() got = %v, %v, want %v, true", got, ok, lis.Addr().String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package routing
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// VirtualHosts holds a RouteTable per host group, see config.ProtocolCfg.Hosts.
+type VirtualHosts struct {
+	exact map[string]*RouteTable
+	// fallback holds the routes of the hosts not matching any group.
+	fallback *RouteTable
+	// wildcards is sorted by descending suffix length, so that the most specific group wins.
+	wildcards []virtualHost
+}
+
+// virtualHost is a wildcard host group, e.g. "*.example.com" has suffix ".example.com".
+type virtualHost struct {
+	routes *RouteTable
+	suffix string
+}
+
+// CompileVirtualHosts returns the VirtualHosts of the host groups, destinations and routes defined in cfg.
+// The hosts are expected to be validated, see config.ProtocolCfg.
+func CompileVirtualHosts(cfg *config.ProtocolCfg, p config.Protocol) *VirtualHosts {
+	v := &VirtualHosts{
+		exact:    make(map[string]*RouteTable, len(cfg.Hosts)),
+		fallback: CompileRoutes(cfg, p),
+	}
+
+	// the hosts of the routes are groups too, even without destinations
+	groups := make(map[string][]*config.Route, len(cfg.Hosts))
+	for host := range cfg.Hosts {
+		groups[host] = nil
+	}
+	for i := range cfg.Routes {
+		if host := cfg.Routes[i].Host; host != "" {
+			groups[host] = append(groups[host], &cfg.Routes[i])
+		}
+	}
+
+	for host, predicated := range groups {
+		routes := compileRoutes(cfg.Hosts[host], predicated, p)
+		host = strings.ToLower(host)
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			v.wildcards = append(v.wildcards, virtualHost{routes: routes, suffix: suffix})
+			continue
+		}
+		v.exact[host] = routes
+	}
+
+	sort.Slice(v.wildcards, func(i, j int) bool {
+		return len(v.wildcards[i].suffix) > len(v.wildcards[j].suffix)
+	})
+	return v
+}
+
+// Routes returns the RouteTable of host, in order of precedence: the group of the exact host name,
+// then the group of the longest matching wildcard, then the destinations outside of any group.
+// The port of host is ignored, and a wildcard only matches subdomains, e.g. "*.example.com"
+// matches "api.example.com" and "v1.api.example.com" but not "example.com".
+func (v *VirtualHosts) Routes(host string) *RouteTable {
+	host = normalizeHost(host)
+	if routes, ok := v.exact[host]; ok {
+		return routes
+	}
+	for _, w := range v.wildcards {
+		if len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return w.routes
+		}
+	}
+	return v.fallback
+}
+
+// normalizeHost returns host lower cased, without port nor trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,47 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestVirtualHosts_Routes(t *testing.T) {
+	cfg := &config.ProtocolCfg{
+		Destinations: map[string]map[string]string{"/*": {"euw1": "default"}},
+		Hosts: map[string]map[string]map[string]string{
+			"api.example.com":  {"/*": {"euw1": "api"}},
+			"*.example.com":    {"/*": {"euw1": "subdomain"}},
+			"*.eu.example.com": {"/*": {"euw1": "eu"}},
+		},
+	}
+	hosts := routing.CompileVirtualHosts(cfg, config.ProtocolHTTP)
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "api.example.com", want: "api"},
+		{host: "api.example.com:8443", want: "api"},
+		{host: "API.Example.com.", want: "api"},
+		{host: "www.example.com", want: "subdomain"},
+		{host: "v1.api.example.com", want: "subdomain"},
+		{host: "fr.eu.example.com", want: "eu"},
+		{host: "eu.example.com", want: "subdomain"},
+		{host: "example.com", want: "default"},
+		{host: "notexample.com", want: "default"},
+		{host: "", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			m, ok := hosts.Routes(tt.host).Match("/users")
+			if !ok {
+				t.Fatalf("Routes(%q).Match() found no route", tt.host)
+			}
+			if got := m.Route.Mappings["euw1"]; got != tt.want {
+				t.Errorf("Routes() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
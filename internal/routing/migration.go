@@ -0,0 +1,33 @@
+package routing
+
+import "github.com/CanobbioE/poly-route/internal/config"
+
+// Migrations decides where the requests of the lookup values being moved between regions are routed.
+// A nil Migrations moves nothing.
+type Migrations map[string]config.Migration
+
+// NewMigrations indexes cfg by lookup value.
+func NewMigrations(cfg []config.Migration) Migrations {
+	m := make(Migrations, len(cfg))
+	for _, migration := range cfg {
+		m[migration.Key] = migration
+	}
+	return m
+}
+
+// Route returns the region serving the requests for key, given the region resolved for it,
+// and the region the requests are mirrored to, empty when they are not mirrored.
+func (m Migrations) Route(key, region string) (target, mirror string) {
+	migration, ok := m[key]
+	if !ok {
+		return region, ""
+	}
+	switch migration.Mode {
+	case config.MigrationShadow:
+		return migration.From, migration.To
+	case config.MigrationDual:
+		return migration.To, migration.From
+	default:
+		return migration.To, ""
+	}
+}
@@ -0,0 +1,35 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestMigrations_Route(t *testing.T) {
+	migrations := routing.NewMigrations([]config.Migration{
+		{Key: "alice", From: "euw1", To: "use1", Mode: config.MigrationShadow},
+		{Key: "bob", From: "euw1", To: "use1", Mode: config.MigrationDual},
+		{Key: "carol", From: "euw1", To: "use1", Mode: config.MigrationCutover},
+	})
+	tests := []struct {
+		name       string
+		key        string
+		wantTarget string
+		wantMirror string
+	}{
+		{name: "shadow", key: "alice", wantTarget: "euw1", wantMirror: "use1"},
+		{name: "dual", key: "bob", wantTarget: "use1", wantMirror: "euw1"},
+		{name: "cutover", key: "carol", wantTarget: "use1"},
+		{name: "not migrated", key: "dave", wantTarget: "apse1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, mirror := migrations.Route(tt.key, "apse1")
+			if target != tt.wantTarget || mirror != tt.wantMirror {
+				t.Errorf("Route() got = %v, %v, want %v, %v", target, mirror, tt.wantTarget, tt.wantMirror)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Monitor collects the status of the resolvers created with WithMonitor.
+// It serves it as JSON, e.g. on an administration endpoint.
+type Monitor struct {
+	snapshots []*snapshotResolver
+	mu        sync.Mutex
+}
+
+// NewMonitor returns a Monitor with no resolvers.
+func NewMonitor() *Monitor {
+	return &Monitor{}
+}
+
+type withMonitor struct {
+	monitor *Monitor
+}
+
+func (w *withMonitor) apply(r RegionResolver) {
+	if v, ok := r.(*snapshotResolver); ok {
+		w.monitor.mu.Lock()
+		defer w.monitor.mu.Unlock()
+		w.monitor.snapshots = append(w.monitor.snapshots, v)
+		v.monitor = w.monitor
+	}
+}
+
+// remove unregisters a closed resolver.
+func (m *Monitor) remove(r *snapshotResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = slices.DeleteFunc(m.snapshots, func(s *snapshotResolver) bool { return s == r })
+}
+
+// WithMonitor registers the resolvers reporting a status (e.g. the snapshot resolver) to m.
+// It does nothing for other resolvers.
+func WithMonitor(m *Monitor) ResolverOption {
+	return &withMonitor{m}
+}
+
+// Snapshots returns the status of the snapshot resolvers.
+func (m *Monitor) Snapshots() []SnapshotStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]SnapshotStatus, 0, len(m.snapshots))
+	for _, s := range m.snapshots {
+		statuses = append(statuses, s.Status())
+	}
+	return statuses
+}
+
+// ServeHTTP writes the status of the registered resolvers as JSON.
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"snapshots": m.Snapshots()})
+}
@@ -0,0 +1,84 @@
+package routing
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// routeVariant holds the mappings of a route restricted to the requests matching all of its predicates,
+// see config.Route.
+type routeVariant struct {
+	mappings map[string]string
+	// headers is keyed by canonical header name.
+	headers map[string]string
+	query   map[string]string
+	// metadata is keyed by lower cased metadata key.
+	metadata map[string]string
+	methods  []string
+}
+
+// newRouteVariant returns the routeVariant of route.
+func newRouteVariant(route *config.Route) *routeVariant {
+	v := &routeVariant{mappings: route.Destinations, query: route.Query}
+	for _, method := range route.Methods {
+		v.methods = append(v.methods, strings.ToUpper(method))
+	}
+	if len(route.Headers) > 0 {
+		v.headers = make(map[string]string, len(route.Headers))
+		for name, value := range route.Headers {
+			v.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	if len(route.Metadata) > 0 {
+		v.metadata = make(map[string]string, len(route.Metadata))
+		for key, value := range route.Metadata {
+			v.metadata[strings.ToLower(key)] = value
+		}
+	}
+	return v
+}
+
+// Select returns the mappings of the first variant of r matching req, in the order of the configuration,
+// or the unconditional mappings of r if none matches, which are nil if r only has variants.
+func (r *CompiledRoute) Select(req *Request) map[string]string {
+	for _, v := range r.variants {
+		if v.matches(req) {
+			return v.mappings
+		}
+	}
+	return r.Mappings
+}
+
+// matches reports whether req satisfies all the predicates of v.
+func (v *routeVariant) matches(req *Request) bool {
+	if len(v.methods) > 0 && !slices.Contains(v.methods, req.Method) {
+		return false
+	}
+	for name, want := range v.headers {
+		if !matchValues(req.Header[name], want) {
+			return false
+		}
+	}
+	for name, want := range v.query {
+		if !matchValues(req.Query[name], want) {
+			return false
+		}
+	}
+	for key, want := range v.metadata {
+		if !matchValues(req.Metadata[key], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValues reports whether one of values is want, or whether there is any if want is config.RoutePredicateAny.
+func matchValues(values []string, want string) bool {
+	if want == config.RoutePredicateAny {
+		return len(values) > 0
+	}
+	return slices.Contains(values, want)
+}
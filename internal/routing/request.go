@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Request holds the attributes of an incoming request that region lookup values are extracted from.
+type Request struct {
+	// Header is only set for HTTP requests.
+	Header http.Header
+	// Metadata is only set for gRPC requests.
+	Metadata metadata.MD
+	Query    url.Values
+	Host     string
+	// Path is the URL path for HTTP requests and the full method name for gRPC requests.
+	Path string
+	// Method is the HTTP method, empty for gRPC requests.
+	Method string
+	// Key is the region lookup value extracted from the request, empty until it is extracted.
+	Key string
+	// RemoteAddr is the network address of the peer that sent the request.
+	RemoteAddr string
+	// ClientIP is the address of the client, which is the host of RemoteAddr unless
+	// the request went through trusted proxies, see [TrustedProxies.ClientIP].
+	ClientIP string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a copy of ctx carrying r, so that resolvers can access the incoming request.
+func WithRequest(ctx context.Context, r *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// RequestFromContext returns the Request stored in ctx by WithRequest, if any.
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*Request)
+	return r, ok
+}
+
+// RequestFromHTTP returns the Request describing r.
+func RequestFromHTTP(r *http.Request) *Request {
+	return &Request{
+		Header:     r.Header,
+		Query:      r.URL.Query(),
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Method:     r.Method,
+		RemoteAddr: r.RemoteAddr,
+		ClientIP:   hostOf(r.RemoteAddr),
+	}
+}
+
+// RequestFromGRPC returns the Request describing the gRPC call to method, whose metadata and peer are read from ctx.
+func RequestFromGRPC(ctx context.Context, method string) *Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &Request{Metadata: md, Path: method}
+	if vals := md.Get(":authority"); len(vals) > 0 {
+		r.Host = vals[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+		r.ClientIP = hostOf(r.RemoteAddr)
+	}
+	return r
+}
+
+// hostOf returns the host part of addr, or addr itself if it has no port.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -1,6 +1,7 @@
 package routing
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -8,10 +9,10 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/fieldpath"
 )
 
 // RegionResolver is a generic resolver whose only job is to return the correct region based on input.
@@ -23,6 +24,7 @@ type httpResolver struct {
 	retrieverCfg *config.RegionRetriever
 	resolverCfg  *config.RegionResolver
 	client       *http.Client
+	authenticate authenticator
 }
 
 type staticResolver struct {
@@ -51,15 +53,97 @@ func WithHTTPClient(client *http.Client) ResolverOption {
 }
 
 // NewResolver instantiates a new implementation of RegionResolver based on the value of [config.RegionRetriever.Type].
+// The resolver is wrapped by the configured [config.RetryPolicy] and [config.CircuitBreaker], then,
+// if [config.RegionRetriever.Cache] is defined, by an LRU cache.
+// The error policies of [config.RegionResolver] are applied on top of the cache.
+// Resolvers holding resources (e.g. database connections) implement [io.Closer].
 func NewResolver(cfg *config.RegionRetriever, opts ...ResolverOption) (RegionResolver, error) {
+	if cfg.RegionResolver != nil {
+		// compiled before the resolver is shared between requests
+		if err := cfg.RegionResolver.Compile(); err != nil {
+			return nil, fmt.Errorf("region resolver: %w", err)
+		}
+	}
+
+	var r RegionResolver
 	switch cfg.Type {
 	case config.RegionResolverTypeHTTP:
-		return newHTTPResolver(cfg, opts...), nil
+		var err error
+		if r, err = newHTTPResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
 	case config.RegionResolverTypeStatic:
-		return newStaticResolver(cfg), nil
+		r = newStaticResolver(cfg)
+	case config.RegionResolverTypeSQL:
+		var err error
+		if r, err = newSQLResolver(cfg); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeGRPC:
+		var err error
+		if r, err = newGRPCResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeGeoIP:
+		var err error
+		if r, err = newGeoIPResolver(cfg); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeChain:
+		var err error
+		if r, err = newChainResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeFirstOf:
+		var err error
+		if r, err = newFirstOfResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeSnapshot:
+		var err error
+		if r, err = newSnapshotResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
+	case config.RegionResolverTypeFile:
+		var err error
+		if r, err = newFileResolver(cfg, opts...); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unknown resolver type: %s", cfg.Type)
 	}
+
+	// retries happen behind the circuit breaker, which counts a single failure per lookup
+	if cfg.Retry != nil {
+		r = newRetryResolver(r, cfg.Retry)
+	}
+	if cfg.CircuitBreaker != nil {
+		r = newBreakerResolver(r, cfg.CircuitBreaker)
+	}
+
+	if cfg.Cache != nil {
+		attributes, err := cfg.RequestAttributes()
+		if err != nil {
+			_ = closeResolver(r)
+			return nil, fmt.Errorf("region cache: %w", err)
+		}
+		cached, err := newCachedResolver(r, cfg.Cache, attributes)
+		if err != nil {
+			_ = closeResolver(r)
+			return nil, err
+		}
+		r = cached
+	}
+
+	if needsFallback(cfg.RegionResolver) {
+		fallback, err := newFallbackResolver(r, cfg.RegionResolver, opts...)
+		if err != nil {
+			_ = closeResolver(r)
+			return nil, err
+		}
+		return fallback, nil
+	}
+	return r, nil
 }
 
 func newStaticResolver(cfg *config.RegionRetriever) RegionResolver {
@@ -70,50 +154,53 @@ func (x *staticResolver) ResolveRegion(_ context.Context, _ string) (string, err
 	return x.staticVal, nil
 }
 
-func newHTTPResolver(cfg *config.RegionRetriever, options ...ResolverOption) RegionResolver {
+func newHTTPResolver(cfg *config.RegionRetriever, options ...ResolverOption) (RegionResolver, error) {
 	timeout, err := time.ParseDuration(cfg.Timeout)
 	if err != nil || timeout == 0 {
 		timeout = 3 * time.Second
 	}
 
+	authenticate, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: auth: %w", err)
+	}
+
 	r := &httpResolver{
 		retrieverCfg: cfg,
 		resolverCfg:  cfg.RegionResolver,
 		client:       &http.Client{Timeout: timeout},
+		authenticate: authenticate,
 	}
 
 	for _, option := range options {
 		option.apply(r)
 	}
 
-	return r
-}
-
-func (x *httpResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
-	var resp *http.Response
-	switch x.retrieverCfg.Method {
-	case http.MethodGet:
-		u, err := url.Parse(x.retrieverCfg.URL)
+	if cfg.TLS != nil {
+		tlsCfg, err := newTLSConfig(cfg.TLS)
 		if err != nil {
-			return "", fmt.Errorf("region resolver: failed to parse retriever endpoint (%s): %w", x.retrieverCfg.URL, err)
+			return nil, fmt.Errorf("region resolver: tls: %w", err)
 		}
+		// the transport is replaced on a copy, the client given with WithHTTPClient may be shared
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsCfg
+		client := *r.client
+		client.Transport = transport
+		r.client = &client
+	}
 
-		q := u.Query()
-		q.Set(x.retrieverCfg.QueryParam, param)
-		u.RawQuery = q.Encode()
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
-		if err != nil {
-			return "", fmt.Errorf("region resolver: failed to create GET request: %w", err)
-		}
+	return r, nil
+}
 
-		resp, err = x.client.Do(req)
-		if err != nil {
-			return "", fmt.Errorf("region resolver: failed to send GET request: %w", err)
-		}
+func (x *httpResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	req, err := x.newRequest(ctx, param)
+	if err != nil {
+		return "", err
+	}
 
-		// TODO: handle post with body params
-	default:
-		return "", fmt.Errorf("region resolver: unsupported data retriever method: %s", x.retrieverCfg.Method)
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: failed to send %s request: %w", req.Method, err)
 	}
 
 	defer func() {
@@ -122,6 +209,9 @@ func (x *httpResolver) ResolveRegion(ctx context.Context, param string) (string,
 			log.Printf("region resolver: failed to close response body: %v\n", err)
 		}
 	}()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", fmt.Errorf("region resolver: %w", &StatusError{StatusCode: resp.StatusCode})
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("region resolver: failed to read response body: %w", err)
@@ -133,7 +223,7 @@ func (x *httpResolver) ResolveRegion(ctx context.Context, param string) (string,
 		return "", fmt.Errorf("region resolver: unmarshal response failed: %w", err)
 	}
 
-	region, err := x.resolve(responseJSON)
+	region, err := x.resolve(ctx, param, responseJSON)
 	if err != nil {
 		return "", fmt.Errorf("region resolver: failed to resolve response: %w", err)
 	}
@@ -141,29 +231,103 @@ func (x *httpResolver) ResolveRegion(ctx context.Context, param string) (string,
 	return region, nil
 }
 
-func (x *httpResolver) resolve(m map[string]any) (string, error) {
-	// support nested fields using dot notation (e.g. info.location.region.short_code)
-	parts := strings.Split(x.resolverCfg.Field, ".")
-	var cur any = m
-	for _, p := range parts {
-		mp, ok := cur.(map[string]any)
-		if !ok {
-			return "", fmt.Errorf("region at %s is not a nested object", x.resolverCfg.Field)
+// newRequest builds the request to the retriever endpoint carrying param either in the URL template,
+// as query parameter or, for methods with a body, inside the configured JSON body template.
+func (x *httpResolver) newRequest(ctx context.Context, param string) (*http.Request, error) {
+	rawURL := expandTemplate(ctx, x.retrieverCfg.URL, param, url.PathEscape)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: failed to parse retriever endpoint (%s): %w", rawURL, err)
+	}
+
+	if x.retrieverCfg.QueryParam != "" || len(x.retrieverCfg.QueryParams) > 0 {
+		q := u.Query()
+		for name, value := range x.retrieverCfg.QueryParams {
+			q.Set(name, expandTemplate(ctx, value, param, noEscape))
 		}
-		v, ok := mp[p]
-		if !ok {
-			return "", fmt.Errorf("region not found at %s", x.resolverCfg.Field)
+		if x.retrieverCfg.QueryParam != "" {
+			q.Set(x.retrieverCfg.QueryParam, param)
 		}
-		cur = v
+		u.RawQuery = q.Encode()
 	}
-	key, ok := cur.(string)
-	if !ok {
-		return "", fmt.Errorf("region at %s is not a string (%T)", x.resolverCfg.Field, cur)
+
+	var (
+		req  *http.Request
+		body []byte
+	)
+	switch x.retrieverCfg.Method {
+	case http.MethodGet:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+		if err != nil {
+			return nil, fmt.Errorf("region resolver: failed to create GET request: %w", err)
+		}
+	case http.MethodPost, http.MethodPut:
+		if body, err = x.newBody(param); err != nil {
+			return nil, err
+		}
+		req, err = http.NewRequestWithContext(ctx, x.retrieverCfg.Method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("region resolver: failed to create %s request: %w", x.retrieverCfg.Method, err)
+		}
+		contentType := x.retrieverCfg.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	default:
+		return nil, fmt.Errorf("region resolver: unsupported data retriever method: %s", x.retrieverCfg.Method)
+	}
+
+	for name, value := range x.retrieverCfg.Headers {
+		req.Header.Set(name, expandTemplate(ctx, value, param, noEscape))
+	}
+	x.authenticate(req, body)
+	return req, nil
+}
+
+// newBody renders the body template with param set at the configured body key.
+func (x *httpResolver) newBody(param string) ([]byte, error) {
+	body := map[string]any{}
+	if x.retrieverCfg.BodyTemplate != "" {
+		if err := json.Unmarshal([]byte(x.retrieverCfg.BodyTemplate), &body); err != nil {
+			return nil, fmt.Errorf("region resolver: invalid body template: %w", err)
+		}
+	}
+	if err := fieldpath.Set(body, x.retrieverCfg.BodyParam, param); err != nil {
+		return nil, fmt.Errorf("region resolver: failed to set body param: %w", err)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: failed to marshal request body: %w", err)
 	}
+	return b, nil
+}
+
+func (x *httpResolver) resolve(ctx context.Context, param string, m map[string]any) (string, error) {
+	if x.resolverCfg.Type == config.RegionResolverTypeExpr {
+		return evalRegion(ctx, x.resolverCfg, param, m)
+	}
+	// support nested fields using dot notation (e.g. info.location.region.short_code)
+	key, err := fieldpath.String(m, x.resolverCfg.Field)
+	if err != nil {
+		return "", err
+	}
+	return mapRegion(x.resolverCfg, key)
+}
 
-	region, ok := x.resolverCfg.Mapping[key]
+// mapRegion translates the value returned by a retriever into a region using the resolver mapping.
+func mapRegion(cfg *config.RegionResolver, key string) (string, error) {
+	region, ok := cfg.Map(key)
 	if !ok {
-		return "", fmt.Errorf("no mapping specified for %s", key)
+		return "", fmt.Errorf("%w for %s", ErrNoMapping, key)
 	}
 	return region, nil
 }
+
+// closeResolver releases the resources held by r, if any.
+func closeResolver(r RegionResolver) error {
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
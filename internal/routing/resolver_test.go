@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"google.golang.org/grpc/metadata"
+
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/routing"
 )
@@ -47,3 +49,123 @@ func TestHTTPResolver(t *testing.T) {
 		t.Fatalf("unexpected region: %s", region)
 	}
 }
+
+func TestHTTPResolver_Post(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Lookup struct {
+				UserID string `json:"user_id"`
+			} `json:"lookup"`
+			Source string `json:"source"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Source != "poly-route" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": req.Lookup.UserID})
+	}))
+	defer srv.Close()
+
+	retr := &config.RegionRetriever{
+		Type:         config.RegionResolverTypeHTTP,
+		URL:          srv.URL,
+		Method:       http.MethodPost,
+		BodyTemplate: `{"source": "poly-route"}`,
+		BodyParam:    "lookup.user_id",
+		Headers:      map[string]string{"X-Api-Key": "secret"},
+		RegionResolver: &config.RegionResolver{
+			Type:    "map",
+			Field:   "country",
+			Mapping: map[string]string{"alice": "region-A"},
+		},
+	}
+
+	rslv, err := routing.NewResolver(retr)
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+
+	region, err := rslv.ResolveRegion(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error resolving region: %v", err)
+	}
+	if region != "region-A" {
+		t.Fatalf("unexpected region: %s", region)
+	}
+}
+
+func TestHTTPResolver_Template(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"path":   r.URL.EscapedPath(),
+			"tenant": r.URL.Query().Get("tenant"),
+			"trace":  r.Header.Get("X-Trace"),
+		})
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		req   *routing.Request
+		name  string
+		field string
+		param string
+		want  string
+	}{
+		{name: "escaped path param", field: "path", param: "a/b c", want: "/users/a%2Fb%20c/profile"},
+		{
+			name:  "query param from header",
+			field: "tenant",
+			req:   &routing.Request{Header: http.Header{"X-Tenant": {"acme"}}},
+			param: "alice",
+			want:  "acme-alice",
+		},
+		{
+			name:  "header from metadata",
+			field: "trace",
+			req:   &routing.Request{Metadata: metadata.Pairs("trace-id", "t1")},
+			param: "alice",
+			want:  "t1",
+		},
+		{name: "missing request attribute", field: "tenant", param: "alice", want: "-alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(&config.RegionRetriever{
+				Type:        config.RegionResolverTypeHTTP,
+				URL:         srv.URL + "/users/{param}/profile",
+				Method:      http.MethodGet,
+				QueryParams: map[string]string{"tenant": "{header:X-Tenant}-{param}"},
+				Headers:     map[string]string{"X-Trace": "{metadata:trace-id}"},
+				RegionResolver: &config.RegionResolver{
+					Type:       config.RegionResolverTypeExpr,
+					Expression: `resp.` + tt.field,
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+
+			ctx := context.Background()
+			if tt.req != nil {
+				ctx = routing.WithRequest(ctx, tt.req)
+			}
+			got, err := rslv.ResolveRegion(ctx, tt.param)
+			if err != nil {
+				t.Fatalf("ResolveRegion() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
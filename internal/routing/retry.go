@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = time.Second
+)
+
+// StatusError is returned when the http retriever responds with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("retriever responded with status %d", e.StatusCode)
+}
+
+// retryResolver retries the calls of the wrapped resolver that fail with a transient error.
+type retryResolver struct {
+	next           RegionResolver
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+}
+
+func newRetryResolver(next RegionResolver, cfg *config.RetryPolicy) RegionResolver {
+	initialBackoff, err := time.ParseDuration(cfg.InitialBackoff)
+	if err != nil || initialBackoff <= 0 {
+		initialBackoff = defaultInitialBackoff
+	}
+	maxBackoff, err := time.ParseDuration(cfg.MaxBackoff)
+	if err != nil || maxBackoff <= 0 {
+		maxBackoff = max(defaultMaxBackoff, initialBackoff)
+	}
+
+	return &retryResolver{
+		next:           next,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		maxAttempts:    max(cfg.MaxAttempts, 1),
+	}
+}
+
+func (x *retryResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	backoff := x.initialBackoff
+	for attempt := 1; ; attempt++ {
+		region, err := x.next.ResolveRegion(ctx, param)
+		if err == nil || attempt == x.maxAttempts || !isTransient(ctx, err) {
+			return region, err
+		}
+
+		// full jitter spreads the retries of concurrent lookups
+		wait := rand.N(backoff + 1) //nolint:gosec // jitter does not need a secure source
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w (after: %w)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, x.maxBackoff)
+	}
+}
+
+// Close releases the resources held by the wrapped resolver.
+func (x *retryResolver) Close() error {
+	return closeResolver(x.next)
+}
+
+// isTransient reports whether err is a failure of the retriever that may not happen again,
+// as opposed to failures caused by the lookup value or by the caller giving up.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,128 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+// newFlakyServer returns a region retriever that responds with the given status codes, in order,
+// before echoing the user_id query parameter as the "country" field.
+func newFlakyServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := calls.Add(1); int(n) <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryResolver(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		attempts  int
+		wantCalls int64
+		wantErr   bool
+	}{
+		{name: "transient failures", statuses: []int{503, 500}, attempts: 3, wantCalls: 3},
+		{name: "too many requests", statuses: []int{429}, attempts: 3, wantCalls: 2},
+		{name: "attempts exhausted", statuses: []int{503, 503, 503}, attempts: 2, wantCalls: 2, wantErr: true},
+		{name: "client errors are not retried", statuses: []int{404}, attempts: 3, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newFlakyServer(t, tt.statuses...)
+			retr := newCachedRetriever(srv.URL, nil)
+			retr.Retry = &config.RetryPolicy{MaxAttempts: tt.attempts, InitialBackoff: "1ms", MaxBackoff: "5ms"}
+			rslv, err := routing.NewResolver(retr)
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+
+			region, err := rslv.ResolveRegion(context.Background(), "alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && region != "region-A" {
+				t.Errorf("ResolveRegion() got = %v, want %v", region, "region-A")
+			}
+			var statusErr *routing.StatusError
+			if tt.wantErr && !errors.As(err, &statusErr) {
+				t.Errorf("ResolveRegion() error = %v, want a StatusError", err)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestBreakerResolver(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"country": r.URL.Query().Get("user_id")})
+	}))
+	t.Cleanup(srv.Close)
+
+	retr := newCachedRetriever(srv.URL, nil)
+	retr.CircuitBreaker = &config.CircuitBreaker{FailureThreshold: 2, OpenTimeout: "30ms"}
+	rslv, err := routing.NewResolver(retr)
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+
+	for range 2 {
+		if _, err = rslv.ResolveRegion(context.Background(), "alice"); errors.Is(err, routing.ErrCircuitOpen) {
+			t.Fatalf("ResolveRegion() error = %v before the threshold", err)
+		}
+	}
+	if _, err = rslv.ResolveRegion(context.Background(), "alice"); !errors.Is(err, routing.ErrCircuitOpen) {
+		t.Fatalf("ResolveRegion() error = %v, want %v", err, routing.ErrCircuitOpen)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", got)
+	}
+
+	// a failed probe opens the circuit again
+	time.Sleep(40 * time.Millisecond)
+	if _, err = rslv.ResolveRegion(context.Background(), "alice"); errors.Is(err, routing.ErrCircuitOpen) {
+		t.Fatalf("ResolveRegion() error = %v, want the probe to reach the retriever", err)
+	}
+	if _, err = rslv.ResolveRegion(context.Background(), "alice"); !errors.Is(err, routing.ErrCircuitOpen) {
+		t.Fatalf("ResolveRegion() error = %v, want %v", err, routing.ErrCircuitOpen)
+	}
+
+	// a successful probe closes it
+	down.Store(false)
+	time.Sleep(40 * time.Millisecond)
+	for range 2 {
+		region, err := rslv.ResolveRegion(context.Background(), "alice")
+		if err != nil {
+			t.Fatalf("ResolveRegion() error = %v", err)
+		}
+		if region != "region-A" {
+			t.Errorf("ResolveRegion() got = %v, want %v", region, "region-A")
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package routing
 
 import (
-	"slices"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/CanobbioE/poly-route/internal/config"
@@ -11,6 +13,7 @@ type routeKind int
 
 const (
 	// RouteExact indicates that the full route path must be matched exactly.
+	// Its segments can be parameters (e.g. "/users/{id}") or wildcards (e.g. "/api/*/health").
 	RouteExact routeKind = iota
 
 	// RoutePrefix indicates that just the route's prefix must be matched (e.g. "/api/v1/*").
@@ -18,44 +21,281 @@ const (
 
 	// RouteMatchAll is a route matching wildcard, all routes will be matched (e.g. "*" or "/*").
 	RouteMatchAll
+
+	// RouteRegex indicates that the full route path must match a regular expression (e.g. "regex:^/v[0-9]+/").
+	RouteRegex
 )
 
 // CompiledRoute represents a route that has been pre-compiled for faster lookup.
 type CompiledRoute struct {
+	// Mappings are the unconditional mappings of the route, nil if it only has variants.
 	Mappings map[string]string
-	Prefix   string
+	re       *regexp.Regexp
+	// Key is the destination key of the route, e.g. "/users/{id}/*".
+	Key    string
+	Prefix string
+	// params holds the names of the parameter segments of the route, empty for wildcards.
+	params []string
+	// variants are the mappings restricted by predicates, in the order of the configuration.
+	variants []*routeVariant
 	Kind     routeKind
 }
 
-// CompileRoutes returns a slice of CompiledRoute generated from the destinations defined in cfg.
-func CompileRoutes(cfg *config.ProtocolCfg, p config.Protocol) []*CompiledRoute {
-	var exact, prefix, matchAll []*CompiledRoute
-
-	for key, mappings := range cfg.Destinations {
-		r := &CompiledRoute{Mappings: mappings}
-		switch {
-		case key == "*" || key == "/*":
-			r.Kind = RouteMatchAll
-			matchAll = append(matchAll, r)
-		case strings.HasSuffix(key, "/*"):
-			r.Kind = RoutePrefix
-			r.Prefix = key[:len(key)-2]
-			if p == config.ProtocolGRPC {
-				// strip "*", keep trailing "/"
-				r.Prefix = key[:len(key)-1]
-			}
-			prefix = append(prefix, r)
-		default:
-			r.Kind = RouteExact
-			r.Prefix = key
-			exact = append(exact, r)
+// RouteMatch is the route matching an entrypoint.
+type RouteMatch struct {
+	Route *CompiledRoute
+	// Params holds the values of the parameters of the route, by name.
+	Params map[string]string
+	// Suffix is the part of the entrypoint following the prefix of a RoutePrefix route,
+	// the whole entrypoint for a RouteMatchAll route, and empty otherwise.
+	Suffix string
+}
+
+// RouteTable is a trie of the compiled routes of a protocol, indexed by path segment,
+// so that matching a path takes a time proportional to its length rather than to the number of routes.
+type RouteTable struct {
+	root     *routeNode
+	matchAll *CompiledRoute
+	// regexps is sorted by key.
+	regexps []*CompiledRoute
+	// singleLevel is true when prefixes only match the paths one segment longer, e.g. gRPC services.
+	singleLevel bool
+}
+
+// routeNode holds the routes whose path ends with the segments leading to it.
+type routeNode struct {
+	children map[string]*routeNode
+	// param is the child matching any non-empty segment.
+	param  *routeNode
+	exact  *CompiledRoute
+	prefix *CompiledRoute
+}
+
+// prefixMatch is the deepest prefix route found while walking the trie.
+type prefixMatch struct {
+	route  *CompiledRoute
+	values []string
+	end    int
+	depth  int
+}
+
+// CompileRoutes returns the RouteTable of the destinations and the top level routes defined in cfg.
+// The keys are expected to be validated, see config.ProtocolCfg.
+func CompileRoutes(cfg *config.ProtocolCfg, p config.Protocol) *RouteTable {
+	var routes []*config.Route
+	for i := range cfg.Routes {
+		if cfg.Routes[i].Host == "" {
+			routes = append(routes, &cfg.Routes[i])
+		}
+	}
+	return compileRoutes(cfg.Destinations, routes, p)
+}
+
+// compileRoutes returns the RouteTable of destinations, whose keys are restricted by the predicates of routes.
+func compileRoutes(destinations map[string]map[string]string, routes []*config.Route, p config.Protocol) *RouteTable {
+	t := &RouteTable{root: &routeNode{}, singleLevel: p == config.ProtocolGRPC}
+
+	keys := make(map[string]*CompiledRoute, len(destinations))
+	for key, mappings := range destinations {
+		keys[key] = t.add(key, mappings, p)
+	}
+	for _, route := range routes {
+		r, ok := keys[route.Path]
+		if !ok {
+			// a path without destinations only matches the requests satisfying its predicates
+			r = t.add(route.Path, nil, p)
+			keys[route.Path] = r
+		}
+		if r != nil {
+			r.variants = append(r.variants, newRouteVariant(route))
 		}
 	}
 
-	// sort descending by prefix length.
-	slices.SortFunc(prefix, func(a, b *CompiledRoute) int {
-		return len(b.Prefix) - len(a.Prefix)
+	sort.Slice(t.regexps, func(i, j int) bool {
+		return t.regexps[i].Prefix < t.regexps[j].Prefix
 	})
+	return t
+}
+
+// add compiles the destination key and adds it to t, it returns nil if key is an invalid regular expression.
+func (t *RouteTable) add(key string, mappings map[string]string, p config.Protocol) *CompiledRoute {
+	r := &CompiledRoute{Mappings: mappings, Key: key}
+	switch {
+	case key == "*" || key == "/*":
+		r.Kind = RouteMatchAll
+		t.matchAll = r
+	case strings.HasPrefix(key, config.RouteRegexPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(key, config.RouteRegexPrefix))
+		if err != nil {
+			return nil
+		}
+		r.Kind = RouteRegex
+		r.Prefix = key
+		r.re = re
+		t.regexps = append(t.regexps, r)
+	case strings.HasSuffix(key, "/*"):
+		r.Kind = RoutePrefix
+		r.Prefix = key[:len(key)-2]
+		if p == config.ProtocolGRPC {
+			// strip "*", keep trailing "/"
+			r.Prefix = key[:len(key)-1]
+		}
+		t.insert(key[:len(key)-2], r).prefix = r
+	default:
+		r.Kind = RouteExact
+		r.Prefix = key
+		t.insert(key, r).exact = r
+	}
+	return r
+}
+
+// insert returns the node of path, creating the missing ones, and records the parameters of r.
+func (t *RouteTable) insert(path string, r *CompiledRoute) *routeNode {
+	node := t.root
+	for segment := range strings.SplitSeq(path, "/") {
+		if name, ok := config.RouteParam(segment); ok {
+			r.params = append(r.params, name)
+			if node.param == nil {
+				node.param = &routeNode{}
+			}
+			node = node.param
+			continue
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			if node.children == nil {
+				node.children = map[string]*routeNode{}
+			}
+			child = &routeNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// Match returns the best route for entrypoint, in order of precedence:
+// an exact match, preferring literal segments over parameters from left to right,
+// then the first matching regular expression, then the longest matching prefix, then the match-all route.
+func (t *RouteTable) Match(entrypoint string) (RouteMatch, bool) {
+	if r, values := t.root.matchExact(entrypoint, nil); r != nil {
+		return RouteMatch{Route: r, Params: r.bind(values)}, true
+	}
+
+	for _, r := range t.regexps {
+		if sub := r.re.FindStringSubmatch(entrypoint); sub != nil {
+			m := RouteMatch{Route: r, Params: map[string]string{}}
+			for i, name := range r.re.SubexpNames() {
+				if name != "" {
+					m.Params[name] = sub[i]
+				}
+			}
+			return m, true
+		}
+	}
+
+	// single level prefixes match at the depth of the parent of entrypoint
+	best := &prefixMatch{depth: -1}
+	t.matchPrefix(t.root, entrypoint, 0, 0, strings.Count(entrypoint, "/")-1, nil, best)
+	if best.route != nil {
+		return RouteMatch{Route: best.route, Params: best.route.bind(best.values), Suffix: entrypoint[best.end:]}, true
+	}
+
+	if t.matchAll == nil {
+		return RouteMatch{}, false
+	}
+	return RouteMatch{Route: t.matchAll, Suffix: entrypoint}, true
+}
+
+// matchExact returns the exact route matching rest below n, with the values of its parameters.
+func (n *routeNode) matchExact(rest string, values []string) (*CompiledRoute, []string) {
+	segment, after, more := strings.Cut(rest, "/")
+	for i, child := range [2]*routeNode{n.children[segment], n.param} {
+		if child == nil || (i == 1 && segment == "") {
+			continue
+		}
+		v := values
+		if i == 1 {
+			v = append(v[:len(v):len(v)], segment)
+		}
+		if !more {
+			if child.exact != nil {
+				return child.exact, v
+			}
+			continue
+		}
+		if r, v := child.matchExact(after, v); r != nil {
+			return r, v
+		}
+	}
+	return nil, nil
+}
+
+// matchPrefix records in best the deepest prefix route matching the segment of entrypoint starting at start.
+// Literal segments are preferred over parameters at the same depth.
+func (t *RouteTable) matchPrefix(
+	n *routeNode,
+	entrypoint string,
+	start, depth, parentDepth int,
+	values []string,
+	best *prefixMatch,
+) {
+	end := strings.IndexByte(entrypoint[start:], '/')
+	more := end >= 0
+	if more {
+		end += start
+	} else {
+		end = len(entrypoint)
+	}
+	segment := entrypoint[start:end]
 
-	return append(append(exact, prefix...), matchAll...)
+	for i, child := range [2]*routeNode{n.children[segment], n.param} {
+		if child == nil || (i == 1 && segment == "") {
+			continue
+		}
+		v := values
+		if i == 1 {
+			v = append(v[:len(v):len(v)], segment)
+		}
+		if child.prefix != nil && depth > best.depth && (!t.singleLevel || depth == parentDepth) {
+			*best = prefixMatch{route: child.prefix, values: v, end: end, depth: depth}
+		}
+		if more {
+			t.matchPrefix(child, entrypoint, end+1, depth+1, parentDepth, v, best)
+		}
+	}
+}
+
+// bind returns the values of the parameters of r by name.
+func (r *CompiledRoute) bind(values []string) map[string]string {
+	if len(r.params) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(r.params))
+	for i, name := range r.params {
+		if name != "" && i < len(values) {
+			params[name] = values[i]
+		}
+	}
+	return params
+}
+
+// Expand replaces the {name} placeholders of dest with the escaped values of the parameters of the route.
+func (m RouteMatch) Expand(dest string) string {
+	if len(m.Params) == 0 || !strings.Contains(dest, "{") {
+		return dest
+	}
+	pairs := make([]string, 0, 2*len(m.Params))
+	for name, value := range m.Params {
+		pairs = append(pairs, "{"+name+"}", escapeSegment(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(dest)
+}
+
+// escapeSegment escapes value to be used as a path segment, including the "." and ".." segments.
+func escapeSegment(value string) string {
+	if value == "." || value == ".." {
+		return strings.ReplaceAll(value, ".", "%2E")
+	}
+	return url.PathEscape(value)
 }
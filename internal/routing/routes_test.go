@@ -0,0 +1,246 @@
+package routing_test
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestRouteMatch_Expand(t *testing.T) {
+	m := routing.RouteMatch{Params: map[string]string{"id": "a b", "up": ".."}}
+	tests := []struct {
+		name string
+		dest string
+		want string
+	}{
+		{name: "escaped", dest: "http://orders-eu/v2/{id}", want: "http://orders-eu/v2/a%20b"},
+		{name: "dot segment", dest: "http://orders-eu/v2/{up}/x", want: "http://orders-eu/v2/%2E%2E/x"},
+		{name: "unknown placeholder", dest: "http://orders-eu/{other}", want: "http://orders-eu/{other}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Expand(tt.dest); got != tt.want {
+				t.Errorf("Expand() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTable_Match(t *testing.T) {
+	destinations := func(keys ...string) *config.ProtocolCfg {
+		cfg := &config.ProtocolCfg{Destinations: map[string]map[string]string{}}
+		for _, key := range keys {
+			cfg.Destinations[key] = map[string]string{"region": key}
+		}
+		return cfg
+	}
+
+	tests := []struct {
+		cfg        *config.ProtocolCfg
+		wantParams map[string]string
+		name       string
+		protocol   config.Protocol
+		entrypoint string
+		want       string
+		wantSuffix string
+	}{
+		{
+			name:       "exact over prefix",
+			cfg:        destinations("/api/*", "/api/v1"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/api/v1",
+			want:       "/api/v1",
+		},
+		{
+			name:       "longest prefix",
+			cfg:        destinations("*", "/api/*", "/api/v1/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/api/v1/users/42",
+			want:       "/api/v1/*",
+			wantSuffix: "/users/42",
+		},
+		{
+			name:       "prefix matches itself",
+			cfg:        destinations("/api/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/api",
+			want:       "/api/*",
+		},
+		{
+			name:       "prefix matches whole segments",
+			cfg:        destinations("/api/*", "/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/apis/v1",
+			want:       "/*",
+			wantSuffix: "/apis/v1",
+		},
+		{
+			name:       "path parameters",
+			cfg:        destinations("/users/{id}/orders", "/users/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/users/42/orders",
+			want:       "/users/{id}/orders",
+			wantParams: map[string]string{"id": "42"},
+		},
+		{
+			name:       "literal segment over parameter",
+			cfg:        destinations("/users/{id}/orders", "/users/me/{page}"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/users/me/orders",
+			want:       "/users/me/{page}",
+			wantParams: map[string]string{"page": "orders"},
+		},
+		{
+			name:       "parameter backtracking",
+			cfg:        destinations("/users/{id}/orders", "/users/me/settings"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/users/me/orders",
+			want:       "/users/{id}/orders",
+			wantParams: map[string]string{"id": "me"},
+		},
+		{
+			name:       "parameters do not match empty segments",
+			cfg:        destinations("/users/{id}/orders", "*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/users//orders",
+			want:       "*",
+			wantSuffix: "/users//orders",
+		},
+		{
+			name:       "mid-path wildcard",
+			cfg:        destinations("/api/*/health", "/api/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/api/billing/health",
+			want:       "/api/*/health",
+		},
+		{
+			name:       "prefix with parameters",
+			cfg:        destinations("/tenants/{tenant}/*", "/tenants/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/tenants/acme/users/42",
+			want:       "/tenants/{tenant}/*",
+			wantParams: map[string]string{"tenant": "acme"},
+			wantSuffix: "/users/42",
+		},
+		{
+			name:       "regex over prefix",
+			cfg:        destinations(`regex:^/v(?P<version>[0-9]+)/users$`, "/v1/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/v1/users",
+			want:       `regex:^/v(?P<version>[0-9]+)/users$`,
+			wantParams: map[string]string{"version": "1"},
+		},
+		{
+			name:       "exact over regex",
+			cfg:        destinations(`regex:^/v[0-9]+/users$`, "/v1/users"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/v1/users",
+			want:       "/v1/users",
+		},
+		{
+			name:       "exact does not match longer paths",
+			cfg:        destinations("/api", "*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/api/v1",
+			want:       "*",
+			wantSuffix: "/api/v1",
+		},
+		{
+			name:       "no match",
+			cfg:        destinations("/api/*"),
+			protocol:   config.ProtocolHTTP,
+			entrypoint: "/v1",
+		},
+		{
+			name:       "grpc exact over service",
+			cfg:        destinations("/pkg.Service/*", "/pkg.Service/Get"),
+			protocol:   config.ProtocolGRPC,
+			entrypoint: "/pkg.Service/Get",
+			want:       "/pkg.Service/Get",
+		},
+		{
+			name:       "grpc service",
+			cfg:        destinations("*", "/pkg.Service/*"),
+			protocol:   config.ProtocolGRPC,
+			entrypoint: "/pkg.Service/List",
+			want:       "/pkg.Service/*",
+			wantSuffix: "/List",
+		},
+		{
+			name:       "grpc service matches a single level",
+			cfg:        destinations("*", "/pkg/*"),
+			protocol:   config.ProtocolGRPC,
+			entrypoint: "/pkg/Service/List",
+			want:       "*",
+			wantSuffix: "/pkg/Service/List",
+		},
+		{
+			name:       "grpc service does not match itself",
+			cfg:        destinations("/pkg.Service/*"),
+			protocol:   config.ProtocolGRPC,
+			entrypoint: "/pkg.Service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := routing.CompileRoutes(tt.cfg, tt.protocol).Match(tt.entrypoint)
+			if ok != (tt.want != "") {
+				t.Fatalf("Match() ok = %v, want %v", ok, tt.want != "")
+			}
+			if !ok {
+				return
+			}
+			if m.Route.Mappings["region"] != tt.want {
+				t.Errorf("Match() got = %v, want %v", m.Route.Mappings["region"], tt.want)
+			}
+			if !maps.Equal(m.Params, tt.wantParams) {
+				t.Errorf("Match() params = %v, want %v", m.Params, tt.wantParams)
+			}
+			if m.Suffix != tt.wantSuffix {
+				t.Errorf("Match() suffix = %v, want %v", m.Suffix, tt.wantSuffix)
+			}
+		})
+	}
+}
+
+// BenchmarkRouteTable_Match shows that the lookup time does not depend on the number of routes,
+// only on the length of the path.
+func BenchmarkRouteTable_Match(b *testing.B) {
+	for _, n := range []int{10, 100, 2000, 20000} {
+		cfg := &config.ProtocolCfg{Destinations: map[string]map[string]string{"*": {"region": "fallback"}}}
+		for i := range n {
+			cfg.Destinations[fmt.Sprintf("/pkg.Service%d/Method%d", i%50, i)] = map[string]string{"region": "euw1"}
+		}
+		routes := routing.CompileRoutes(cfg, config.ProtocolGRPC)
+		entrypoint := fmt.Sprintf("/pkg.Service%d/Method%d", (n-1)%50, n-1)
+
+		b.Run(fmt.Sprintf("grpc routes=%d", n), func(b *testing.B) {
+			for b.Loop() {
+				if _, ok := routes.Match(entrypoint); !ok {
+					b.Fatal("no route matched")
+				}
+			}
+		})
+	}
+
+	for _, depth := range []int{2, 8, 32} {
+		cfg := &config.ProtocolCfg{Destinations: map[string]map[string]string{}}
+		for i := range 2000 {
+			cfg.Destinations[fmt.Sprintf("/api/v%d/*", i)] = map[string]string{"region": "euw1"}
+		}
+		routes := routing.CompileRoutes(cfg, config.ProtocolHTTP)
+		entrypoint := "/api/v1999" + strings.Repeat("/segment", depth)
+
+		b.Run(fmt.Sprintf("http depth=%d", depth), func(b *testing.B) {
+			for b.Loop() {
+				if _, ok := routes.Match(entrypoint); !ok {
+					b.Fatal("no route matched")
+				}
+			}
+		})
+	}
+}
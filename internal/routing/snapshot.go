@@ -0,0 +1,356 @@
+package routing
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+const (
+	defaultSnapshotInterval     = 5 * time.Minute
+	defaultSnapshotKeyColumn    = "key"
+	defaultSnapshotRegionColumn = "region"
+)
+
+// SnapshotStatus describes the table loaded by a snapshot resolver.
+type SnapshotStatus struct {
+	// LoadedAt is the zero time until the table is loaded for the first time.
+	LoadedAt time.Time `json:"loaded_at"`
+	// LastError is the error of the last load, empty if it succeeded.
+	LastError string `json:"last_error,omitempty"`
+	Source    string `json:"source"`
+	// AgeSeconds is how long ago the table was loaded.
+	AgeSeconds float64 `json:"age_seconds"`
+	Entries    int     `json:"entries"`
+}
+
+// snapshotResolver answers from an in-memory table, periodically replaced by a fresh copy.
+// When watcher is set the table is replaced whenever the file changes instead.
+type snapshotResolver struct {
+	table       atomic.Pointer[snapshotTable]
+	client      *http.Client
+	watcher     *fsnotify.Watcher
+	cfg         *config.SnapshotRetriever
+	resolverCfg *config.RegionResolver
+	// onMiss resolves the values missing from the table, it may be nil.
+	onMiss RegionResolver
+	// monitor is the Monitor the resolver is registered to, it may be nil.
+	monitor      *Monitor
+	headers      map[string]string
+	stop         chan struct{}
+	lastErr      atomic.Pointer[string]
+	format       string
+	keyColumn    string
+	regionColumn string
+	interval     time.Duration
+	timeout      time.Duration
+	stopOnce     sync.Once
+}
+
+type snapshotTable struct {
+	loadedAt time.Time
+	entries  map[string]string
+}
+
+func newSnapshotResolver(cfg *config.RegionRetriever, opts ...ResolverOption) (RegionResolver, error) {
+	interval, err := time.ParseDuration(cfg.Snapshot.Interval)
+	if err != nil || interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	x := &snapshotResolver{
+		client:       &http.Client{Timeout: timeout},
+		cfg:          cfg.Snapshot,
+		resolverCfg:  cfg.RegionResolver,
+		headers:      cfg.Headers,
+		stop:         make(chan struct{}),
+		format:       snapshotFormat(cfg.Snapshot),
+		keyColumn:    cmp.Or(cfg.Snapshot.KeyColumn, defaultSnapshotKeyColumn),
+		regionColumn: cmp.Or(cfg.Snapshot.RegionColumn, defaultSnapshotRegionColumn),
+		interval:     interval,
+		timeout:      timeout,
+	}
+
+	if cfg.Snapshot.Fallthrough != nil {
+		if x.onMiss, err = NewResolver(cfg.Snapshot.Fallthrough, opts...); err != nil {
+			return nil, fmt.Errorf("fallthrough: %w", err)
+		}
+	}
+
+	// without a fallthrough there is nothing to answer with until the table is loaded
+	if err = x.reload(); err != nil && x.onMiss == nil {
+		return nil, fmt.Errorf("region resolver: %w", err)
+	}
+
+	// applied last, so that the monitor only knows the resolvers that were created
+	for _, option := range opts {
+		option.apply(x)
+	}
+	go x.sync()
+	return x, nil
+}
+
+func (x *snapshotResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	var value string
+	var ok bool
+	if table := x.table.Load(); table != nil {
+		value, ok = table.entries[param]
+	}
+	if !ok {
+		if x.onMiss != nil {
+			return x.onMiss.ResolveRegion(ctx, param)
+		}
+		return "", fmt.Errorf("region resolver: %w for %s", ErrNoMapping, param)
+	}
+
+	if x.resolverCfg == nil || x.resolverCfg.Type != config.RegionResolverTypeMap {
+		return value, nil
+	}
+	region, err := mapRegion(x.resolverCfg, value)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: %w", err)
+	}
+	return region, nil
+}
+
+// Close stops the reloads, unregisters the resolver from its Monitor and releases the fallthrough resolver.
+func (x *snapshotResolver) Close() error {
+	x.stopOnce.Do(func() {
+		close(x.stop)
+		if x.watcher != nil {
+			_ = x.watcher.Close()
+		}
+		if x.monitor != nil {
+			x.monitor.remove(x)
+		}
+	})
+	if x.onMiss != nil {
+		return closeResolver(x.onMiss)
+	}
+	return nil
+}
+
+// Status returns the status of the loaded table.
+func (x *snapshotResolver) Status() SnapshotStatus {
+	status := SnapshotStatus{Source: x.cfg.URL + x.cfg.File}
+	if table := x.table.Load(); table != nil {
+		status.LoadedAt = table.loadedAt
+		status.AgeSeconds = time.Since(table.loadedAt).Seconds()
+		status.Entries = len(table.entries)
+	}
+	if lastErr := x.lastErr.Load(); lastErr != nil {
+		status.LastError = *lastErr
+	}
+	return status
+}
+
+// sync reloads the table every interval until the resolver is closed.
+// A failed reload keeps the previous table.
+func (x *snapshotResolver) sync() {
+	ticker := time.NewTicker(x.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-x.stop:
+			return
+		case <-ticker.C:
+			_ = x.reload()
+		}
+	}
+}
+
+// reload fetches and parses the table, then swaps it with the current one.
+func (x *snapshotResolver) reload() error {
+	entries, err := x.load()
+	if err != nil {
+		msg := err.Error()
+		x.lastErr.Store(&msg)
+		return err
+	}
+	x.table.Store(&snapshotTable{entries: entries, loadedAt: time.Now()})
+	x.lastErr.Store(nil)
+	return nil
+}
+
+// load fetches and parses the table.
+// An empty table is an error, as it is more likely a truncated source than the intent to unassign every value.
+func (x *snapshotResolver) load() (map[string]string, error) {
+	data, err := x.fetch()
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]string
+	switch x.format {
+	case config.SnapshotFormatCSV:
+		entries, err = x.parseCSV(data)
+	case config.SnapshotFormatYAML:
+		entries, err = x.parseYAML(data)
+	default:
+		entries, err = x.parseJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("parse snapshot: empty table")
+	}
+	return entries, nil
+}
+
+func (x *snapshotResolver) fetch() ([]byte, error) {
+	if x.cfg.File != "" {
+		data, err := os.ReadFile(filepath.Clean(x.cfg.File))
+		if err != nil {
+			return nil, fmt.Errorf("read snapshot: %w", err)
+		}
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), x.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, x.cfg.URL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot request: %w", err)
+	}
+	for name, value := range x.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch snapshot: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("fetch snapshot: %w", &StatusError{StatusCode: resp.StatusCode})
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// parseJSON accepts either an object of lookup values to region values or an array of objects.
+func (x *snapshotResolver) parseJSON(data []byte) (map[string]string, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		entries := map[string]string{}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("parse snapshot: %w", err)
+		}
+		return entries, nil
+	}
+
+	var rows []map[string]any
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	entries := make(map[string]string, len(rows))
+	for i, row := range rows {
+		key, keyOk := row[x.keyColumn].(string)
+		value, valueOk := row[x.regionColumn].(string)
+		if !keyOk || !valueOk {
+			return nil, fmt.Errorf("parse snapshot: entry %d must have string %q and %q fields",
+				i, x.keyColumn, x.regionColumn)
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// parseYAML accepts the same tables as parseJSON.
+func (x *snapshotResolver) parseYAML(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.New("parse snapshot: empty document")
+	}
+	if doc.Content[0].Kind == yaml.MappingNode {
+		entries := map[string]string{}
+		if err := doc.Content[0].Decode(&entries); err != nil {
+			return nil, fmt.Errorf("parse snapshot: %w", err)
+		}
+		return entries, nil
+	}
+
+	var rows []map[string]string
+	if err := doc.Content[0].Decode(&rows); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	entries := make(map[string]string, len(rows))
+	for i, row := range rows {
+		key, keyOk := row[x.keyColumn]
+		value, valueOk := row[x.regionColumn]
+		if !keyOk || !valueOk {
+			return nil, fmt.Errorf("parse snapshot: entry %d must have %q and %q fields", i, x.keyColumn, x.regionColumn)
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+func (x *snapshotResolver) parseCSV(data []byte) (map[string]string, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("parse snapshot: missing header row")
+	}
+
+	keyIdx, regionIdx := slices.Index(records[0], x.keyColumn), slices.Index(records[0], x.regionColumn)
+	if keyIdx == -1 || regionIdx == -1 {
+		return nil, fmt.Errorf("parse snapshot: header must contain %q and %q", x.keyColumn, x.regionColumn)
+	}
+	entries := make(map[string]string, len(records)-1)
+	for _, record := range records[1:] {
+		entries[record[keyIdx]] = record[regionIdx]
+	}
+	return entries, nil
+}
+
+// snapshotFormat returns the configured format, or the one matching the extension of the source.
+func snapshotFormat(cfg *config.SnapshotRetriever) string {
+	if cfg.Format != "" {
+		return cfg.Format
+	}
+	source := cfg.File
+	if cfg.URL != "" {
+		source, _, _ = strings.Cut(cfg.URL, "?")
+	}
+	switch strings.ToLower(path.Ext(source)) {
+	case ".csv":
+		return config.SnapshotFormatCSV
+	case ".yaml", ".yml":
+		return config.SnapshotFormatYAML
+	default:
+		return config.SnapshotFormatJSON
+	}
+}
@@ -0,0 +1,152 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func TestSnapshotResolver(t *testing.T) {
+	tests := []struct {
+		resolver *config.RegionResolver
+		name     string
+		file     string
+		data     string
+		param    string
+		want     string
+		wantErr  error
+	}{
+		{name: "json object", file: "users.json", data: `{"alice": "euw1", "bob": "use1"}`, param: "bob", want: "use1"},
+		{
+			name:  "json array",
+			file:  "users.json",
+			data:  `[{"key": "alice", "region": "euw1"}, {"key": "bob", "region": "use1"}]`,
+			param: "alice",
+			want:  "euw1",
+		},
+		{name: "csv", file: "users.csv", data: "region,key\neuw1,alice\nuse1,bob\n", param: "alice", want: "euw1"},
+		{
+			name:     "mapped values",
+			file:     "users.json",
+			data:     `{"alice": "eu-west1-b"}`,
+			resolver: &config.RegionResolver{Type: "map", Mapping: map[string]string{"glob:eu-west1-*": "euw1"}},
+			param:    "alice",
+			want:     "euw1",
+		},
+		{name: "missing value", file: "users.json", data: `{"alice": "euw1"}`, param: "bob", wantErr: routing.ErrNoMapping},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(&config.RegionRetriever{
+				Type:           config.RegionResolverTypeSnapshot,
+				Snapshot:       &config.SnapshotRetriever{File: writeFile(t, tt.file, []byte(tt.data))},
+				RegionResolver: tt.resolver,
+			})
+			if err != nil {
+				t.Fatalf("NewResolver() error = %v", err)
+			}
+			defer func() {
+				_ = rslv.(io.Closer).Close()
+			}()
+
+			got, err := rslv.ResolveRegion(context.Background(), tt.param)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRegion() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotResolver_Reload(t *testing.T) {
+	path := writeFile(t, "users.json", []byte(`{"alice": "euw1"}`))
+	monitor := routing.NewMonitor()
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type:     config.RegionResolverTypeSnapshot,
+		Snapshot: &config.SnapshotRetriever{File: path, Interval: "10ms"},
+	}, routing.WithMonitor(monitor))
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+	defer func() {
+		_ = rslv.(io.Closer).Close()
+	}()
+
+	// a broken table keeps the previous one
+	if err = os.WriteFile(path, []byte(`{"alice": `), 0o600); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, err := rslv.ResolveRegion(context.Background(), "alice"); err != nil || got != "euw1" {
+		t.Fatalf("ResolveRegion() got = %v, %v, want %v", got, err, "euw1")
+	}
+	if status := monitor.Snapshots(); len(status) != 1 || status[0].LastError == "" || status[0].Entries != 1 {
+		t.Fatalf("Snapshots() got = %+v, want a failed reload of 1 entry", status)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"alice": "use1", "bob": "use1"}`), 0o600); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, err := rslv.ResolveRegion(context.Background(), "alice"); err != nil || got != "use1" {
+		t.Fatalf("ResolveRegion() got = %v, %v, want %v", got, err, "use1")
+	}
+
+	rec := httptest.NewRecorder()
+	monitor.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+	var status struct {
+		Snapshots []routing.SnapshotStatus `json:"snapshots"`
+	}
+	if err = json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if len(status.Snapshots) != 1 || status.Snapshots[0].Entries != 2 || status.Snapshots[0].LastError != "" {
+		t.Errorf("ServeHTTP() got = %+v, want a snapshot of 2 entries", status.Snapshots)
+	}
+}
+
+func TestSnapshotResolver_Fallthrough(t *testing.T) {
+	srv, calls := newCountingServer(t, 0)
+	snapshot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"alice": "region-S"})
+	}))
+	defer snapshot.Close()
+
+	rslv, err := routing.NewResolver(&config.RegionRetriever{
+		Type: config.RegionResolverTypeSnapshot,
+		Snapshot: &config.SnapshotRetriever{
+			URL:         snapshot.URL,
+			Fallthrough: newCachedRetriever(srv.URL, nil),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+	defer func() {
+		_ = rslv.(io.Closer).Close()
+	}()
+
+	for param, want := range map[string]string{"alice": "region-S", "bob": "region-B"} {
+		got, err := rslv.ResolveRegion(context.Background(), param)
+		if err != nil {
+			t.Fatalf("ResolveRegion(%s) error = %v", param, err)
+		}
+		if got != want {
+			t.Errorf("ResolveRegion(%s) got = %v, want %v", param, got, want)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call to the fallthrough retriever, got %d", got)
+	}
+}
@@ -0,0 +1,136 @@
+package routing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// sqlResolver retrieves the region value by running a parameterised query against a database.
+// The database driver must be registered by the importing binary.
+type sqlResolver struct {
+	db          *sql.DB
+	cfg         *config.SQLRetriever
+	resolverCfg *config.RegionResolver
+	timeout     time.Duration
+}
+
+func newSQLResolver(cfg *config.RegionRetriever) (RegionResolver, error) {
+	db, err := sql.Open(cfg.SQL.Driver, cfg.SQL.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("region resolver: failed to open %s database: %w", cfg.SQL.Driver, err)
+	}
+
+	// unset limits keep the defaults of database/sql: unlimited open connections and 2 idle ones
+	if cfg.SQL.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.SQL.MaxOpenConns)
+	}
+	if cfg.SQL.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.SQL.MaxIdleConns)
+	}
+	if lifetime, err := time.ParseDuration(cfg.SQL.ConnMaxLifetime); err == nil {
+		db.SetConnMaxLifetime(lifetime)
+	}
+
+	timeout, err := time.ParseDuration(cfg.SQL.QueryTimeout)
+	if err != nil || timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	return &sqlResolver{
+		db:          db,
+		cfg:         cfg.SQL,
+		resolverCfg: cfg.RegionResolver,
+		timeout:     timeout,
+	}, nil
+}
+
+func (x *sqlResolver) ResolveRegion(ctx context.Context, param string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, x.timeout)
+	defer cancel()
+
+	row, column, err := x.query(ctx, param)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: %w", err)
+	}
+
+	if x.resolverCfg.Type == config.RegionResolverTypeExpr {
+		region, err := evalRegion(ctx, x.resolverCfg, param, row)
+		if err != nil {
+			return "", fmt.Errorf("region resolver: failed to resolve response: %w", err)
+		}
+		return region, nil
+	}
+
+	key, ok := row[column].(string)
+	if !ok {
+		return "", fmt.Errorf("region resolver: column %s is null", column)
+	}
+	region, err := mapRegion(x.resolverCfg, key)
+	if err != nil {
+		return "", fmt.Errorf("region resolver: failed to resolve response: %w", err)
+	}
+	return region, nil
+}
+
+// query runs the configured query and returns the first row, with NULL values set to nil,
+// along with the name of the result column.
+func (x *sqlResolver) query(ctx context.Context, param string) (row map[string]any, column string, err error) {
+	rows, err := x.db.QueryContext(ctx, x.cfg.Query, param)
+	if err != nil {
+		return nil, "", fmt.Errorf("query failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, "", errors.New("query returned no columns")
+	}
+	column = columns[0]
+	if x.cfg.Column != "" {
+		if !slices.Contains(columns, x.cfg.Column) {
+			return nil, "", fmt.Errorf("column %s not found in query result", x.cfg.Column)
+		}
+		column = x.cfg.Column
+	}
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, "", fmt.Errorf("failed to read rows: %w", err)
+		}
+		return nil, "", errors.New("no rows found")
+	}
+
+	values := make([]any, len(columns))
+	for i := range values {
+		values[i] = new(sql.NullString)
+	}
+	if err = rows.Scan(values...); err != nil {
+		return nil, "", fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	row = make(map[string]any, len(columns))
+	for i, name := range columns {
+		if value := values[i].(*sql.NullString); value.Valid {
+			row[name] = value.String
+		} else {
+			row[name] = nil
+		}
+	}
+	return row, column, nil
+}
+
+// Close closes the underlying database connection pool.
+func (x *sqlResolver) Close() error {
+	return x.db.Close()
+}
@@ -0,0 +1,122 @@
+package routing_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+
+	_ "modernc.org/sqlite"
+)
+
+func newSQLiteDB(t *testing.T) string {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	stmts := []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT, country TEXT)`,
+		`INSERT INTO users (id, name, country) VALUES ('alice', 'Alice', 'eu-west1'), ('bob', 'Bob', NULL)`,
+	}
+	for _, stmt := range stmts {
+		if _, err = db.ExecContext(context.Background(), stmt); err != nil {
+			t.Fatalf("exec %q: %v", stmt, err)
+		}
+	}
+	return dsn
+}
+
+func TestSQLResolver(t *testing.T) {
+	dsn := newSQLiteDB(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		column  string
+		param   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "first column",
+			query: "SELECT country FROM users WHERE id = ?",
+			param: "alice",
+			want:  "region-A",
+		},
+		{
+			name:   "named column",
+			query:  "SELECT name, country FROM users WHERE id = ?",
+			column: "country",
+			param:  "alice",
+			want:   "region-A",
+		},
+		{
+			name:    "unknown column",
+			query:   "SELECT name FROM users WHERE id = ?",
+			column:  "country",
+			param:   "alice",
+			wantErr: true,
+		},
+		{
+			name:    "no rows",
+			query:   "SELECT country FROM users WHERE id = ?",
+			param:   "mallory",
+			wantErr: true,
+		},
+		{
+			name:    "null value",
+			query:   "SELECT country FROM users WHERE id = ?",
+			param:   "bob",
+			wantErr: true,
+		},
+		{
+			name:    "unmapped value",
+			query:   "SELECT name FROM users WHERE id = ?",
+			param:   "alice",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rslv, err := routing.NewResolver(&config.RegionRetriever{
+				Type: config.RegionResolverTypeSQL,
+				SQL: &config.SQLRetriever{
+					Driver:       "sqlite",
+					DSN:          dsn,
+					Query:        tt.query,
+					Column:       tt.column,
+					QueryTimeout: "1s",
+					MaxOpenConns: 2,
+				},
+				RegionResolver: &config.RegionResolver{
+					Type:    "map",
+					Mapping: map[string]string{"eu-west1": "region-A"},
+				},
+			})
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+			defer func() {
+				_ = rslv.(io.Closer).Close()
+			}()
+
+			region, err := rslv.ResolveRegion(context.Background(), tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if region != tt.want {
+				t.Errorf("unexpected region: %s", region)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package routing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// expandTemplate replaces the placeholders of s with param and the attributes of the incoming request
+// stored in ctx, each value being escaped by escape.
+// Attributes missing from the request are replaced by an empty string.
+func expandTemplate(ctx context.Context, s, param string, escape func(string) string) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+
+	r, _ := RequestFromContext(ctx)
+	return config.TemplatePlaceholders.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "{param}" {
+			return escape(param)
+		}
+		if r == nil {
+			return ""
+		}
+		return escape(requestAttribute(r, match[1:len(match)-1]))
+	})
+}
+
+// requestAttribute returns the attribute of r named by a placeholder.
+func requestAttribute(r *Request, name string) string {
+	source, key, _ := strings.Cut(name, ":")
+	switch source {
+	case "host":
+		return r.Host
+	case "path":
+		return r.Path
+	case "client_ip":
+		return r.ClientIP
+	case "header":
+		return r.Header.Get(key)
+	case "query":
+		return r.Query.Get(key)
+	case "metadata":
+		if vals := r.Metadata.Get(key); len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	return ""
+}
+
+// noEscape leaves template values as is, for contexts that escape them on their own (e.g. url.Values).
+func noEscape(s string) string {
+	return s
+}
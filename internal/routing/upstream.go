@@ -0,0 +1,205 @@
+package routing
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+)
+
+// ringReplicas is the number of points of an endpoint of weight 1 on the consistent hashing ring.
+const ringReplicas = 100
+
+// noRelease is the release function of the addresses not picked from an upstream.
+func noRelease() {}
+
+// Upstreams holds the Balancer of each upstream of a protocol, by name.
+type Upstreams map[string]*Balancer
+
+// NewUpstreams returns the Upstreams defined in cfg, expected to be validated, see config.ProtocolCfg.
+// Their endpoints that health reports unhealthy are skipped, health may be nil.
+func NewUpstreams(cfg map[string]config.Upstream, health *HealthChecker) Upstreams {
+	u := make(Upstreams, len(cfg))
+	for name, upstream := range cfg {
+		u[name] = NewBalancer(upstream, health)
+	}
+	return u
+}
+
+// Resolve returns dest if it is not the name of an upstream, see config.UpstreamPrefix,
+// otherwise the endpoint picked for the region lookup value key along with the function releasing it
+// once the request is done. release is never nil, ok is false if the upstream does not exist
+// or none of its endpoints is healthy.
+func (u Upstreams) Resolve(dest, key string) (addr string, release func(), ok bool) {
+	name, isUpstream := strings.CutPrefix(dest, config.UpstreamPrefix)
+	if !isUpstream {
+		return dest, noRelease, true
+	}
+	b, ok := u[name]
+	if !ok {
+		return "", noRelease, false
+	}
+	return b.Pick(key)
+}
+
+// Balancer picks the endpoints of an upstream according to its policy. It is safe for concurrent use.
+type Balancer struct {
+	health *HealthChecker
+	policy string
+	// outstanding is the number of requests in progress by endpoint.
+	outstanding []atomic.Int64
+	endpoints   []string
+	weights     []int
+	// current holds the running weights of the smooth weighted round robin.
+	current []int
+	ring    []ringPoint
+	next    atomic.Uint64
+	mu      sync.Mutex
+}
+
+// ringPoint is a point of the consistent hashing ring, owned by the endpoint at index.
+type ringPoint struct {
+	hash  uint32
+	index int
+}
+
+// NewBalancer returns the Balancer of upstream, skipping the endpoints that health reports unhealthy.
+// health may be nil.
+func NewBalancer(upstream config.Upstream, health *HealthChecker) *Balancer {
+	b := &Balancer{
+		health:      health,
+		outstanding: make([]atomic.Int64, len(upstream.Endpoints)),
+		endpoints:   make([]string, len(upstream.Endpoints)),
+		weights:     make([]int, len(upstream.Endpoints)),
+		current:     make([]int, len(upstream.Endpoints)),
+		policy:      upstream.Policy,
+	}
+	for i, e := range upstream.Endpoints {
+		b.endpoints[i] = e.Address
+		b.weights[i] = max(e.Weight, 1)
+	}
+
+	if b.policy == config.BalanceConsistentHash {
+		for i, addr := range b.endpoints {
+			for r := range ringReplicas * b.weights[i] {
+				b.ring = append(b.ring, ringPoint{hash: hashString(addr + "#" + strconv.Itoa(r)), index: i})
+			}
+		}
+		sort.Slice(b.ring, func(i, j int) bool {
+			return b.ring[i].hash < b.ring[j].hash
+		})
+	}
+	return b
+}
+
+// Pick returns the healthy endpoint for the region lookup value key, and the function to call once
+// the request is done. ok is false if no endpoint is healthy.
+func (b *Balancer) Pick(key string) (addr string, release func(), ok bool) {
+	var i int
+	switch b.policy {
+	case config.BalanceLeastOutstanding:
+		i = b.leastOutstanding()
+	case config.BalanceWeighted:
+		i = b.weighted()
+	case config.BalanceConsistentHash:
+		i = b.consistentHash(key)
+	default:
+		i = b.roundRobin()
+	}
+	if i < 0 {
+		return "", noRelease, false
+	}
+
+	b.outstanding[i].Add(1)
+	return b.endpoints[i], sync.OnceFunc(func() {
+		b.outstanding[i].Add(-1)
+	}), true
+}
+
+// healthy reports whether the endpoint at index i is healthy.
+func (b *Balancer) healthy(i int) bool {
+	return b.health.Healthy(b.endpoints[i])
+}
+
+// roundRobin returns the next healthy endpoint in turn, or -1.
+func (b *Balancer) roundRobin() int {
+	n := uint64(len(b.endpoints))
+	start := b.next.Add(1) - 1
+	for j := range n {
+		if i := int((start + j) % n); b.healthy(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// leastOutstanding returns the healthy endpoint with the fewest requests in progress, or -1.
+// Ties are broken in turn so that idle endpoints share the load.
+func (b *Balancer) leastOutstanding() int {
+	n := uint64(len(b.endpoints))
+	start := b.next.Add(1) - 1
+	best := -1
+	for j := range n {
+		i := int((start + j) % n)
+		if b.healthy(i) && (best < 0 || b.outstanding[i].Load() < b.outstanding[best].Load()) {
+			best = i
+		}
+	}
+	return best
+}
+
+// weighted returns the next healthy endpoint of the smooth weighted round robin, or -1.
+// It interleaves the endpoints instead of sending bursts to the heaviest ones.
+func (b *Balancer) weighted() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total, best := 0, -1
+	for i, weight := range b.weights {
+		if !b.healthy(i) {
+			continue
+		}
+		b.current[i] += weight
+		total += weight
+		if best < 0 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		b.current[best] -= total
+	}
+	return best
+}
+
+// consistentHash returns the healthy endpoint owning the first point of the ring following the hash of key,
+// or -1. The keys of an unhealthy endpoint move to the following points of the ring, the others stay.
+func (b *Balancer) consistentHash(key string) int {
+	h := hashString(key)
+	start := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+	for j := range b.ring {
+		if p := b.ring[(start+j)%len(b.ring)]; b.healthy(p.index) {
+			return p.index
+		}
+	}
+	return -1
+}
+
+// hashString returns the FNV-1a hash of s, mixed with the murmur3 finalizer:
+// FNV alone spreads the similar strings of the ring points and of the lookup values poorly.
+func hashString(s string) uint32 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return uint32(x)
+}
@@ -0,0 +1,115 @@
+package routing_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/CanobbioE/poly-route/internal/config"
+	"github.com/CanobbioE/poly-route/internal/routing"
+)
+
+func endpoints(weights ...int) []config.Endpoint {
+	e := make([]config.Endpoint, len(weights))
+	for i, weight := range weights {
+		e[i] = config.Endpoint{Address: "http://backend-" + strconv.Itoa(i), Weight: weight}
+	}
+	return e
+}
+
+func TestBalancer_Pick(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		want     []string
+		weights  []int
+		holdLast bool
+	}{
+		{
+			name:    "round robin",
+			weights: []int{0, 0, 0},
+			want:    []string{"http://backend-0", "http://backend-1", "http://backend-2", "http://backend-0"},
+		},
+		{
+			name:    "weighted",
+			policy:  config.BalanceWeighted,
+			weights: []int{3, 1},
+			want:    []string{"http://backend-0", "http://backend-0", "http://backend-1", "http://backend-0"},
+		},
+		{
+			name:     "least outstanding",
+			policy:   config.BalanceLeastOutstanding,
+			weights:  []int{0, 0},
+			holdLast: true,
+			// backend-0 is held, every following request goes to the idle backend-1
+			want: []string{"http://backend-0", "http://backend-1", "http://backend-1", "http://backend-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := routing.NewBalancer(config.Upstream{Policy: tt.policy, Endpoints: endpoints(tt.weights...)}, nil)
+			for i, want := range tt.want {
+				got, release, _ := b.Pick("key")
+				if !tt.holdLast || i == 0 {
+					defer release()
+				} else {
+					release()
+				}
+				if got != want {
+					t.Errorf("Pick() #%d got = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBalancer_Pick_ConsistentHash(t *testing.T) {
+	b := routing.NewBalancer(config.Upstream{Policy: config.BalanceConsistentHash, Endpoints: endpoints(1, 1, 1)}, nil)
+	seen := map[string]bool{}
+	for i := range 100 {
+		key := "user-" + strconv.Itoa(i)
+		got, release, _ := b.Pick(key)
+		release()
+		if again, release, _ := b.Pick(key); again != got {
+			t.Errorf("Pick(%q) got = %v then %v, want the same endpoint", key, got, again)
+		} else {
+			release()
+		}
+		seen[got] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Pick() used %d endpoints, want 3", len(seen))
+	}
+
+	// removing an endpoint only moves its own keys
+	smaller := routing.NewBalancer(config.Upstream{Policy: config.BalanceConsistentHash, Endpoints: endpoints(1, 1)}, nil)
+	for i := range 100 {
+		key := "user-" + strconv.Itoa(i)
+		before, _, _ := b.Pick(key)
+		after, _, _ := smaller.Pick(key)
+		if before != "http://backend-2" && before != after {
+			t.Errorf("Pick(%q) moved from %v to %v", key, before, after)
+		}
+	}
+}
+
+func TestUpstreams_Resolve(t *testing.T) {
+	u := routing.NewUpstreams(map[string]config.Upstream{"orders": {Endpoints: endpoints(0)}}, nil)
+	tests := []struct {
+		dest   string
+		want   string
+		wantOk bool
+	}{
+		{dest: "http://orders-eu", want: "http://orders-eu", wantOk: true},
+		{dest: "upstream:orders", want: "http://backend-0", wantOk: true},
+		{dest: "upstream:unknown", want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dest, func(t *testing.T) {
+			got, release, ok := u.Resolve(tt.dest, "key")
+			release()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Resolve() got = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
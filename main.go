@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
@@ -12,12 +14,19 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/CanobbioE/poly-route/internal/auth"
 	"github.com/CanobbioE/poly-route/internal/codec"
 	"github.com/CanobbioE/poly-route/internal/config"
 	"github.com/CanobbioE/poly-route/internal/forwarder"
 	"github.com/CanobbioE/poly-route/internal/logger"
 	"github.com/CanobbioE/poly-route/internal/routing"
+
+	// database drivers available to the sql region retriever.
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
 )
 
 func main() {
@@ -35,17 +44,54 @@ func main() {
 		return
 	}
 
+	// connections to gRPC region retrievers are pooled like the ones to the gRPC backends
+	retrieverConns := forwarder.NewConnectionPool(grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer func() {
+		_ = retrieverConns.CloseAll()
+	}()
+	monitor := routing.NewMonitor()
 	regionResolver, err := routing.NewResolver(
 		cfg.RegionRetriever,
 		routing.WithHTTPClient(&http.Client{Timeout: 3 * time.Second}),
+		routing.WithConnGetter(retrieverConns),
+		routing.WithMonitor(monitor),
 	)
 	if err != nil {
 		log.Error("failed to create region resolver", "error", err)
 		return
 	}
+	defer func() {
+		if closer, ok := regionResolver.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}()
+
+	var verifier *auth.Verifier
+	if cfg.JWT != nil {
+		if verifier, err = auth.NewVerifier(cfg.JWT); err != nil {
+			log.Error("failed to create token verifier", "error", err)
+			return
+		}
+	}
+
+	proxies, err := routing.NewTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Error("failed to parse trusted proxies", "error", err)
+		return
+	}
+	health := routing.NewHealthChecker()
+	defer func() {
+		_ = health.Close()
+	}()
+	// options shared by the forwarders of every protocol
+	shared := []forwarder.Option{
+		forwarder.WithTrustedProxies(proxies),
+		forwarder.WithMigrations(routing.NewMigrations(cfg.Migrations)),
+		forwarder.WithHealthChecker(health),
+	}
 
-	httpProxy := startHTTPProxy(cfg, regionResolver, log)
-	grpcProxy, grpcForwarder := startGRPCProxy(cfg, regionResolver, log)
+	httpProxy := startHTTPProxy(cfg, regionResolver, verifier, shared, log)
+	grpcProxy, grpcForwarder := startGRPCProxy(cfg, regionResolver, verifier, shared, log)
 	defer func() {
 		if grpcForwarder != nil {
 			// closing the forwarder as last thing ensures no connection
@@ -53,7 +99,8 @@ func main() {
 			_ = grpcForwarder.Close()
 		}
 	}()
-	graphQLProxy := startGraphQLProxy(cfg, regionResolver, log)
+	graphQLProxy := startGraphQLProxy(cfg, regionResolver, verifier, shared, log)
+	adminServer := startAdminServer(cfg, monitor, health, log)
 
 	if httpProxy == nil && grpcProxy == nil && graphQLProxy == nil {
 		log.Error("no proxy server set up, stopping now")
@@ -81,15 +128,66 @@ func main() {
 			log.Warn("failed to shutdown proxy GraphQL server")
 		}
 	}
+	if adminServer != nil {
+		if err = adminServer.Shutdown(ctx); err != nil {
+			log.Warn("failed to shutdown admin server")
+		}
+	}
 }
 
-func startGraphQLProxy(cfg *config.ServiceCfg, resolver routing.RegionResolver, l logger.LazyLogger) *http.Server {
+// startAdminServer serves the status of the region resolvers and the health of the backends, if enabled.
+func startAdminServer(
+	cfg *config.ServiceCfg,
+	monitor *routing.Monitor,
+	health *routing.HealthChecker,
+	l logger.LazyLogger,
+) *http.Server {
+	if cfg.Admin == nil {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /status", monitor)
+	mux.Handle("GET /backends", health)
+	addr := cfg.Admin.Listen
+	if !strings.HasPrefix(addr, ":") {
+		addr = ":" + addr
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	go func() {
+		l.Info("admin server is listening", "address", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Error("failed to serve admin", "error", err)
+		}
+	}()
+
+	return server
+}
+
+func startGraphQLProxy(
+	cfg *config.ServiceCfg,
+	resolver routing.RegionResolver,
+	verifier *auth.Verifier,
+	shared []forwarder.Option,
+	l logger.LazyLogger,
+) *http.Server {
 	if cfg.GraphQL == nil {
 		l.Info("GraphQL proxy not enabled")
 		return nil
 	}
 
-	server := newHTTPProxyServer(cfg.GraphQL, resolver, l)
+	server, err := newHTTPProxyServer(cfg.GraphQL, config.ProtocolGraphQL, resolver, verifier, shared, l)
+	if err != nil {
+		l.Error("failed to create graphql proxy", "error", err)
+		return nil
+	}
 
 	go func() {
 		l.Info("graphql proxy is listening", "address", server.Addr)
@@ -102,13 +200,23 @@ func startGraphQLProxy(cfg *config.ServiceCfg, resolver routing.RegionResolver,
 	return server
 }
 
-func startHTTPProxy(cfg *config.ServiceCfg, resolver routing.RegionResolver, l logger.LazyLogger) *http.Server {
+func startHTTPProxy(
+	cfg *config.ServiceCfg,
+	resolver routing.RegionResolver,
+	verifier *auth.Verifier,
+	shared []forwarder.Option,
+	l logger.LazyLogger,
+) *http.Server {
 	if cfg.HTTP == nil {
 		l.Info("HTTP proxy not enabled")
 		return nil
 	}
 
-	server := newHTTPProxyServer(cfg.HTTP, resolver, l)
+	server, err := newHTTPProxyServer(cfg.HTTP, config.ProtocolHTTP, resolver, verifier, shared, l)
+	if err != nil {
+		l.Error("failed to create http proxy", "error", err)
+		return nil
+	}
 
 	go func() {
 		l.Info("http proxy is listening", "address", server.Addr)
@@ -121,9 +229,21 @@ func startHTTPProxy(cfg *config.ServiceCfg, resolver routing.RegionResolver, l l
 	return server
 }
 
-func newHTTPProxyServer(cfg *config.ProtocolCfg, resolver routing.RegionResolver, l logger.LazyLogger) *http.Server {
+func newHTTPProxyServer(
+	cfg *config.ProtocolCfg,
+	p config.Protocol,
+	resolver routing.RegionResolver,
+	verifier *auth.Verifier,
+	shared []forwarder.Option,
+	l logger.LazyLogger,
+) (*http.Server, error) {
+	opts, err := forwarderOptions(cfg, p, verifier, shared)
+	if err != nil {
+		return nil, err
+	}
+
 	mux := http.NewServeMux()
-	httpHandler := forwarder.HTTP(cfg, resolver, l).Handler()
+	httpHandler := forwarder.HTTP(cfg, resolver, l, opts...).Handler()
 	mux.HandleFunc("/", httpHandler)
 	addr := cfg.Listen
 	if !strings.HasPrefix(cfg.Listen, ":") {
@@ -138,7 +258,29 @@ func newHTTPProxyServer(cfg *config.ProtocolCfg, resolver routing.RegionResolver
 		ReadHeaderTimeout: 2 * time.Second,
 	}
 
-	return server
+	return server, nil
+}
+
+// forwarderOptions returns the options of the forwarder serving protocol p, on top of the shared ones.
+func forwarderOptions(
+	cfg *config.ProtocolCfg,
+	p config.Protocol,
+	verifier *auth.Verifier,
+	shared []forwarder.Option,
+) ([]forwarder.Option, error) {
+	keys, err := routing.NewKeyPipeline(cfg.RegionKeys, p, verifier)
+	if err != nil {
+		return nil, err
+	}
+	opts := append([]forwarder.Option{forwarder.WithKeyExtractor(keys)}, shared...)
+	if cfg.Affinity != nil {
+		affinity, err := routing.NewAffinity(cfg.Affinity)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, forwarder.WithAffinity(affinity))
+	}
+	return opts, nil
 }
 
 // startGRPCProxy returns both the gRPC server and the forwarder so that the
@@ -146,6 +288,8 @@ func newHTTPProxyServer(cfg *config.ProtocolCfg, resolver routing.RegionResolver
 func startGRPCProxy(
 	cfg *config.ServiceCfg,
 	resolver routing.RegionResolver,
+	verifier *auth.Verifier,
+	shared []forwarder.Option,
 	l logger.LazyLogger,
 ) (*grpc.Server, *forwarder.GRPCForwarder) {
 	if cfg.GRPC == nil {
@@ -153,13 +297,19 @@ func startGRPCProxy(
 		return nil, nil
 	}
 
+	opts, err := forwarderOptions(cfg.GRPC, config.ProtocolGRPC, verifier, shared)
+	if err != nil {
+		l.Error("failed to create grpc proxy", "error", err)
+		return nil, nil
+	}
+
 	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", ":"+cfg.GRPC.Listen)
 	if err != nil {
 		l.Error("failed to listen", "address", cfg.GRPC.Listen, "error", err)
 		return nil, nil
 	}
 
-	grpcFwd := forwarder.GRPC(cfg.GRPC, resolver, l)
+	grpcFwd := forwarder.GRPC(cfg.GRPC, resolver, l, opts...)
 	server := grpc.NewServer(
 		grpc.UnknownServiceHandler(grpcFwd.Handler()),
 		grpc.ForceServerCodec(&codec.PassThrough{}),
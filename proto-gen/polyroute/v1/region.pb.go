@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: polyroute/v1/region.proto
+
+package polyroutev1
+
+import (
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type LookupRegionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// key is the value extracted from the incoming request (e.g. the user ID).
+	Key           string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRegionRequest) Reset() {
+	*x = LookupRegionRequest{}
+	mi := &file_polyroute_v1_region_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRegionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRegionRequest) ProtoMessage() {}
+
+func (x *LookupRegionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_polyroute_v1_region_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRegionRequest.ProtoReflect.Descriptor instead.
+func (*LookupRegionRequest) Descriptor() ([]byte, []int) {
+	return file_polyroute_v1_region_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LookupRegionRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type LookupRegionResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// region is looked up in the region_resolver mapping.
+	Region        string `protobuf:"bytes,1,opt,name=region,proto3" json:"region,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LookupRegionResponse) Reset() {
+	*x = LookupRegionResponse{}
+	mi := &file_polyroute_v1_region_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LookupRegionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LookupRegionResponse) ProtoMessage() {}
+
+func (x *LookupRegionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_polyroute_v1_region_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LookupRegionResponse.ProtoReflect.Descriptor instead.
+func (*LookupRegionResponse) Descriptor() ([]byte, []int) {
+	return file_polyroute_v1_region_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LookupRegionResponse) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+var File_polyroute_v1_region_proto protoreflect.FileDescriptor
+
+const file_polyroute_v1_region_proto_rawDesc = "" +
+	"\n" +
+	"\x19polyroute/v1/region.proto\x12\fpolyroute.v1\"'\n" +
+	"\x13LookupRegionRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\".\n" +
+	"\x14LookupRegionResponse\x12\x16\n" +
+	"\x06region\x18\x01 \x01(\tR\x06region2f\n" +
+	"\rRegionService\x12U\n" +
+	"\fLookupRegion\x12!.polyroute.v1.LookupRegionRequest\x1a\".polyroute.v1.LookupRegionResponseB\xb4\x01\n" +
+	"\x10com.polyroute.v1B\vRegionProtoP\x01ZBgithub.com/CanobbioE/poly-route/proto-gen/polyroute/v1;polyroutev1\xa2\x02\x03PXX\xaa\x02\fPolyroute.V1\xca\x02\fPolyroute\\V1\xe2\x02\x18Polyroute\\V1\\GPBMetadata\xea\x02\rPolyroute::V1b\x06proto3"
+
+var (
+	file_polyroute_v1_region_proto_rawDescOnce sync.Once
+	file_polyroute_v1_region_proto_rawDescData []byte
+)
+
+func file_polyroute_v1_region_proto_rawDescGZIP() []byte {
+	file_polyroute_v1_region_proto_rawDescOnce.Do(func() {
+		file_polyroute_v1_region_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_polyroute_v1_region_proto_rawDesc), len(file_polyroute_v1_region_proto_rawDesc)))
+	})
+	return file_polyroute_v1_region_proto_rawDescData
+}
+
+var file_polyroute_v1_region_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_polyroute_v1_region_proto_goTypes = []any{
+	(*LookupRegionRequest)(nil),  // 0: polyroute.v1.LookupRegionRequest
+	(*LookupRegionResponse)(nil), // 1: polyroute.v1.LookupRegionResponse
+}
+var file_polyroute_v1_region_proto_depIdxs = []int32{
+	0, // 0: polyroute.v1.RegionService.LookupRegion:input_type -> polyroute.v1.LookupRegionRequest
+	1, // 1: polyroute.v1.RegionService.LookupRegion:output_type -> polyroute.v1.LookupRegionResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_polyroute_v1_region_proto_init() }
+func file_polyroute_v1_region_proto_init() {
+	if File_polyroute_v1_region_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_polyroute_v1_region_proto_rawDesc), len(file_polyroute_v1_region_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_polyroute_v1_region_proto_goTypes,
+		DependencyIndexes: file_polyroute_v1_region_proto_depIdxs,
+		MessageInfos:      file_polyroute_v1_region_proto_msgTypes,
+	}.Build()
+	File_polyroute_v1_region_proto = out.File
+	file_polyroute_v1_region_proto_goTypes = nil
+	file_polyroute_v1_region_proto_depIdxs = nil
+}
@@ -0,0 +1,130 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: polyroute/v1/region.proto
+
+package polyroutev1
+
+import (
+	context "context"
+
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RegionService_LookupRegion_FullMethodName = "/polyroute.v1.RegionService/LookupRegion"
+)
+
+// RegionServiceClient is the client API for RegionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RegionService is the well-known API called by the grpc region retriever
+// when no descriptor set is configured.
+type RegionServiceClient interface {
+	// LookupRegion returns the value mapped to a region by the region_resolver.
+	LookupRegion(ctx context.Context, in *LookupRegionRequest, opts ...grpc.CallOption) (*LookupRegionResponse, error)
+}
+
+type regionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRegionServiceClient(cc grpc.ClientConnInterface) RegionServiceClient {
+	return &regionServiceClient{cc}
+}
+
+func (c *regionServiceClient) LookupRegion(ctx context.Context, in *LookupRegionRequest, opts ...grpc.CallOption) (*LookupRegionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupRegionResponse)
+	err := c.cc.Invoke(ctx, RegionService_LookupRegion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RegionServiceServer is the server API for RegionService service.
+// All implementations must embed UnimplementedRegionServiceServer
+// for forward compatibility.
+//
+// RegionService is the well-known API called by the grpc region retriever
+// when no descriptor set is configured.
+type RegionServiceServer interface {
+	// LookupRegion returns the value mapped to a region by the region_resolver.
+	LookupRegion(context.Context, *LookupRegionRequest) (*LookupRegionResponse, error)
+	mustEmbedUnimplementedRegionServiceServer()
+}
+
+// UnimplementedRegionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRegionServiceServer struct{}
+
+func (UnimplementedRegionServiceServer) LookupRegion(context.Context, *LookupRegionRequest) (*LookupRegionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupRegion not implemented")
+}
+func (UnimplementedRegionServiceServer) mustEmbedUnimplementedRegionServiceServer() {}
+func (UnimplementedRegionServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeRegionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RegionServiceServer will
+// result in compilation errors.
+type UnsafeRegionServiceServer interface {
+	mustEmbedUnimplementedRegionServiceServer()
+}
+
+func RegisterRegionServiceServer(s grpc.ServiceRegistrar, srv RegionServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRegionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RegionService_ServiceDesc, srv)
+}
+
+func _RegionService_LookupRegion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRegionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionServiceServer).LookupRegion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RegionService_LookupRegion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionServiceServer).LookupRegion(ctx, req.(*LookupRegionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegionService_ServiceDesc is the grpc.ServiceDesc for RegionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RegionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "polyroute.v1.RegionService",
+	HandlerType: (*RegionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "LookupRegion",
+			Handler:    _RegionService_LookupRegion_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "polyroute/v1/region.proto",
+}